@@ -6,34 +6,32 @@ package affinity
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/google/go-github/v73/github"
 	"github.com/jekyll/jekyllbot/ctx"
 )
 
-var explanation = `We are utilizing a new workflow in our issues and pull requests. Affinity teams have been setup to allow community members to hear about pull requests that may be interesting to them. When a new issue or pull request comes in, we are asking that the author mention the appropriate affinity team. I then assign a random "team captain" or two to the issue who is in charge of triaging it until it is closed or passing it off to another captain. In order to move forward with this new workflow, we need to know: which of the following teams best fits your issue or contribution?`
+var explanation = `We are utilizing a new workflow in our issues and pull requests. Affinity teams have been setup to allow community members to hear about pull requests that may be interesting to them. When a new issue or pull request comes in, we are asking that the author mention the appropriate affinity team. I then assign a "team captain" or two to the issue who is in charge of triaging it until it is closed or passing it off to another captain. In order to move forward with this new workflow, we need to know: which of the following teams best fits your issue or contribution?`
 
-func assignTeamCaptains(context *ctx.Context, handler Handler, body string, assigneeCount int) error {
+func assignTeamCaptains(context *ctx.Context, handler *Handler, teams []Team, assigneeCount int) error {
 	if context.Issue.IsEmpty() {
 		context.IncrStat("affinity.error.no_ref", nil)
 		return context.NewError("assignTeamCaptains: issue reference was not set; bailing")
 	}
 
-	team, err := findAffinityTeam(body, handler.teams)
-	if err != nil {
+	if len(teams) == 0 {
 		context.IncrStat("affinity.error.no_team", nil)
-		//return askForAffinityTeam(context, handler.teams)
-		return context.NewError("%s: no team in the message body; unable to assign", context.Issue)
+		return context.NewError("%s: no team in the message body or labels; unable to assign", context.Issue)
 	}
 
-	context.Log("team: %s, excluding: %s", team, context.Issue.Author)
-	victims := team.RandomCaptainLoginsExcluding(context.Issue.Author, assigneeCount)
+	victims := selectCaptainsFromTeams(context, handler, teams, assigneeCount)
 	if len(victims) == 0 {
 		context.IncrStat("affinity.error.no_acceptable_captains", nil)
 		return context.NewError("%s: team captains other than issue author could not be found", context.Issue)
 	}
 	context.Log("selected affinity team captains for %s: %q", context.Issue, victims)
-	_, _, err = context.GitHub.Issues.AddAssignees(
+	_, _, err := context.GitHub.Issues.AddAssignees(
 		context.Context(),
 		context.Issue.Owner,
 		context.Issue.Repo,
@@ -45,32 +43,30 @@ func assignTeamCaptains(context *ctx.Context, handler Handler, body string, assi
 		return context.NewError("assignTeamCaptains: problem assigning: %v", err)
 	}
 
+	recentAssignments.add(victims, time.Now())
 	context.IncrStat("affinity.success", nil)
 	context.Log("assignTeamCaptains: assigned %q to %s", victims, context.Issue)
 	return nil
 }
 
-func requestReviewFromTeamCaptains(context *ctx.Context, handler Handler, body string, assigneeCount int) error {
+func requestReviewFromTeamCaptains(context *ctx.Context, handler *Handler, teams []Team, assigneeCount int) error {
 	if context.Issue.IsEmpty() {
 		context.IncrStat("affinity.error.no_ref", nil)
 		return context.NewError("requestReviewFromTeamCaptains: issue reference was not set; bailing")
 	}
 
-	team, err := findAffinityTeam(body, handler.teams)
-	if err != nil {
+	if len(teams) == 0 {
 		context.IncrStat("affinity.error.no_team", nil)
-		//return askForAffinityTeam(context, handler.teams)
-		return context.NewError("%s: no team in the message body; unable to assign", context.Issue)
+		return context.NewError("%s: no team in the message body or labels; unable to assign", context.Issue)
 	}
 
-	context.Log("team: %s, excluding: %s", team, context.Issue.Author)
-	victims := team.RandomCaptainLoginsExcluding(context.Issue.Author, assigneeCount)
+	victims := selectCaptainsFromTeams(context, handler, teams, assigneeCount)
 	if len(victims) == 0 {
 		context.IncrStat("affinity.error.no_acceptable_captains", nil)
 		return context.NewError("%s: team captains other than issue author could not be found", context.Issue)
 	}
 	context.Log("selected affinity team captains for %s: %q", context.Issue, victims)
-	_, _, err = context.GitHub.PullRequests.RequestReviewers(
+	_, _, err := context.GitHub.PullRequests.RequestReviewers(
 		context.Context(),
 		context.Issue.Owner,
 		context.Issue.Repo,
@@ -82,11 +78,23 @@ func requestReviewFromTeamCaptains(context *ctx.Context, handler Handler, body s
 		return context.NewError("requestReviewFromTeamCaptains: problem assigning: %v", err)
 	}
 
+	recentAssignments.add(victims, time.Now())
 	context.IncrStat("affinity.success", nil)
 	context.Log("requestReviewFromTeamCaptains: requested review from %q on %s", victims, context.Issue)
 	return nil
 }
 
+// selectCaptainsFromTeams picks assigneeCount captains from each team,
+// never picking the same captain twice.
+func selectCaptainsFromTeams(context *ctx.Context, handler *Handler, teams []Team, assigneeCount int) []string {
+	victims := []string{}
+	for _, team := range teams {
+		context.Log("team: %s, excluding: %s", team, context.Issue.Author)
+		victims = append(victims, handler.selectCaptains(context, withoutCaptains(team, victims), context.Issue.Author, assigneeCount)...)
+	}
+	return victims
+}
+
 func findAffinityTeam(body string, allTeams []Team) (Team, error) {
 	for _, team := range allTeams {
 		if strings.Contains(body, team.Mention) {
@@ -96,18 +104,18 @@ func findAffinityTeam(body string, allTeams []Team) (Team, error) {
 	return Team{}, fmt.Errorf("findAffinityTeam: no matching team")
 }
 
-func askForAffinityTeam(context *ctx.Context, allTeams []Team) error {
-	_, _, err := context.GitHub.Issues.CreateComment(
-		context.Context(),
-		context.Issue.Owner,
-		context.Issue.Repo,
-		context.Issue.Num,
-		&github.IssueComment{Body: github.String(buildAffinityTeamMessage(context, allTeams))},
-	)
-	if err != nil {
-		return context.NewError("askForAffinityTeam: could not leave comment: %v", err)
+func mentionsTeam(body string, allTeams []Team) bool {
+	_, err := findAffinityTeam(body, allTeams)
+	return err == nil
+}
+
+func hasLabel(labels []*github.Label, name string) bool {
+	for _, label := range labels {
+		if label.GetName() == name {
+			return true
+		}
 	}
-	return nil
+	return false
 }
 
 func buildAffinityTeamMessage(context *ctx.Context, allTeams []Team) string {
@@ -127,8 +135,8 @@ func buildAffinityTeamMessage(context *ctx.Context, allTeams []Team) string {
 	}
 
 	return fmt.Sprintf(
-		"%s %s\n\n%s\n\nMention one of these teams in a comment below and we'll get this sorted. Thanks!",
-		prefix, explanation, strings.Join(teams, "\n"),
+		"%s\n%s %s\n\n%s\n\nMention one of these teams in a comment below and we'll get this sorted. Thanks!",
+		askForTeamMarker, prefix, explanation, strings.Join(teams, "\n"),
 	)
 }
 
@@ -0,0 +1,205 @@
+package affinity
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/ctx"
+	"github.com/jekyll/jekyllbot/labeler"
+)
+
+// NeedsTeamLabel is added to issues and PRs which the bot has asked to
+// mention an affinity team, until one is mentioned.
+var NeedsTeamLabel = "needs-team"
+
+const (
+	askForTeamMarker = "<!-- affinity:ask-for-team -->"
+	reminderMarker   = "<!-- affinity:ask-for-team-reminder -->"
+)
+
+// EnableAskForTeam makes the bot ask for an affinity team on new issues and
+// PRs in the repo which don't mention one, and remind the author if nobody
+// has mentioned one after remindAfterDays.
+func (h *Handler) EnableAskForTeam(owner, name string, remindAfterDays int) {
+	if repo := h.findRepo(owner, name); repo != nil {
+		repo.AskForTeam = true
+		repo.RemindAfter = time.Duration(remindAfterDays) * 24 * time.Hour
+	}
+}
+
+func (h *Handler) findRepo(owner, name string) *Repo {
+	for i, repo := range h.repos {
+		if repo.Owner == owner && repo.Name == name {
+			return &h.repos[i]
+		}
+	}
+	return nil
+}
+
+func (h *Handler) asksForTeam(owner, name string) bool {
+	repo := h.findRepo(owner, name)
+	return repo != nil && repo.AskForTeam
+}
+
+// StartRemindingAboutTeams checks for issues which still need a team every
+// interval in the background.
+func (h *Handler) StartRemindingAboutTeams(context *ctx.Context, interval time.Duration) {
+	go func() {
+		for {
+			time.Sleep(interval)
+			if err := h.RemindAboutTeams(context); err != nil {
+				context.Log("affinity: %v", err)
+			}
+		}
+	}()
+}
+
+// RemindAboutTeams reminds the authors of open issues and PRs labeled
+// NeedsTeamLabel to mention a team, once the repo's reminder period has
+// passed since the bot asked. If a team was mentioned after all, the label
+// is removed instead.
+func (h *Handler) RemindAboutTeams(context *ctx.Context) error {
+	teams := h.GetTeams()
+	for _, repo := range h.repos {
+		if !repo.AskForTeam {
+			continue
+		}
+
+		issues, err := issuesNeedingTeam(context, repo)
+		if err != nil {
+			return fmt.Errorf("RemindAboutTeams: couldn't list issues for %s/%s: %v", repo.Owner, repo.Name, err)
+		}
+
+		for _, issue := range issues {
+			comments, err := issueComments(context, repo.Owner, repo.Name, issue.GetNumber())
+			if err != nil {
+				context.Log("RemindAboutTeams: couldn't list comments on %s/%s#%d: %v", repo.Owner, repo.Name, issue.GetNumber(), err)
+				continue
+			}
+
+			state := askForTeamState(comments, teams, repo.RemindAfter, time.Now())
+			switch {
+			case state.teamMentioned:
+				if err := labeler.RemoveLabel(context, repo.Owner, repo.Name, issue.GetNumber(), NeedsTeamLabel); err != nil {
+					context.Log("RemindAboutTeams: couldn't unlabel %s/%s#%d: %v", repo.Owner, repo.Name, issue.GetNumber(), err)
+				}
+			case state.needsReminder:
+				_, _, err := context.GitHub.Issues.CreateComment(context.Context(), repo.Owner, repo.Name, issue.GetNumber(), &github.IssueComment{
+					Body: github.String(buildAffinityTeamReminder(issue.GetUser().GetLogin(), teams)),
+				})
+				if err != nil {
+					context.Log("RemindAboutTeams: couldn't remind %s/%s#%d: %v", repo.Owner, repo.Name, issue.GetNumber(), err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// teamPromptState is where an issue is in the ask-for-team process.
+type teamPromptState struct {
+	asked, reminded, teamMentioned, needsReminder bool
+}
+
+// askForTeamState works out from the comments whether the bot has asked
+// for a team, whether one has been mentioned since, and whether it's time
+// for a reminder.
+func askForTeamState(comments []*github.IssueComment, teams []Team, remindAfter time.Duration, now time.Time) teamPromptState {
+	state := teamPromptState{}
+	var askedAt time.Time
+	for _, comment := range comments {
+		body := comment.GetBody()
+		switch {
+		case strings.Contains(body, askForTeamMarker):
+			state.asked = true
+			askedAt = comment.GetCreatedAt().Time
+		case strings.Contains(body, reminderMarker):
+			state.reminded = true
+		case state.asked:
+			state.teamMentioned = state.teamMentioned || mentionsTeam(body, teams)
+		}
+	}
+	state.needsReminder = state.asked && !state.reminded && !state.teamMentioned &&
+		remindAfter > 0 && now.Sub(askedAt) >= remindAfter
+	return state
+}
+
+// askForAffinityTeam comments to ask which team the issue is for and labels
+// it NeedsTeamLabel. It never asks twice.
+func askForAffinityTeam(context *ctx.Context, allTeams []Team) error {
+	comments, err := issueComments(context, context.Issue.Owner, context.Issue.Repo, context.Issue.Num)
+	if err != nil {
+		return context.NewError("askForAffinityTeam: could not list comments: %v", err)
+	}
+	if askForTeamState(comments, allTeams, 0, time.Now()).asked {
+		return nil
+	}
+
+	_, _, err = context.GitHub.Issues.CreateComment(
+		context.Context(),
+		context.Issue.Owner,
+		context.Issue.Repo,
+		context.Issue.Num,
+		&github.IssueComment{Body: github.String(buildAffinityTeamMessage(context, allTeams))},
+	)
+	if err != nil {
+		return context.NewError("askForAffinityTeam: could not leave comment: %v", err)
+	}
+
+	err = labeler.AddLabels(context, context.Issue.Owner, context.Issue.Repo, context.Issue.Num, []string{NeedsTeamLabel})
+	if err != nil {
+		return context.NewError("askForAffinityTeam: could not add %s label: %v", NeedsTeamLabel, err)
+	}
+	return nil
+}
+
+func buildAffinityTeamReminder(author string, allTeams []Team) string {
+	mentions := []string{}
+	for _, team := range allTeams {
+		mentions = append(mentions, "`"+team.Mention+"`")
+	}
+	return fmt.Sprintf(
+		"%s\nHey, @%s! Just a friendly reminder: we still need to know which affinity team this is for. Mention one of %s in a comment and a team captain will pick it up.",
+		reminderMarker, author, strings.Join(mentions, ", "),
+	)
+}
+
+func issuesNeedingTeam(context *ctx.Context, repo Repo) ([]*github.Issue, error) {
+	var issues []*github.Issue
+	opts := &github.IssueListByRepoOptions{
+		State:       "open",
+		Labels:      []string{NeedsTeamLabel},
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		page, resp, err := context.GitHub.Issues.ListByRepo(context.Context(), repo.Owner, repo.Name, opts)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.ListOptions.Page = resp.NextPage
+	}
+	return issues, nil
+}
+
+func issueComments(context *ctx.Context, owner, repo string, number int) ([]*github.IssueComment, error) {
+	var comments []*github.IssueComment
+	opts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		page, resp, err := context.GitHub.Issues.ListComments(context.Context(), owner, repo, number, opts)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.ListOptions.Page = resp.NextPage
+	}
+	return comments, nil
+}
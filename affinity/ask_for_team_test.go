@@ -0,0 +1,120 @@
+package affinity
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAskForTeamState(t *testing.T) {
+	teams := []Team{{ID: 141, Mention: "@jekyll/windows"}}
+	now := time.Date(2026, time.October, 15, 12, 0, 0, 0, time.UTC)
+	comment := func(body string, daysAgo int) *github.IssueComment {
+		return &github.IssueComment{
+			Body:      github.String(body),
+			CreatedAt: &github.Timestamp{Time: now.AddDate(0, 0, -daysAgo)},
+		}
+	}
+	week := 7 * 24 * time.Hour
+
+	state := askForTeamState([]*github.IssueComment{comment("Me too", 10)}, teams, week, now)
+	assert.Equal(t, teamPromptState{}, state)
+
+	asked := comment(askForTeamMarker+"\nHey!", 8)
+	state = askForTeamState([]*github.IssueComment{asked}, teams, week, now)
+	assert.Equal(t, teamPromptState{asked: true, needsReminder: true}, state)
+
+	state = askForTeamState([]*github.IssueComment{asked}, teams, 9*24*time.Hour, now)
+	assert.Equal(t, teamPromptState{asked: true}, state)
+
+	state = askForTeamState([]*github.IssueComment{asked, comment(reminderMarker+"\nHey again!", 1)}, teams, week, now)
+	assert.Equal(t, teamPromptState{asked: true, reminded: true}, state)
+
+	state = askForTeamState([]*github.IssueComment{asked, comment("I think @jekyll/windows", 1)}, teams, week, now)
+	assert.Equal(t, teamPromptState{asked: true, teamMentioned: true}, state)
+
+	// Mentions before the bot asked don't count.
+	state = askForTeamState([]*github.IssueComment{comment("@jekyll/windows", 9), asked}, teams, week, now)
+	assert.Equal(t, teamPromptState{asked: true, needsReminder: true}, state)
+}
+
+func TestAskForAffinityTeam(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+	context.SetIssue("o", "r", 1)
+	context.SetAuthor("contributor")
+	teams := []Team{{ID: 141, Mention: "@jekyll/windows", Description: "Windows things"}}
+
+	existing := `[]`
+	commented, labeled := 0, 0
+	mux.HandleFunc("/repos/o/r/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			fmt.Fprint(w, existing)
+		case "POST":
+			comment := new(github.IssueComment)
+			json.NewDecoder(r.Body).Decode(comment)
+			assert.Contains(t, comment.GetBody(), askForTeamMarker)
+			assert.Contains(t, comment.GetBody(), "Hey, @contributor!")
+			assert.Contains(t, comment.GetBody(), "- `@jekyll/windows` – Windows things")
+			commented++
+			fmt.Fprint(w, `{}`)
+		}
+	})
+	mux.HandleFunc("/repos/o/r/issues/1/labels", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+		var labels []string
+		json.NewDecoder(r.Body).Decode(&labels)
+		assert.Equal(t, []string{NeedsTeamLabel}, labels)
+		labeled++
+		fmt.Fprint(w, `[]`)
+	})
+
+	assert.NoError(t, askForAffinityTeam(context, teams))
+	assert.Equal(t, 1, commented)
+	assert.Equal(t, 1, labeled)
+
+	existing = fmt.Sprintf(`[{"body":%q}]`, askForTeamMarker+"\nHey!")
+	assert.NoError(t, askForAffinityTeam(context, teams))
+	assert.Equal(t, 1, commented, "never asks twice")
+	assert.Equal(t, 1, labeled)
+}
+
+func TestAssignIssueToAffinityTeamCaptainFromCommentIgnoresOwnPrompt(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+	handler := &Handler{
+		repos: []Repo{{Owner: "o", Name: "r", AskForTeam: true}},
+		teams: []Team{{ID: 141, Mention: "@jekyll/windows"}},
+	}
+
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"login":"jekyllbot"}`)
+	})
+	unlabeled := false
+	mux.HandleFunc("/repos/o/r/issues/1/labels/"+NeedsTeamLabel, func(w http.ResponseWriter, r *http.Request) {
+		unlabeled = true
+		fmt.Fprint(w, `[]`)
+	})
+
+	err := handler.AssignIssueToAffinityTeamCaptainFromComment(context, &github.IssueCommentEvent{
+		Action:  github.String("created"),
+		Sender:  &github.User{Login: github.String("jekyllbot")},
+		Comment: &github.IssueComment{Body: github.String(askForTeamMarker + "\n- `@jekyll/windows`")},
+		Issue:   &github.Issue{Number: github.Int(1), Labels: []*github.Label{{Name: github.String(NeedsTeamLabel)}}},
+		Repo: &github.Repository{
+			Owner: &github.User{Login: github.String("o")},
+			Name:  github.String("r"),
+		},
+	})
+	assert.Error(t, err)
+	assert.False(t, unlabeled, "the bot's own prompt doesn't pick a team")
+}
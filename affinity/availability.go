@@ -0,0 +1,242 @@
+package affinity
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/ctx"
+)
+
+var (
+	unavailableCommentRegexp = regexp.MustCompile(`@[a-zA-Z-_]+: unavailable until (\d{4}-\d{2}-\d{2})`)
+	availableCommentRegexp   = regexp.MustCompile(`@[a-zA-Z-_]+: available\b`)
+
+	vacations = vacationMap{data: make(map[string]vacation)}
+)
+
+// vacation is a window during which a captain shouldn't be assigned
+// anything.
+type vacation struct {
+	From, Until time.Time
+}
+
+type vacationMap struct {
+	sync.RWMutex // protects 'data'
+	data         map[string]vacation
+}
+
+// SetVacation keeps the captain from being assigned anything between from
+// and until.
+func SetVacation(login string, from, until time.Time) {
+	vacations.Lock()
+	defer vacations.Unlock()
+	vacations.data[strings.ToLower(login)] = vacation{From: from, Until: until}
+}
+
+// ClearVacation makes the captain available again.
+func ClearVacation(login string) {
+	vacations.Lock()
+	defer vacations.Unlock()
+	delete(vacations.data, strings.ToLower(login))
+}
+
+func onVacation(login string, now time.Time) bool {
+	vacations.RLock()
+	defer vacations.RUnlock()
+	v, ok := vacations.data[strings.ToLower(login)]
+	return ok && !now.Before(v.From) && now.Before(v.Until)
+}
+
+// SetFallbackTeam sets the team whose captains are picked when every
+// captain on the mentioned team is unavailable.
+func (h *Handler) SetFallbackTeam(teamID int64) {
+	h.fallbackTeamID = teamID
+}
+
+// UnavailableCommandHandler handles "@jekyllbot: unavailable until
+// 2026-11-01" and "@jekyllbot: available" comments from captains, which set
+// and clear their own vacation.
+func (h *Handler) UnavailableCommandHandler(context *ctx.Context, payload interface{}) error {
+	event, ok := payload.(*github.IssueCommentEvent)
+	if !ok {
+		return context.NewError("UnavailableCommandHandler: not an issue comment event")
+	}
+
+	if event.GetAction() != "created" {
+		return context.NewError("UnavailableCommandHandler: comment action is %q, not created", event.GetAction())
+	}
+
+	owner, repo, number := *event.Repo.Owner.Login, *event.Repo.Name, *event.Issue.Number
+	context.SetIssue(owner, repo, number)
+
+	// Only comments on the enabled repos are read back by RestoreVacations.
+	if !h.enabledForRepo(owner, repo) {
+		return context.NewError("UnavailableCommandHandler: not enabled for %s", context.Issue)
+	}
+
+	login, body := event.Comment.User.GetLogin(), event.Comment.GetBody()
+	var reply string
+	if matches := unavailableCommentRegexp.FindStringSubmatch(body); matches != nil {
+		until, err := time.Parse("2006-01-02", matches[1])
+		if err != nil {
+			return context.NewError("UnavailableCommandHandler: %q isn't a date: %v", matches[1], err)
+		}
+		if !h.isCaptain(login) {
+			return context.NewError("UnavailableCommandHandler: %s isn't a team captain", login)
+		}
+		// Unavailable through the end of that day.
+		SetVacation(login, time.Now(), until.AddDate(0, 0, 1))
+		reply = fmt.Sprintf("Enjoy your time off, @%s! I'll try not to assign you anything until after %s.", login, matches[1])
+	} else if availableCommentRegexp.MatchString(body) {
+		if !h.isCaptain(login) {
+			return context.NewError("UnavailableCommandHandler: %s isn't a team captain", login)
+		}
+		ClearVacation(login)
+		reply = fmt.Sprintf("Welcome back, @%s! I'll start assigning you things again.", login)
+	} else {
+		return context.NewError("UnavailableCommandHandler: not an availability comment")
+	}
+
+	_, _, err := context.GitHub.Issues.CreateComment(context.Context(), owner, repo, number, &github.IssueComment{Body: github.String(reply)})
+	if err != nil {
+		return context.NewError("UnavailableCommandHandler: couldn't comment on %s: %v", context.Issue, err)
+	}
+	return nil
+}
+
+// RestoreVacations sets and clears vacations from the availability comments
+// left on the enabled repos since the given time, oldest first. Vacations
+// are only kept in memory, so this rebuilds them after a restart.
+func (h *Handler) RestoreVacations(context *ctx.Context, since time.Time) error {
+	comments := []*github.IssueComment{}
+	for _, repo := range h.repos {
+		opts := &github.IssueListCommentsOptions{
+			Sort:        github.String("created"),
+			Direction:   github.String("asc"),
+			Since:       &since,
+			ListOptions: github.ListOptions{PerPage: 100},
+		}
+		for {
+			page, resp, err := context.GitHub.Issues.ListComments(context.Context(), repo.Owner, repo.Name, 0, opts)
+			if err != nil {
+				return fmt.Errorf("RestoreVacations: couldn't list comments on %s/%s: %v", repo.Owner, repo.Name, err)
+			}
+			comments = append(comments, page...)
+			if resp.NextPage == 0 {
+				break
+			}
+			opts.ListOptions.Page = resp.NextPage
+		}
+	}
+
+	sort.SliceStable(comments, func(i, j int) bool {
+		return comments[i].GetCreatedAt().Before(comments[j].GetCreatedAt().Time)
+	})
+	// Unlike the command, this doesn't check who's a captain, so captains of
+	// teams which haven't loaded yet aren't missed. Nobody else's vacation
+	// has any effect.
+	for _, comment := range comments {
+		login, body := comment.GetUser().GetLogin(), comment.GetBody()
+		if matches := unavailableCommentRegexp.FindStringSubmatch(body); matches != nil {
+			if until, err := time.Parse("2006-01-02", matches[1]); err == nil {
+				SetVacation(login, comment.GetCreatedAt().Time, until.AddDate(0, 0, 1))
+			}
+		} else if availableCommentRegexp.MatchString(body) {
+			ClearVacation(login)
+		}
+	}
+	return nil
+}
+
+func (h *Handler) isCaptain(login string) bool {
+	for _, team := range h.GetTeams() {
+		for _, captain := range usersByLogin(team.Captains) {
+			if strings.EqualFold(captain, login) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// withAvailableCaptains returns the team with only the captains who aren't
+// on vacation and haven't set their GitHub status to busy. If the team has
+// nobody available, the fallback team is used instead.
+func (h *Handler) withAvailableCaptains(context *ctx.Context, team Team) Team {
+	available := team.availableCaptains(context)
+	if len(available.Captains) > 0 || h.fallbackTeamID == 0 || h.fallbackTeamID == team.ID {
+		return available
+	}
+
+	fallback, err := h.GetTeam(h.fallbackTeamID)
+	if err != nil {
+		context.Log("affinity: nobody on %s is available, and the fallback team is missing: %v", team.Mention, err)
+		return available
+	}
+	context.Log("affinity: nobody on %s is available, falling back to %s", team.Mention, fallback.Mention)
+	return fallback.availableCaptains(context)
+}
+
+func (t Team) availableCaptains(context *ctx.Context) Team {
+	busy, err := busyLogins(context, usersByLogin(t.Captains))
+	if err != nil {
+		context.Log("affinity: couldn't fetch the statuses of %s's captains: %v", t.Mention, err)
+	}
+	t.Captains = filterAvailable(t.Captains, busy, time.Now())
+	return t
+}
+
+// filterAvailable returns the captains who aren't busy or on vacation.
+func filterAvailable(captains []*github.User, busy map[string]bool, now time.Time) []*github.User {
+	available := []*github.User{}
+	for _, captain := range captains {
+		if !busy[captain.GetLogin()] && !onVacation(captain.GetLogin(), now) {
+			available = append(available, captain)
+		}
+	}
+	return available
+}
+
+// busyLogins returns the users who have set their GitHub status to busy.
+// Statuses are only available through the GraphQL API.
+func busyLogins(context *ctx.Context, logins []string) (map[string]bool, error) {
+	busy := map[string]bool{}
+	if len(logins) == 0 {
+		return busy, nil
+	}
+
+	fields := make([]string, len(logins))
+	for i, login := range logins {
+		fields[i] = fmt.Sprintf("u%d: user(login: %q) { status { indicatesLimitedAvailability } }", i, login)
+	}
+	req, err := context.GitHub.NewRequest("POST", "graphql", map[string]string{
+		"query": "query { " + strings.Join(fields, " ") + " }",
+	})
+	if err != nil {
+		return busy, err
+	}
+
+	var response struct {
+		Data map[string]*struct {
+			Status *struct {
+				IndicatesLimitedAvailability bool `json:"indicatesLimitedAvailability"`
+			} `json:"status"`
+		} `json:"data"`
+	}
+	if _, err := context.GitHub.Do(context.Context(), req, &response); err != nil {
+		return busy, err
+	}
+
+	for i, login := range logins {
+		user := response.Data[fmt.Sprintf("u%d", i)]
+		if user != nil && user.Status != nil && user.Status.IndicatesLimitedAvailability {
+			busy[login] = true
+		}
+	}
+	return busy, nil
+}
@@ -0,0 +1,77 @@
+package affinity
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnavailableCommentRegexp(t *testing.T) {
+	matches := unavailableCommentRegexp.FindStringSubmatch("@jekyllbot: unavailable until 2026-11-01")
+	if assert.NotNil(t, matches) {
+		assert.Equal(t, "2026-11-01", matches[1])
+	}
+	assert.Nil(t, unavailableCommentRegexp.FindStringSubmatch("@jekyllbot: unavailable until next week"))
+	assert.True(t, availableCommentRegexp.MatchString("@jekyllbot: available"))
+	assert.False(t, availableCommentRegexp.MatchString("@jekyllbot: availableish"))
+}
+
+func TestFilterAvailable(t *testing.T) {
+	now := time.Date(2026, time.October, 15, 12, 0, 0, 0, time.UTC)
+	captains := []*github.User{
+		{Login: github.String("parkr")},
+		{Login: github.String("envygeeks")},
+		{Login: github.String("mattr-")},
+		{Login: github.String("ashmaroli")},
+	}
+
+	SetVacation("EnvyGeeks", now.Add(-time.Hour), now.Add(24*time.Hour))
+	SetVacation("ashmaroli", now.Add(time.Hour), now.Add(24*time.Hour)) // not yet
+	defer ClearVacation("envygeeks")
+	defer ClearVacation("ashmaroli")
+
+	available := filterAvailable(captains, map[string]bool{"mattr-": true}, now)
+	assert.Equal(t, []string{"parkr", "ashmaroli"}, usersByLogin(available))
+
+	ClearVacation("envygeeks")
+	available = filterAvailable(captains, nil, now.Add(2*time.Hour))
+	assert.Equal(t, []string{"parkr", "envygeeks", "mattr-"}, usersByLogin(available))
+}
+
+func TestHandlerIsCaptain(t *testing.T) {
+	handler := Handler{teams: []Team{{Captains: []*github.User{{Login: github.String("parkr")}}}}}
+	assert.True(t, handler.isCaptain("Parkr"))
+	assert.False(t, handler.isCaptain("someone"))
+}
+
+func TestRestoreVacations(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+	handler := &Handler{repos: []Repo{{Owner: "o", Name: "r"}}}
+	defer ClearVacation("parkr")
+	defer ClearVacation("envygeeks")
+
+	mux.HandleFunc("/repos/o/r/issues/comments", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		assert.Equal(t, "2026-07-01T00:00:00Z", r.URL.Query().Get("since"))
+		fmt.Fprint(w, `[
+			{"body":"@jekyllbot: unavailable until 2099-01-31","user":{"login":"envygeeks"},"created_at":"2026-10-03T00:00:00Z"},
+			{"body":"@jekyllbot: unavailable until 2099-01-31","user":{"login":"parkr"},"created_at":"2026-10-01T00:00:00Z"},
+			{"body":"@jekyllbot: available","user":{"login":"envygeeks"},"created_at":"2026-10-04T00:00:00Z"},
+			{"body":"Thanks!","user":{"login":"mattr-"},"created_at":"2026-10-05T00:00:00Z"}
+		]`)
+	})
+
+	assert.NoError(t, handler.RestoreVacations(context, time.Date(2026, time.July, 1, 0, 0, 0, 0, time.UTC)))
+	now := time.Date(2026, time.October, 15, 12, 0, 0, 0, time.UTC)
+	assert.True(t, onVacation("parkr", now))
+	assert.True(t, onVacation("parkr", time.Date(2099, time.January, 31, 23, 0, 0, 0, time.UTC)), "through the end of the day")
+	assert.False(t, onVacation("parkr", time.Date(2026, time.September, 30, 0, 0, 0, 0, time.UTC)))
+	assert.False(t, onVacation("envygeeks", now), "came back since")
+}
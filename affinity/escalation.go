@@ -0,0 +1,329 @@
+package affinity
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/ctx"
+)
+
+// defaultEscalationSLA is how long a captain has to respond when the
+// handler doesn't say otherwise.
+const defaultEscalationSLA = 7 * 24 * time.Hour
+
+const (
+	escalationPing     = "ping"
+	escalationReassign = "reassign"
+)
+
+// SetEscalationSLA sets how long an assigned captain has to comment, review
+// or change labels before being pinged, and how long after the ping before
+// the issue is reassigned. Defaults to a week.
+func (h *Handler) SetEscalationSLA(sla time.Duration) {
+	h.escalationSLA = sla
+}
+
+// StartEscalating checks for captains who haven't responded every interval
+// in the background.
+func (h *Handler) StartEscalating(context *ctx.Context, interval time.Duration) {
+	go func() {
+		for {
+			time.Sleep(interval)
+			if err := h.EscalateUnresponsiveCaptains(context); err != nil {
+				context.Log("affinity: %v", err)
+			}
+		}
+	}()
+}
+
+// EscalateUnresponsiveCaptains looks at the open issues and PRs in the
+// enabled repos which the bot assigned to a captain. If the captain hasn't
+// commented, reviewed or changed labels within the SLA, they're pinged. If
+// they still haven't within the SLA after that, the issue is reassigned to
+// another captain from the same team.
+func (h *Handler) EscalateUnresponsiveCaptains(context *ctx.Context) error {
+	bot := context.CurrentlyAuthedGitHubUser().GetLogin()
+	if bot == "" {
+		return fmt.Errorf("EscalateUnresponsiveCaptains: couldn't tell who the bot is")
+	}
+
+	sla := h.escalationSLA
+	if sla <= 0 {
+		sla = defaultEscalationSLA
+	}
+
+	for _, repo := range h.repos {
+		issues, err := assignedIssues(context, repo)
+		if err != nil {
+			return fmt.Errorf("EscalateUnresponsiveCaptains: couldn't list issues for %s/%s: %v", repo.Owner, repo.Name, err)
+		}
+
+		for _, issue := range issues {
+			activity, err := fetchIssueActivity(context, repo, issue)
+			if err != nil {
+				context.Log("EscalateUnresponsiveCaptains: couldn't fetch activity on %s/%s#%d: %v", repo.Owner, repo.Name, issue.GetNumber(), err)
+				continue
+			}
+
+			for captain, assignedAt := range activity.assignedBy(bot) {
+				if !isAssigned(issue, captain) {
+					continue
+				}
+				action := escalationAction(assignedAt, activity.lastEngagement(captain), activity.pingedAt(bot, captain), sla, time.Now())
+				switch action {
+				case escalationPing:
+					err = pingCaptain(context, repo, issue, captain, assignedAt)
+				case escalationReassign:
+					err = h.reassignCaptain(context, repo, issue, captain)
+				default:
+					continue
+				}
+				if err != nil {
+					context.Log("EscalateUnresponsiveCaptains: couldn't %s @%s on %s/%s#%d: %v", action, captain, repo.Owner, repo.Name, issue.GetNumber(), err)
+					continue
+				}
+				context.IncrStat("affinity.escalated", []string{"action:" + action})
+				context.Log("EscalateUnresponsiveCaptains: did %s for @%s on %s/%s#%d", action, captain, repo.Owner, repo.Name, issue.GetNumber())
+			}
+		}
+	}
+	return nil
+}
+
+// escalationAction decides what to do about a captain assigned at
+// assignedAt: nothing, ping them, or reassign the issue.
+func escalationAction(assignedAt, lastEngagement, pingedAt time.Time, sla time.Duration, now time.Time) string {
+	if lastEngagement.After(assignedAt) {
+		return ""
+	}
+	if pingedAt.IsZero() {
+		if now.Sub(assignedAt) >= sla {
+			return escalationPing
+		}
+		return ""
+	}
+	if now.Sub(pingedAt) >= sla {
+		return escalationReassign
+	}
+	return ""
+}
+
+func pingMarker(captain string) string {
+	return fmt.Sprintf("<!-- affinity:escalation-ping @%s -->", captain)
+}
+
+func pingCaptain(context *ctx.Context, repo Repo, issue *github.Issue, captain string, assignedAt time.Time) error {
+	days := int(time.Since(assignedAt).Hours() / 24)
+	body := fmt.Sprintf("%s\nHey @%s, friendly ping! You were assigned this %d days ago as a team captain. Could you take a look? If you can't, I'll find another captain soon.",
+		pingMarker(captain), captain, days)
+	_, _, err := context.GitHub.Issues.CreateComment(context.Context(), repo.Owner, repo.Name, issue.GetNumber(), &github.IssueComment{Body: github.String(body)})
+	return err
+}
+
+// reassignCaptain swaps the captain for another available captain from the
+// same team.
+func (h *Handler) reassignCaptain(context *ctx.Context, repo Repo, issue *github.Issue, captain string) error {
+	team, ok := h.teamForCaptain(issue, captain)
+	if !ok {
+		return fmt.Errorf("@%s isn't on any team", captain)
+	}
+
+	excluded := []string{captain}
+	for _, assignee := range issue.Assignees {
+		excluded = append(excluded, assignee.GetLogin())
+	}
+	replacements := h.selectCaptains(context, withoutCaptains(team, excluded), issue.GetUser().GetLogin(), 1)
+	if len(replacements) == 0 {
+		return fmt.Errorf("nobody else on %s is available", team.Mention)
+	}
+
+	_, _, err := context.GitHub.Issues.RemoveAssignees(context.Context(), repo.Owner, repo.Name, issue.GetNumber(), []string{captain})
+	if err != nil {
+		return err
+	}
+	_, _, err = context.GitHub.Issues.AddAssignees(context.Context(), repo.Owner, repo.Name, issue.GetNumber(), replacements)
+	if err != nil {
+		return err
+	}
+	recentAssignments.add(replacements, time.Now())
+
+	body := fmt.Sprintf("I haven't heard from @%s, so I've asked @%s from %s to take over. Thanks!", captain, replacements[0], team.Mention)
+	_, _, err = context.GitHub.Issues.CreateComment(context.Context(), repo.Owner, repo.Name, issue.GetNumber(), &github.IssueComment{Body: github.String(body)})
+	return err
+}
+
+// teamForCaptain returns the captain's team, preferring a team the issue
+// mentions or is labeled for.
+func (h *Handler) teamForCaptain(issue *github.Issue, captain string) (Team, bool) {
+	teams := append(h.teamsFor(issue.GetBody(), issue.Labels), h.GetTeams()...)
+	for _, team := range teams {
+		for _, login := range usersByLogin(team.Captains) {
+			if strings.EqualFold(login, captain) {
+				return team, true
+			}
+		}
+	}
+	return Team{}, false
+}
+
+func isAssigned(issue *github.Issue, login string) bool {
+	for _, assignee := range issue.Assignees {
+		if strings.EqualFold(assignee.GetLogin(), login) {
+			return true
+		}
+	}
+	return false
+}
+
+// issueActivity is everything that happened on an issue or PR.
+type issueActivity struct {
+	comments []*github.IssueComment
+	events   []*github.IssueEvent
+	reviews  []*github.PullRequestReview
+}
+
+// assignedBy returns when the given user last assigned each assignee.
+func (a issueActivity) assignedBy(actor string) map[string]time.Time {
+	assigned := map[string]time.Time{}
+	for _, event := range a.assignmentsBy(actor) {
+		login := event.GetAssignee().GetLogin()
+		if at := event.GetCreatedAt().Time; at.After(assigned[login]) {
+			assigned[login] = at
+		}
+	}
+	return assigned
+}
+
+// assignmentsBy returns every "assigned" event by the given user.
+func (a issueActivity) assignmentsBy(actor string) []*github.IssueEvent {
+	assignments := []*github.IssueEvent{}
+	for _, event := range a.events {
+		if event.GetEvent() == "assigned" && strings.EqualFold(event.GetActor().GetLogin(), actor) {
+			assignments = append(assignments, event)
+		}
+	}
+	return assignments
+}
+
+// lastEngagement returns when the user last commented, reviewed or changed
+// labels.
+func (a issueActivity) lastEngagement(login string) time.Time {
+	var last time.Time
+	for _, at := range a.engagements(login) {
+		if at.After(last) {
+			last = at
+		}
+	}
+	return last
+}
+
+// firstEngagementAfter returns when the user first commented, reviewed or
+// changed labels after the given time, or the zero time.
+func (a issueActivity) firstEngagementAfter(login string, after time.Time) time.Time {
+	var first time.Time
+	for _, at := range a.engagements(login) {
+		if at.After(after) && (first.IsZero() || at.Before(first)) {
+			first = at
+		}
+	}
+	return first
+}
+
+// engagements returns when the user commented, reviewed or changed labels.
+func (a issueActivity) engagements(login string) []time.Time {
+	times := []time.Time{}
+	seen := func(who string, at time.Time) {
+		if strings.EqualFold(who, login) {
+			times = append(times, at)
+		}
+	}
+	for _, comment := range a.comments {
+		seen(comment.GetUser().GetLogin(), comment.GetCreatedAt().Time)
+	}
+	for _, event := range a.events {
+		if event.GetEvent() == "labeled" || event.GetEvent() == "unlabeled" {
+			seen(event.GetActor().GetLogin(), event.GetCreatedAt().Time)
+		}
+	}
+	for _, review := range a.reviews {
+		seen(review.GetUser().GetLogin(), review.GetSubmittedAt().Time)
+	}
+	return times
+}
+
+// pingedAt returns when the bot last pinged the captain, or the zero time.
+func (a issueActivity) pingedAt(bot, captain string) time.Time {
+	var pinged time.Time
+	for _, comment := range a.comments {
+		if strings.EqualFold(comment.GetUser().GetLogin(), bot) && strings.Contains(comment.GetBody(), pingMarker(captain)) {
+			if at := comment.GetCreatedAt().Time; at.After(pinged) {
+				pinged = at
+			}
+		}
+	}
+	return pinged
+}
+
+func fetchIssueActivity(context *ctx.Context, repo Repo, issue *github.Issue) (issueActivity, error) {
+	activity := issueActivity{}
+	var err error
+	activity.comments, err = issueComments(context, repo.Owner, repo.Name, issue.GetNumber())
+	if err != nil {
+		return activity, err
+	}
+
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		events, resp, err := context.GitHub.Issues.ListIssueEvents(context.Context(), repo.Owner, repo.Name, issue.GetNumber(), opts)
+		if err != nil {
+			return activity, err
+		}
+		activity.events = append(activity.events, events...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	if !issue.IsPullRequest() {
+		return activity, nil
+	}
+	opts = &github.ListOptions{PerPage: 100}
+	for {
+		reviews, resp, err := context.GitHub.PullRequests.ListReviews(context.Context(), repo.Owner, repo.Name, issue.GetNumber(), opts)
+		if err != nil {
+			return activity, err
+		}
+		activity.reviews = append(activity.reviews, reviews...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return activity, nil
+}
+
+// assignedIssues returns the open issues and PRs in the repo which are
+// assigned to somebody.
+func assignedIssues(context *ctx.Context, repo Repo) ([]*github.Issue, error) {
+	var issues []*github.Issue
+	opts := &github.IssueListByRepoOptions{
+		State:       "open",
+		Assignee:    "*",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		page, resp, err := context.GitHub.Issues.ListByRepo(context.Context(), repo.Owner, repo.Name, opts)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.ListOptions.Page = resp.NextPage
+	}
+	return issues, nil
+}
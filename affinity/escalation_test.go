@@ -0,0 +1,117 @@
+package affinity
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEscalationAction(t *testing.T) {
+	now := time.Date(2026, time.October, 15, 12, 0, 0, 0, time.UTC)
+	week := 7 * 24 * time.Hour
+	daysAgo := func(days int) time.Time { return now.AddDate(0, 0, -days) }
+	never := time.Time{}
+
+	cases := []struct {
+		assignedAt, lastEngagement, pingedAt time.Time
+		action                               string
+	}{
+		{daysAgo(3), never, never, ""},
+		{daysAgo(8), never, never, escalationPing},
+		{daysAgo(8), daysAgo(9), never, escalationPing},
+		{daysAgo(8), daysAgo(2), never, ""},
+		{daysAgo(10), never, daysAgo(3), ""},
+		{daysAgo(20), never, daysAgo(8), escalationReassign},
+		{daysAgo(20), daysAgo(1), daysAgo(8), ""},
+	}
+	for i, c := range cases {
+		assert.Equal(t, c.action, escalationAction(c.assignedAt, c.lastEngagement, c.pingedAt, week, now), "case %d", i)
+	}
+}
+
+func TestIssueActivity(t *testing.T) {
+	at := func(day int) *github.Timestamp {
+		return &github.Timestamp{Time: time.Date(2026, time.October, day, 0, 0, 0, 0, time.UTC)}
+	}
+	user := func(login string) *github.User { return &github.User{Login: github.String(login)} }
+	activity := issueActivity{
+		events: []*github.IssueEvent{
+			{Event: github.String("assigned"), Actor: user("jekyllbot"), Assignee: user("parkr"), CreatedAt: at(1)},
+			{Event: github.String("assigned"), Actor: user("someone"), Assignee: user("envygeeks"), CreatedAt: at(2)},
+			{Event: github.String("assigned"), Actor: user("jekyllbot"), Assignee: user("parkr"), CreatedAt: at(3)},
+			{Event: github.String("labeled"), Actor: user("envygeeks"), CreatedAt: at(4)},
+		},
+		comments: []*github.IssueComment{
+			{User: user("parkr"), CreatedAt: at(2)},
+			{User: user("jekyllbot"), Body: github.String(pingMarker("parkr") + "\nHey"), CreatedAt: at(10)},
+			{User: user("someone"), Body: github.String(pingMarker("envygeeks")), CreatedAt: at(11)},
+		},
+		reviews: []*github.PullRequestReview{
+			{User: user("mattr-"), SubmittedAt: at(5)},
+		},
+	}
+
+	assert.Equal(t, map[string]time.Time{"parkr": at(3).Time}, activity.assignedBy("jekyllbot"))
+	assert.Equal(t, at(2).Time, activity.lastEngagement("parkr"))
+	assert.Equal(t, at(4).Time, activity.lastEngagement("envygeeks"))
+	assert.Equal(t, at(5).Time, activity.lastEngagement("mattr-"))
+	assert.Equal(t, at(10).Time, activity.pingedAt("jekyllbot", "parkr"))
+	assert.True(t, activity.pingedAt("jekyllbot", "envygeeks").IsZero(), "only the bot's pings count")
+}
+
+func TestEscalateUnresponsiveCaptains(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"login":"jekyllbot"}`)
+	})
+	mux.HandleFunc("/repos/o/r/issues", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "*", r.URL.Query().Get("assignee"))
+		fmt.Fprint(w, `[{"number":1,"body":"@o/docs","user":{"login":"author"},"assignees":[{"login":"parkr"}]}]`)
+	})
+	assignedAt := time.Now().AddDate(0, 0, -20).Format(time.RFC3339)
+	pingedAt := time.Now().AddDate(0, 0, -10).Format(time.RFC3339)
+	mux.HandleFunc("/repos/o/r/issues/1/events", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"event":"assigned","actor":{"login":"jekyllbot"},"assignee":{"login":"parkr"},"created_at":%q}]`, assignedAt)
+	})
+	var actions []string
+	mux.HandleFunc("/repos/o/r/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			fmt.Fprintf(w, `[{"user":{"login":"jekyllbot"},"body":%q,"created_at":%q}]`, pingMarker("parkr"), pingedAt)
+		case "POST":
+			comment := new(github.IssueComment)
+			json.NewDecoder(r.Body).Decode(comment)
+			assert.Equal(t, "I haven't heard from @parkr, so I've asked @envygeeks from @o/docs to take over. Thanks!", comment.GetBody())
+			actions = append(actions, "comment")
+			fmt.Fprint(w, `{}`)
+		}
+	})
+	mux.HandleFunc("/repos/o/r/issues/1/assignees", func(w http.ResponseWriter, r *http.Request) {
+		var assignees struct{ Assignees []string }
+		json.NewDecoder(r.Body).Decode(&assignees)
+		actions = append(actions, fmt.Sprintf("%s %v", r.Method, assignees.Assignees))
+		fmt.Fprint(w, `{}`)
+	})
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data":{}}`)
+	})
+
+	handler := &Handler{teams: []Team{{ID: 1, Mention: "@o/docs", Captains: []*github.User{
+		{Login: github.String("parkr")},
+		{Login: github.String("author")},
+		{Login: github.String("envygeeks")},
+	}}}}
+	handler.AddRepo("o", "r")
+
+	assert.NoError(t, handler.EscalateUnresponsiveCaptains(context))
+	assert.Equal(t, []string{"DELETE [parkr]", "POST [envygeeks]", "comment"}, actions)
+}
@@ -2,14 +2,34 @@ package affinity
 
 import (
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/google/go-github/v73/github"
 	"github.com/jekyll/jekyllbot/ctx"
+	"github.com/jekyll/jekyllbot/labeler"
 )
 
 type Handler struct {
 	repos []Repo
-	teams []Team
+
+	sync.RWMutex // protects 'teams' and 'teamRefs'
+	teams        []Team
+	// Every team added, whether or not it could be fetched.
+	teamRefs []teamRef
+
+	strategy SelectionStrategy
+
+	fallbackTeamID int64
+
+	// Labels which route to a team, by lowercased name. Protected by the
+	// mutex.
+	teamLabels map[string]int64
+	// How many teams' captains to assign at most.
+	maxTeams int
+
+	// How long captains have to respond before being escalated.
+	escalationSLA time.Duration
 }
 
 func (h *Handler) enabledForRepo(owner, name string) bool {
@@ -39,28 +59,31 @@ func (h *Handler) AddRepo(owner, name string) {
 }
 
 func (h *Handler) GetTeams() []Team {
-	return h.teams
+	h.RLock()
+	defer h.RUnlock()
+	return append([]Team{}, h.teams...)
 }
 
+// AddTeam adds the team and fetches its metadata and captains. If they
+// can't be fetched, the error is returned and the team is fetched again on
+// the next refresh.
 func (h *Handler) AddTeam(context *ctx.Context, orgID, teamID int64) error {
-	if h.teams == nil {
-		h.teams = []Team{}
+	h.Lock()
+	if !h.hasTeamRefLocked(teamID) {
+		h.teamRefs = append(h.teamRefs, teamRef{OrgID: orgID, ID: teamID})
 	}
+	h.Unlock()
 
 	if _, err := h.GetTeam(teamID); err == nil {
 		return nil // already have it!
 	}
 
-	team, err := NewTeam(context, orgID, teamID)
-	if err != nil {
-		return err
-	}
-
-	h.teams = append(h.teams, team)
-	return nil
+	return h.refreshTeam(context, teamRef{OrgID: orgID, ID: teamID})
 }
 
 func (h *Handler) GetTeam(teamID int64) (Team, error) {
+	h.RLock()
+	defer h.RUnlock()
 	for _, team := range h.teams {
 		if team.ID == teamID {
 			return team, nil
@@ -82,13 +105,37 @@ func (h *Handler) RequestReviewFromAffinityTeamCaptains(context *ctx.Context, pa
 		return context.NewError("RequestReviewFromAffinityTeamCaptains: not enabled for %s", context.Issue)
 	}
 
-	if *event.Action != "opened" {
-		return context.NewError("RequestReviewFromAffinityTeamCaptains: not an 'opened' PR event")
+	var teams []Team
+	switch *event.Action {
+	case "opened":
+		teams = h.teamsFor(event.PullRequest.GetBody(), event.PullRequest.Labels)
+	case "labeled":
+		// chlog labels PRs as it merges them, and maintainers relabel old
+		// ones; neither should pull captains in for a review.
+		if context.GitHubAuthedAs(*event.Sender.Login) {
+			return context.NewError("RequestReviewFromAffinityTeamCaptains: labeled by the bot")
+		}
+		if event.PullRequest.GetState() != "open" {
+			return context.NewError("RequestReviewFromAffinityTeamCaptains: %s isn't open", context.Issue)
+		}
+		teams = h.teamsForLabels([]*github.Label{event.Label})
+		if len(teams) == 0 {
+			return context.NewError("RequestReviewFromAffinityTeamCaptains: label doesn't route to a team")
+		}
+		staffed, err := staffedLogins(context, true)
+		if err != nil {
+			return context.NewError("RequestReviewFromAffinityTeamCaptains: couldn't fetch %s: %v", context.Issue, err)
+		}
+		if teams = withoutStaffedTeams(teams, staffed); len(teams) == 0 {
+			return context.NewError("RequestReviewFromAffinityTeamCaptains: a captain of the labeled team is already on %s", context.Issue)
+		}
+	default:
+		return context.NewError("RequestReviewFromAffinityTeamCaptains: not an 'opened' or 'labeled' PR event")
 	}
 
 	context.IncrStat("affinity.pull_request", []string{"task:request_review"})
 
-	return requestReviewFromTeamCaptains(context, *h, *event.PullRequest.Body, 2)
+	return requestReviewFromTeamCaptains(context, h, teams, 2)
 }
 
 func (h *Handler) AssignPRToAffinityTeamCaptain(context *ctx.Context, payload interface{}) error {
@@ -104,13 +151,32 @@ func (h *Handler) AssignPRToAffinityTeamCaptain(context *ctx.Context, payload in
 		return context.NewError("AssignPRToAffinityTeamCaptain: not enabled for %s", context.Issue)
 	}
 
-	if *event.Action != "opened" {
-		return context.NewError("AssignPRToAffinityTeamCaptain: not an 'opened' PR event")
-	}
-
-	if event.PullRequest.Assignee != nil {
-		context.IncrStat("affinity.error.already_assigned", nil)
-		return context.NewError("AssignPRToAffinityTeamCaptain: PR already assigned")
+	var teams []Team
+	switch *event.Action {
+	case "opened":
+		teams = h.teamsFor(event.PullRequest.GetBody(), event.PullRequest.Labels)
+		if event.PullRequest.Assignee != nil {
+			context.IncrStat("affinity.error.already_assigned", nil)
+			return context.NewError("AssignPRToAffinityTeamCaptain: PR already assigned")
+		}
+	case "labeled":
+		if event.PullRequest.GetState() != "open" {
+			return context.NewError("AssignPRToAffinityTeamCaptain: %s isn't open", context.Issue)
+		}
+		teams = h.teamsForLabels([]*github.Label{event.Label})
+		if len(teams) == 0 {
+			return context.NewError("AssignPRToAffinityTeamCaptain: label doesn't route to a team")
+		}
+		staffed, err := staffedLogins(context, false)
+		if err != nil {
+			return context.NewError("AssignPRToAffinityTeamCaptain: couldn't fetch %s: %v", context.Issue, err)
+		}
+		if teams = withoutStaffedTeams(teams, staffed); len(teams) == 0 {
+			context.IncrStat("affinity.error.already_assigned", nil)
+			return context.NewError("AssignPRToAffinityTeamCaptain: a captain of the labeled team is already assigned to %s", context.Issue)
+		}
+	default:
+		return context.NewError("AssignPRToAffinityTeamCaptain: not an 'opened' or 'labeled' PR event")
 	}
 
 	if context.GitHubAuthedAs(*event.Sender.Login) {
@@ -119,7 +185,11 @@ func (h *Handler) AssignPRToAffinityTeamCaptain(context *ctx.Context, payload in
 
 	context.IncrStat("affinity.pull_request", nil)
 
-	return assignTeamCaptains(context, *h, *event.PullRequest.Body, 1)
+	if len(teams) == 0 && h.asksForTeam(context.Issue.Owner, context.Issue.Repo) {
+		return askForAffinityTeam(context, h.GetTeams())
+	}
+
+	return assignTeamCaptains(context, h, teams, 1)
 }
 
 func (h *Handler) AssignIssueToAffinityTeamCaptain(context *ctx.Context, payload interface{}) error {
@@ -135,13 +205,37 @@ func (h *Handler) AssignIssueToAffinityTeamCaptain(context *ctx.Context, payload
 		return context.NewError("AssignIssueToAffinityTeamCaptain: not enabled for %s", context.Issue)
 	}
 
-	if *event.Action != "opened" {
-		return context.NewError("AssignIssueToAffinityTeamCaptain: not an 'opened' issue event")
-	}
-
-	if event.Assignee != nil {
-		context.IncrStat("affinity.error.already_assigned", nil)
-		return context.NewError("AssignIssueToAffinityTeamCaptain: issue already assigned")
+	var teams []Team
+	switch *event.Action {
+	case "opened":
+		teams = h.teamsFor(event.Issue.GetBody(), event.Issue.Labels)
+		if event.Issue.Assignee != nil {
+			context.IncrStat("affinity.error.already_assigned", nil)
+			return context.NewError("AssignIssueToAffinityTeamCaptain: issue already assigned")
+		}
+	case "labeled":
+		if event.Issue.GetState() != "open" {
+			return context.NewError("AssignIssueToAffinityTeamCaptain: %s isn't open", context.Issue)
+		}
+		teams = h.teamsForLabels([]*github.Label{event.Label})
+		if len(teams) == 0 {
+			return context.NewError("AssignIssueToAffinityTeamCaptain: label doesn't route to a team")
+		}
+		if hasLabel(event.Issue.Labels, NeedsTeamLabel) {
+			if err := labeler.RemoveLabel(context, context.Issue.Owner, context.Issue.Repo, context.Issue.Num, NeedsTeamLabel); err != nil {
+				context.Log("AssignIssueToAffinityTeamCaptain: couldn't remove %s label from %s: %v", NeedsTeamLabel, context.Issue, err)
+			}
+		}
+		staffed, err := staffedLogins(context, false)
+		if err != nil {
+			return context.NewError("AssignIssueToAffinityTeamCaptain: couldn't fetch %s: %v", context.Issue, err)
+		}
+		if teams = withoutStaffedTeams(teams, staffed); len(teams) == 0 {
+			context.IncrStat("affinity.error.already_assigned", nil)
+			return context.NewError("AssignIssueToAffinityTeamCaptain: a captain of the labeled team is already assigned to %s", context.Issue)
+		}
+	default:
+		return context.NewError("AssignIssueToAffinityTeamCaptain: not an 'opened' or 'labeled' issue event")
 	}
 
 	if context.GitHubAuthedAs(*event.Sender.Login) {
@@ -150,7 +244,11 @@ func (h *Handler) AssignIssueToAffinityTeamCaptain(context *ctx.Context, payload
 
 	context.IncrStat("affinity.issue", nil)
 
-	return assignTeamCaptains(context, *h, *event.Issue.Body, 1)
+	if len(teams) == 0 && h.asksForTeam(context.Issue.Owner, context.Issue.Repo) {
+		return askForAffinityTeam(context, h.GetTeams())
+	}
+
+	return assignTeamCaptains(context, h, teams, 1)
 }
 
 func (h *Handler) AssignIssueToAffinityTeamCaptainFromComment(context *ctx.Context, payload interface{}) error {
@@ -170,15 +268,42 @@ func (h *Handler) AssignIssueToAffinityTeamCaptainFromComment(context *ctx.Conte
 		return context.NewError("AssignIssueToAffinityTeamCaptainFromComment: deleted issue comment event")
 	}
 
-	if event.Issue.Assignee != nil {
-		return context.NewError("AssignIssueToAffinityTeamCaptainFromComment: issue already assigned")
-	}
-
+	// The bot's own prompt and reminder list every team, so they mustn't
+	// count as the author picking one.
 	if context.GitHubAuthedAs(*event.Sender.Login) {
 		return fmt.Errorf("bozo. you can't reply to your own comment!")
 	}
 
+	if hasLabel(event.Issue.Labels, NeedsTeamLabel) && mentionsTeam(event.Comment.GetBody(), h.GetTeams()) {
+		if err := labeler.RemoveLabel(context, context.Issue.Owner, context.Issue.Repo, context.Issue.Num, NeedsTeamLabel); err != nil {
+			context.Log("AssignIssueToAffinityTeamCaptainFromComment: couldn't remove %s label from %s: %v", NeedsTeamLabel, context.Issue, err)
+		}
+	}
+
+	if event.Issue.Assignee != nil {
+		return context.NewError("AssignIssueToAffinityTeamCaptainFromComment: issue already assigned")
+	}
+
 	context.IncrStat("affinity.issue_comment", nil)
 
-	return assignTeamCaptains(context, *h, *event.Comment.Body, 1)
+	return assignTeamCaptains(context, h, h.teamsFor(event.Comment.GetBody(), nil), 1)
+}
+
+// staffedLogins returns who is assigned to the issue or PR in the context,
+// and for PRs who has been asked to review it. It's fetched afresh, as the
+// "opened" event for the same issue may have just assigned someone.
+func staffedLogins(context *ctx.Context, pullRequest bool) ([]string, error) {
+	if !pullRequest {
+		issue, _, err := context.GitHub.Issues.Get(context.Context(), context.Issue.Owner, context.Issue.Repo, context.Issue.Num)
+		if err != nil {
+			return nil, err
+		}
+		return usersByLogin(issue.Assignees), nil
+	}
+
+	pr, _, err := context.GitHub.PullRequests.Get(context.Context(), context.Issue.Owner, context.Issue.Repo, context.Issue.Num)
+	if err != nil {
+		return nil, err
+	}
+	return append(usersByLogin(pr.Assignees), usersByLogin(pr.RequestedReviewers)...), nil
 }
@@ -0,0 +1,116 @@
+package affinity
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssignIssueToAffinityTeamCaptainLabeled(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+	handler := &Handler{
+		repos: []Repo{{Owner: "o", Name: "r"}},
+		teams: []Team{
+			{ID: 141, Mention: "@jekyll/windows", Captains: []*github.User{{Login: github.String("parkr")}}},
+			{ID: 456, Mention: "@jekyll/documentation", Captains: []*github.User{{Login: github.String("mattr-")}}},
+		},
+	}
+	handler.AddTeamLabel("windows", 141)
+	handler.AddTeamLabel("documentation", 456)
+
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"login":"jekyllbot"}`)
+	})
+	mux.HandleFunc("/repos/o/r/issues/1", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		fmt.Fprint(w, `{"number":1,"assignees":[{"login":"parkr"}]}`)
+	})
+	assigned := []string{}
+	mux.HandleFunc("/repos/o/r/issues/1/assignees", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+		assigned = append(assigned, "assigned")
+		fmt.Fprint(w, `{}`)
+	})
+
+	labeled := func(label string) *github.IssuesEvent {
+		return &github.IssuesEvent{
+			Action: github.String("labeled"),
+			Label:  &github.Label{Name: github.String(label)},
+			Sender: &github.User{Login: github.String("contributor")},
+			Issue: &github.Issue{
+				Number:   github.Int(1),
+				State:    github.String("open"),
+				Assignee: &github.User{Login: github.String("parkr")},
+				Labels:   []*github.Label{{Name: github.String("windows")}, {Name: github.String(label)}},
+			},
+			Repo: &github.Repository{
+				Owner: &github.User{Login: github.String("o")},
+				Name:  github.String("r"),
+			},
+		}
+	}
+
+	err := handler.AssignIssueToAffinityTeamCaptain(context, labeled("windows"))
+	assert.EqualError(t, err, "AssignIssueToAffinityTeamCaptain: a captain of the labeled team is already assigned to o/r#1")
+	assert.Empty(t, assigned)
+
+	assert.NoError(t, handler.AssignIssueToAffinityTeamCaptain(context, labeled("documentation")))
+	assert.Len(t, assigned, 1, "only the newly labeled team's captain is assigned")
+}
+
+func TestRequestReviewFromAffinityTeamCaptainsLabeled(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+	handler := &Handler{
+		repos: []Repo{{Owner: "o", Name: "r"}},
+		teams: []Team{
+			{ID: 456, Mention: "@jekyll/documentation", Captains: []*github.User{{Login: github.String("mattr-")}}},
+		},
+	}
+	handler.AddTeamLabel("documentation", 456)
+
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"login":"jekyllbot"}`)
+	})
+	requested := []string{}
+	mux.HandleFunc("/repos/o/r/pulls/1/requested_reviewers", func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.Method)
+		fmt.Fprint(w, `{}`)
+	})
+
+	labeled := func(sender, state string) *github.PullRequestEvent {
+		return &github.PullRequestEvent{
+			Action: github.String("labeled"),
+			Number: github.Int(1),
+			Label:  &github.Label{Name: github.String("documentation")},
+			Sender: &github.User{Login: github.String(sender)},
+			PullRequest: &github.PullRequest{
+				Number: github.Int(1),
+				State:  github.String(state),
+				Labels: []*github.Label{{Name: github.String("documentation")}},
+			},
+			Repo: &github.Repository{
+				Owner: &github.User{Login: github.String("o")},
+				Name:  github.String("r"),
+			},
+		}
+	}
+
+	err := handler.RequestReviewFromAffinityTeamCaptains(context, labeled("jekyllbot", "open"))
+	assert.EqualError(t, err, "RequestReviewFromAffinityTeamCaptains: labeled by the bot")
+
+	err = handler.RequestReviewFromAffinityTeamCaptains(context, labeled("parkr", "closed"))
+	assert.EqualError(t, err, "RequestReviewFromAffinityTeamCaptains: o/r#1 isn't open")
+
+	err = handler.AssignPRToAffinityTeamCaptain(context, labeled("parkr", "closed"))
+	assert.EqualError(t, err, "AssignPRToAffinityTeamCaptain: o/r#1 isn't open")
+
+	assert.Empty(t, requested)
+}
@@ -0,0 +1,154 @@
+package affinity
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/ctx"
+)
+
+// retryInterval is how soon teams which couldn't be fetched are tried
+// again, rather than waiting for the next refresh.
+const retryInterval = time.Minute
+
+// teamRef identifies a team which was added to the handler.
+type teamRef struct {
+	OrgID, ID int64
+}
+
+// RosterEntry describes a team as the handler currently knows it.
+type RosterEntry struct {
+	ID       int64    `json:"id"`
+	Mention  string   `json:"mention"`
+	Name     string   `json:"name"`
+	Captains []string `json:"captains"`
+	// Whether the team has been fetched from GitHub at least once.
+	Loaded bool `json:"loaded"`
+}
+
+// Roster describes every team added to the handler and its captains, for
+// the admin surface.
+func (h *Handler) Roster() []RosterEntry {
+	h.RLock()
+	defer h.RUnlock()
+	roster := []RosterEntry{}
+	for _, ref := range h.teamRefs {
+		entry := RosterEntry{ID: ref.ID, Captains: []string{}}
+		for _, team := range h.teams {
+			if team.ID == ref.ID {
+				entry.Mention, entry.Name, entry.Loaded = team.Mention, team.Name, true
+				entry.Captains = usersByLogin(team.Captains)
+			}
+		}
+		roster = append(roster, entry)
+	}
+	return roster
+}
+
+// RefreshTeams fetches every team's metadata and captains again. A team
+// which can't be fetched keeps what was last fetched for it.
+func (h *Handler) RefreshTeams(context *ctx.Context) error {
+	h.RLock()
+	refs := append([]teamRef{}, h.teamRefs...)
+	h.RUnlock()
+
+	failures := []string{}
+	for _, ref := range refs {
+		if err := h.refreshTeam(context, ref); err != nil {
+			failures = append(failures, fmt.Sprintf("team %d: %v", ref.ID, err))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("RefreshTeams: %s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// StartRefreshingTeams refreshes the teams every interval in the
+// background. Until every team has been fetched, it retries sooner.
+func (h *Handler) StartRefreshingTeams(context *ctx.Context, interval time.Duration) {
+	go func() {
+		for {
+			wait := interval
+			if h.hasUnloadedTeams() && retryInterval < interval {
+				wait = retryInterval
+			}
+			time.Sleep(wait)
+
+			if err := h.RefreshTeams(context); err != nil {
+				context.Log("affinity: %v", err)
+			}
+		}
+	}()
+}
+
+// RefreshTeamHandler refreshes a team when its membership or settings
+// change, via "membership" and "team" events.
+func (h *Handler) RefreshTeamHandler(context *ctx.Context, payload interface{}) error {
+	var team *github.Team
+	switch event := payload.(type) {
+	case *github.MembershipEvent:
+		team = event.Team
+	case *github.TeamEvent:
+		team = event.Team
+	default:
+		return context.NewError("RefreshTeamHandler: not a membership or team event")
+	}
+
+	h.RLock()
+	var ref *teamRef
+	for _, candidate := range h.teamRefs {
+		if candidate.ID == team.GetID() {
+			ref = &teamRef{OrgID: candidate.OrgID, ID: candidate.ID}
+		}
+	}
+	h.RUnlock()
+
+	if ref == nil {
+		return context.NewError("RefreshTeamHandler: team %d isn't an affinity team", team.GetID())
+	}
+
+	if err := h.refreshTeam(context, *ref); err != nil {
+		return context.NewError("RefreshTeamHandler: couldn't refresh team %d: %v", ref.ID, err)
+	}
+	context.Log("RefreshTeamHandler: refreshed team %d", ref.ID)
+	return nil
+}
+
+// refreshTeam fetches the team and replaces what the handler knows of it.
+func (h *Handler) refreshTeam(context *ctx.Context, ref teamRef) error {
+	team, err := NewTeam(context, ref.OrgID, ref.ID)
+	if err != nil {
+		return err
+	}
+
+	h.Lock()
+	defer h.Unlock()
+	for i, existing := range h.teams {
+		if existing.ID == team.ID {
+			h.teams[i] = team
+			return nil
+		}
+	}
+	h.teams = append(h.teams, team)
+	return nil
+}
+
+func (h *Handler) hasUnloadedTeams() bool {
+	h.RLock()
+	defer h.RUnlock()
+	return len(h.teams) < len(h.teamRefs)
+}
+
+// hasTeamRefLocked returns true if the team has been added. The caller must
+// hold the lock.
+func (h *Handler) hasTeamRefLocked(teamID int64) bool {
+	for _, ref := range h.teamRefs {
+		if ref.ID == teamID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package affinity
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandlerRefreshTeams(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"login":"jekyllbot"}`)
+	})
+	githubDown := true
+	mux.HandleFunc("/organizations/1/team/2", func(w http.ResponseWriter, r *http.Request) {
+		if githubDown {
+			http.Error(w, `{"message":"Server Error"}`, http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, `{"id":2,"name":"Windows","slug":"windows","description":"Windows things","organization":{"login":"jekyll"}}`)
+	})
+	captains := `[{"login":"parkr"},{"login":"jekyllbot"}]`
+	mux.HandleFunc("/organizations/1/team/2/members", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "maintainer", r.URL.Query().Get("role"))
+		fmt.Fprint(w, captains)
+	})
+
+	handler := &Handler{}
+	assert.Error(t, handler.AddTeam(context, 1, 2))
+	assert.Empty(t, handler.GetTeams())
+	assert.True(t, handler.hasUnloadedTeams())
+	assert.Equal(t, []RosterEntry{{ID: 2, Captains: []string{}}}, handler.Roster())
+
+	githubDown = false
+	assert.NoError(t, handler.RefreshTeams(context))
+	assert.False(t, handler.hasUnloadedTeams())
+	assert.Equal(t, []RosterEntry{
+		{ID: 2, Mention: "@jekyll/windows", Name: "Windows", Captains: []string{"parkr"}, Loaded: true},
+	}, handler.Roster())
+
+	captains = `[{"login":"parkr"},{"login":"ashmaroli"}]`
+	assert.NoError(t, handler.RefreshTeamHandler(context, &github.MembershipEvent{Team: &github.Team{ID: github.Int64(2)}}))
+	assert.Equal(t, []string{"parkr", "ashmaroli"}, handler.Roster()[0].Captains)
+	assert.Len(t, handler.GetTeams(), 1)
+
+	githubDown = true
+	assert.Error(t, handler.RefreshTeams(context))
+	assert.Equal(t, []string{"parkr", "ashmaroli"}, handler.Roster()[0].Captains, "keeps the last roster")
+
+	assert.Error(t, handler.RefreshTeamHandler(context, &github.TeamEvent{Team: &github.Team{ID: github.Int64(3)}}))
+}
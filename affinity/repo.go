@@ -1,5 +1,11 @@
 package affinity
 
+import "time"
+
 type Repo struct {
 	Owner, Name string
+	// Whether to ask for a team on new issues and PRs which don't mention one.
+	AskForTeam bool
+	// How long to wait for a team before reminding the author.
+	RemindAfter time.Duration
 }
@@ -0,0 +1,298 @@
+package affinity
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/ctx"
+)
+
+// Report is how each team and captain did from Since up to, but not
+// including, Until.
+type Report struct {
+	Since time.Time    `json:"since"`
+	Until time.Time    `json:"until"`
+	Teams []TeamReport `json:"teams"`
+}
+
+// TeamReport is how a team's captains did.
+type TeamReport struct {
+	ID       int64           `json:"id"`
+	Mention  string          `json:"mention"`
+	Captains []CaptainReport `json:"captains"`
+}
+
+// CaptainReport is how a captain did.
+type CaptainReport struct {
+	Login string `json:"login"`
+	// Issues and PRs the bot assigned to the captain.
+	Assignments int `json:"assignments"`
+	// How long the captain took to first comment, review or change labels
+	// after being assigned, for the assignments they've responded to.
+	MedianTimeToFirstResponse time.Duration `json:"-"`
+	MedianFirstResponseHours  float64       `json:"median_first_response_hours"`
+	Responses                 int           `json:"responses"`
+	// Issues and PRs closed while assigned to the captain.
+	IssuesClosed int `json:"issues_closed"`
+	// PRs the captain submitted a review on.
+	PullRequestsReviewed int `json:"pull_requests_reviewed"`
+
+	firstResponses []time.Duration
+	reviewed       map[int]bool
+}
+
+// BuildReport gathers the report for the enabled repos between since and
+// until. Every captain of every team is listed, even those with nothing to
+// show for the period, along with anyone the bot assigned something who is
+// no longer a captain. It fails if any team added to the handler couldn't be
+// fetched, rather than quietly leaving the team out.
+func (h *Handler) BuildReport(context *ctx.Context, since, until time.Time) (*Report, error) {
+	unloaded := []string{}
+	for _, entry := range h.Roster() {
+		if !entry.Loaded {
+			unloaded = append(unloaded, fmt.Sprintf("%d", entry.ID))
+		}
+	}
+	if len(unloaded) > 0 {
+		return nil, fmt.Errorf("BuildReport: couldn't fetch teams %s", strings.Join(unloaded, ", "))
+	}
+
+	bot := context.CurrentlyAuthedGitHubUser().GetLogin()
+	if bot == "" {
+		return nil, fmt.Errorf("BuildReport: couldn't tell who the bot is")
+	}
+
+	report := newReport(h.GetTeams(), since, until)
+	for _, repo := range h.repos {
+		issues, err := issuesUpdatedSince(context, repo, since)
+		if err != nil {
+			return nil, fmt.Errorf("BuildReport: couldn't list issues for %s/%s: %v", repo.Owner, repo.Name, err)
+		}
+
+		for _, issue := range issues {
+			activity, err := fetchIssueActivity(context, repo, issue)
+			if err != nil {
+				return nil, fmt.Errorf("BuildReport: couldn't fetch activity on %s/%s#%d: %v", repo.Owner, repo.Name, issue.GetNumber(), err)
+			}
+			report.add(h, bot, issue, activity)
+		}
+	}
+	report.finish()
+	return report, nil
+}
+
+func newReport(teams []Team, since, until time.Time) *Report {
+	report := &Report{Since: since, Until: until, Teams: []TeamReport{}}
+	for _, team := range teams {
+		teamReport := TeamReport{ID: team.ID, Mention: team.Mention, Captains: []CaptainReport{}}
+		for _, login := range usersByLogin(team.Captains) {
+			teamReport.Captains = append(teamReport.Captains, CaptainReport{Login: login, reviewed: map[int]bool{}})
+		}
+		report.Teams = append(report.Teams, teamReport)
+	}
+	return report
+}
+
+// add counts what the captains did on the issue within the report's range.
+// Anyone the bot assigned the issue to is counted, even if they're no longer
+// a captain.
+func (r *Report) add(h *Handler, bot string, issue *github.Issue, activity issueActivity) {
+	assignedByBot := map[string]bool{}
+	for _, event := range activity.assignmentsBy(bot) {
+		captain, assignedAt := event.GetAssignee().GetLogin(), event.GetCreatedAt().Time
+		assignedByBot[strings.ToLower(captain)] = true
+		if !r.inRange(assignedAt) {
+			continue
+		}
+		report := r.captain(h, issue, captain, true)
+		report.Assignments++
+		if respondedAt := activity.firstEngagementAfter(captain, assignedAt); !respondedAt.IsZero() {
+			report.firstResponses = append(report.firstResponses, respondedAt.Sub(assignedAt))
+		}
+	}
+
+	if issue.ClosedAt != nil && r.inRange(issue.GetClosedAt().Time) {
+		for _, assignee := range issue.Assignees {
+			login := assignee.GetLogin()
+			if report := r.captain(h, issue, login, assignedByBot[strings.ToLower(login)]); report != nil {
+				report.IssuesClosed++
+			}
+		}
+	}
+
+	for _, review := range activity.reviews {
+		if !r.inRange(review.GetSubmittedAt().Time) {
+			continue
+		}
+		login := review.GetUser().GetLogin()
+		if report := r.captain(h, issue, login, assignedByBot[strings.ToLower(login)]); report != nil {
+			report.reviewed[issue.GetNumber()] = true
+		}
+	}
+}
+
+// formerCaptainsMention is the team former captains are listed under when
+// the issue isn't for any team.
+const formerCaptainsMention = "(former captains)"
+
+// captain returns the captain's entry under the team they most likely acted
+// for on the issue. Someone who isn't a captain any more gets an entry if
+// former is true, under the team the issue is for; otherwise nil is returned.
+func (r *Report) captain(h *Handler, issue *github.Issue, login string, former bool) *CaptainReport {
+	team, ok := h.teamForCaptain(issue, login)
+	if !ok {
+		if !former {
+			return nil
+		}
+		team = Team{Mention: formerCaptainsMention}
+		if teams := h.teamsFor(issue.GetBody(), issue.Labels); len(teams) > 0 {
+			team = teams[0]
+		}
+	}
+
+	teamReport := r.team(team)
+	for i := range teamReport.Captains {
+		if strings.EqualFold(teamReport.Captains[i].Login, login) {
+			return &teamReport.Captains[i]
+		}
+	}
+	teamReport.Captains = append(teamReport.Captains, CaptainReport{Login: login, reviewed: map[int]bool{}})
+	return &teamReport.Captains[len(teamReport.Captains)-1]
+}
+
+// team returns the team's entry, adding it if it's missing.
+func (r *Report) team(team Team) *TeamReport {
+	for i := range r.Teams {
+		if r.Teams[i].ID == team.ID {
+			return &r.Teams[i]
+		}
+	}
+	r.Teams = append(r.Teams, TeamReport{ID: team.ID, Mention: team.Mention, Captains: []CaptainReport{}})
+	return &r.Teams[len(r.Teams)-1]
+}
+
+func (r *Report) inRange(t time.Time) bool {
+	return !t.Before(r.Since) && t.Before(r.Until)
+}
+
+// finish works out the totals once every issue has been added, and sorts
+// each team's captains.
+func (r *Report) finish() {
+	for i := range r.Teams {
+		captains := r.Teams[i].Captains
+		sort.Slice(captains, func(i, j int) bool {
+			return strings.ToLower(captains[i].Login) < strings.ToLower(captains[j].Login)
+		})
+		for j := range r.Teams[i].Captains {
+			captain := &r.Teams[i].Captains[j]
+			captain.Responses = len(captain.firstResponses)
+			captain.MedianTimeToFirstResponse = median(captain.firstResponses)
+			captain.MedianFirstResponseHours = captain.MedianTimeToFirstResponse.Hours()
+			captain.PullRequestsReviewed = len(captain.reviewed)
+		}
+	}
+}
+
+func median(durations []time.Duration) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration{}, durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+var reportColumns = []string{"Team", "Captain", "Assignments", "Median time to first response", "Issues closed", "PRs reviewed"}
+
+func (r *Report) rows() [][]string {
+	rows := [][]string{}
+	for _, team := range r.Teams {
+		for _, captain := range team.Captains {
+			response := "-"
+			if captain.Responses > 0 {
+				response = formatDuration(captain.MedianTimeToFirstResponse)
+			}
+			rows = append(rows, []string{
+				team.Mention,
+				"@" + captain.Login,
+				fmt.Sprintf("%d", captain.Assignments),
+				response,
+				fmt.Sprintf("%d", captain.IssuesClosed),
+				fmt.Sprintf("%d", captain.PullRequestsReviewed),
+			})
+		}
+	}
+	return rows
+}
+
+// Table renders the report as a plain-text table for the terminal.
+func (r *Report) Table() string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(reportColumns, "\t"))
+	for _, row := range r.rows() {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// Title describes the report's date range.
+func (r *Report) Title() string {
+	lastDay := r.Until.Add(-time.Nanosecond)
+	return fmt.Sprintf("Affinity team report for %s to %s", r.Since.Format("2006-01-02"), lastDay.Format("2006-01-02"))
+}
+
+// Markdown renders the report as a GitHub-flavoured Markdown table.
+func (r *Report) Markdown() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "## %s\n\n", r.Title())
+	fmt.Fprintf(&buf, "| %s |\n", strings.Join(reportColumns, " | "))
+	fmt.Fprintf(&buf, "|%s\n", strings.Repeat(" --- |", len(reportColumns)))
+	for _, row := range r.rows() {
+		fmt.Fprintf(&buf, "| %s |\n", strings.Join(row, " | "))
+	}
+	return buf.String()
+}
+
+func formatDuration(d time.Duration) string {
+	if d < time.Hour {
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+	if d < 48*time.Hour {
+		return fmt.Sprintf("%.1fh", d.Hours())
+	}
+	return fmt.Sprintf("%.1fd", d.Hours()/24)
+}
+
+// issuesUpdatedSince returns the issues and PRs in the repo, open or closed,
+// which have been updated since the given time.
+func issuesUpdatedSince(context *ctx.Context, repo Repo, since time.Time) ([]*github.Issue, error) {
+	var issues []*github.Issue
+	opts := &github.IssueListByRepoOptions{
+		State:       "all",
+		Since:       since,
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		page, resp, err := context.GitHub.Issues.ListByRepo(context.Context(), repo.Owner, repo.Name, opts)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.ListOptions.Page = resp.NextPage
+	}
+	return issues, nil
+}
@@ -0,0 +1,155 @@
+package affinity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMedian(t *testing.T) {
+	assert.Equal(t, time.Duration(0), median(nil))
+	assert.Equal(t, 2*time.Hour, median([]time.Duration{3 * time.Hour, time.Hour, 2 * time.Hour}))
+	assert.Equal(t, 90*time.Minute, median([]time.Duration{2 * time.Hour, time.Hour}))
+}
+
+func TestReport(t *testing.T) {
+	at := func(day, hour int) *github.Timestamp {
+		return &github.Timestamp{Time: time.Date(2026, time.September, day, hour, 0, 0, 0, time.UTC)}
+	}
+	user := func(login string) *github.User { return &github.User{Login: github.String(login)} }
+
+	handler := &Handler{teams: []Team{
+		{ID: 1, Mention: "@jekyll/build", Captains: []*github.User{user("parkr"), user("envygeeks")}},
+		{ID: 2, Mention: "@jekyll/documentation", Captains: []*github.User{user("mattr-")}},
+	}}
+	report := newReport(handler.GetTeams(), at(1, 12).Time, at(31, 0).Time)
+
+	// Assigned to parkr, who responded 4 hours later, then closed it.
+	report.add(handler, "jekyllbot", &github.Issue{
+		Number:    github.Int(1),
+		Body:      github.String("@jekyll/build"),
+		Assignees: []*github.User{user("parkr")},
+		ClosedAt:  at(5, 0),
+	}, issueActivity{
+		events: []*github.IssueEvent{
+			{Event: github.String("assigned"), Actor: user("jekyllbot"), Assignee: user("parkr"), CreatedAt: at(2, 0)},
+		},
+		comments: []*github.IssueComment{
+			{User: user("parkr"), CreatedAt: at(2, 4)},
+			{User: user("parkr"), CreatedAt: at(3, 0)},
+		},
+	})
+	// Assigned to parkr before the report started, so only the review by
+	// mattr- counts.
+	report.add(handler, "jekyllbot", &github.Issue{
+		Number:           github.Int(2),
+		Body:             github.String("@jekyll/documentation"),
+		PullRequestLinks: &github.PullRequestLinks{},
+	}, issueActivity{
+		events: []*github.IssueEvent{
+			{Event: github.String("assigned"), Actor: user("jekyllbot"), Assignee: user("parkr"), CreatedAt: at(1, 0)},
+		},
+		reviews: []*github.PullRequestReview{
+			{User: user("mattr-"), SubmittedAt: at(10, 0)},
+			{User: user("mattr-"), SubmittedAt: at(11, 0)},
+		},
+	})
+	// Assigned to envygeeks, who hasn't responded.
+	report.add(handler, "jekyllbot", &github.Issue{
+		Number:    github.Int(3),
+		Body:      github.String("@jekyll/build"),
+		Assignees: []*github.User{user("envygeeks")},
+	}, issueActivity{
+		events: []*github.IssueEvent{
+			{Event: github.String("assigned"), Actor: user("jekyllbot"), Assignee: user("envygeeks"), CreatedAt: at(20, 0)},
+		},
+	})
+	// Assigned to parkr twice, who responded 2 hours after the second time.
+	report.add(handler, "jekyllbot", &github.Issue{
+		Number:    github.Int(4),
+		Body:      github.String("@jekyll/build"),
+		Assignees: []*github.User{user("parkr")},
+	}, issueActivity{
+		events: []*github.IssueEvent{
+			{Event: github.String("assigned"), Actor: user("jekyllbot"), Assignee: user("parkr"), CreatedAt: at(21, 0)},
+			{Event: github.String("unassigned"), Actor: user("parkr"), Assignee: user("parkr"), CreatedAt: at(21, 1)},
+			{Event: github.String("assigned"), Actor: user("jekyllbot"), Assignee: user("parkr"), CreatedAt: at(22, 0)},
+		},
+		comments: []*github.IssueComment{
+			{User: user("parkr"), CreatedAt: at(22, 2)},
+		},
+	})
+	// Assigned to benbalter, who has stepped down as a captain since, and
+	// closed it.
+	report.add(handler, "jekyllbot", &github.Issue{
+		Number:    github.Int(5),
+		Body:      github.String("@jekyll/documentation"),
+		Assignees: []*github.User{user("benbalter")},
+		ClosedAt:  at(24, 0),
+	}, issueActivity{
+		events: []*github.IssueEvent{
+			{Event: github.String("assigned"), Actor: user("jekyllbot"), Assignee: user("benbalter"), CreatedAt: at(23, 0)},
+		},
+	})
+	// Assigned to a former captain on an issue for no team.
+	report.add(handler, "jekyllbot", &github.Issue{
+		Number: github.Int(6),
+	}, issueActivity{
+		events: []*github.IssueEvent{
+			{Event: github.String("assigned"), Actor: user("jekyllbot"), Assignee: user("jaybe"), CreatedAt: at(23, 0)},
+		},
+		reviews: []*github.PullRequestReview{
+			{User: user("someone"), SubmittedAt: at(24, 0)},
+		},
+	})
+	report.finish()
+
+	build := report.Teams[0]
+	assert.Equal(t, "@jekyll/build", build.Mention)
+	assert.Equal(t, "envygeeks", build.Captains[0].Login)
+	assert.Equal(t, 1, build.Captains[0].Assignments)
+	assert.Equal(t, 0, build.Captains[0].Responses)
+	assert.Equal(t, "parkr", build.Captains[1].Login)
+	assert.Equal(t, 3, build.Captains[1].Assignments)
+	assert.Equal(t, 3, build.Captains[1].Responses)
+	assert.Equal(t, 4*time.Hour, build.Captains[1].MedianTimeToFirstResponse)
+	assert.Equal(t, 4.0, build.Captains[1].MedianFirstResponseHours)
+	assert.Equal(t, 1, build.Captains[1].IssuesClosed)
+
+	docs := report.Teams[1]
+	assert.Equal(t, "benbalter", docs.Captains[0].Login)
+	assert.Equal(t, 1, docs.Captains[0].Assignments)
+	assert.Equal(t, 1, docs.Captains[0].IssuesClosed)
+	assert.Equal(t, "mattr-", docs.Captains[1].Login)
+	assert.Equal(t, 0, docs.Captains[1].Assignments)
+	assert.Equal(t, 1, docs.Captains[1].PullRequestsReviewed)
+
+	assert.Len(t, report.Teams, 3, "only people the bot assigned get a row")
+	former := report.Teams[2]
+	assert.Equal(t, formerCaptainsMention, former.Mention)
+	assert.Equal(t, "jaybe", former.Captains[0].Login)
+	assert.Equal(t, 1, former.Captains[0].Assignments)
+
+	assert.Equal(t, `## Affinity team report for 2026-09-01 to 2026-09-30
+
+| Team | Captain | Assignments | Median time to first response | Issues closed | PRs reviewed |
+| --- | --- | --- | --- | --- | --- |
+| @jekyll/build | @envygeeks | 1 | - | 0 | 0 |
+| @jekyll/build | @parkr | 3 | 4.0h | 1 | 0 |
+| @jekyll/documentation | @benbalter | 1 | - | 1 | 0 |
+| @jekyll/documentation | @mattr- | 0 | - | 0 | 1 |
+| (former captains) | @jaybe | 1 | - | 0 | 0 |
+`, report.Markdown())
+}
+
+func TestBuildReportUnloadedTeams(t *testing.T) {
+	handler := &Handler{
+		teams:    []Team{{ID: 1, Mention: "@jekyll/build"}},
+		teamRefs: []teamRef{{OrgID: 3, ID: 1}, {OrgID: 3, ID: 2}, {OrgID: 3, ID: 4}},
+	}
+	_, err := handler.BuildReport(ctx.NewTestContext(), time.Now().AddDate(0, 0, -7), time.Now())
+	assert.EqualError(t, err, "BuildReport: couldn't fetch teams 2, 4")
+}
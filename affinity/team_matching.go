@@ -0,0 +1,124 @@
+package affinity
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v73/github"
+)
+
+// defaultMaxTeams is how many teams' captains are assigned when the handler
+// doesn't say otherwise.
+const defaultMaxTeams = 3
+
+// AddTeamLabel routes issues and PRs with the label to the team, as if the
+// team had been mentioned.
+func (h *Handler) AddTeamLabel(label string, teamID int64) {
+	h.Lock()
+	defer h.Unlock()
+	if h.teamLabels == nil {
+		h.teamLabels = map[string]int64{}
+	}
+	h.teamLabels[strings.ToLower(label)] = teamID
+}
+
+// SetMaxTeams sets how many of the mentioned teams get a captain assigned.
+// Defaults to 3.
+func (h *Handler) SetMaxTeams(max int) {
+	h.maxTeams = max
+}
+
+// teamsFor returns the teams mentioned in the body, in the order they're
+// mentioned, followed by the teams the labels map to, up to the handler's
+// cap.
+func (h *Handler) teamsFor(body string, labels []*github.Label) []Team {
+	teams := findAffinityTeams(body, h.GetTeams())
+	for _, team := range h.teamsForLabels(labels) {
+		if !containsTeam(teams, team.ID) {
+			teams = append(teams, team)
+		}
+	}
+
+	max := h.maxTeams
+	if max <= 0 {
+		max = defaultMaxTeams
+	}
+	if len(teams) > max {
+		teams = teams[:max]
+	}
+	return teams
+}
+
+// teamsForLabels returns the teams the labels map to.
+func (h *Handler) teamsForLabels(labels []*github.Label) []Team {
+	h.RLock()
+	defer h.RUnlock()
+	teams := []Team{}
+	for _, label := range labels {
+		teamID, ok := h.teamLabels[strings.ToLower(label.GetName())]
+		if !ok || containsTeam(teams, teamID) {
+			continue
+		}
+		for _, team := range h.teams {
+			if team.ID == teamID {
+				teams = append(teams, team)
+			}
+		}
+	}
+	return teams
+}
+
+// findAffinityTeams returns every team mentioned in the body, in the order
+// they're first mentioned.
+func findAffinityTeams(body string, allTeams []Team) []Team {
+	mentioned := []Team{}
+	for _, team := range allTeams {
+		if team.Mention != "" && strings.Contains(body, team.Mention) {
+			mentioned = append(mentioned, team)
+		}
+	}
+	sort.SliceStable(mentioned, func(i, j int) bool {
+		return strings.Index(body, mentioned[i].Mention) < strings.Index(body, mentioned[j].Mention)
+	})
+	return mentioned
+}
+
+func containsTeam(teams []Team, teamID int64) bool {
+	for _, team := range teams {
+		if team.ID == teamID {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutCaptains returns the team without the given captains, so nobody is
+// picked twice for the same issue.
+func withoutCaptains(team Team, logins []string) Team {
+	captains := []*github.User{}
+	for _, captain := range team.Captains {
+		picked := false
+		for _, login := range logins {
+			if captain.GetLogin() == login {
+				picked = true
+			}
+		}
+		if !picked {
+			captains = append(captains, captain)
+		}
+	}
+	team.Captains = captains
+	return team
+}
+
+// withoutStaffedTeams returns the teams none of whose captains are among the
+// logins, so a team isn't asked twice for the same issue.
+func withoutStaffedTeams(teams []Team, logins []string) []Team {
+	unstaffed := []Team{}
+	for _, team := range teams {
+		if len(withoutCaptains(team, logins).Captains) == len(team.Captains) {
+			unstaffed = append(unstaffed, team)
+		}
+	}
+	return unstaffed
+}
@@ -0,0 +1,69 @@
+package affinity
+
+import (
+	"testing"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func teamIDs(teams []Team) []int64 {
+	ids := []int64{}
+	for _, team := range teams {
+		ids = append(ids, team.ID)
+	}
+	return ids
+}
+
+func TestFindAffinityTeams(t *testing.T) {
+	allTeams := []Team{
+		{ID: 456, Mention: "@jekyll/documentation"},
+		{ID: 141, Mention: "@jekyll/windows"},
+		{ID: 123, Mention: "@jekyll/build"},
+	}
+
+	assert.Equal(t, []int64{141, 456}, teamIDs(findAffinityTeams("@jekyll/windows @jekyll/documentation", allTeams)))
+	assert.Equal(t, []int64{456}, teamIDs(findAffinityTeams(exampleLongComment, allTeams)))
+	assert.Empty(t, findAffinityTeams("no teams here", allTeams))
+}
+
+func TestHandlerTeamsFor(t *testing.T) {
+	handler := &Handler{teams: []Team{
+		{ID: 456, Mention: "@jekyll/documentation"},
+		{ID: 141, Mention: "@jekyll/windows"},
+		{ID: 123, Mention: "@jekyll/build"},
+		{ID: 101, Mention: "@jekyll/performance"},
+	}}
+	handler.AddTeamLabel("Windows", 141)
+	handler.AddTeamLabel("documentation", 456)
+	windows := []*github.Label{{Name: github.String("windows")}}
+
+	assert.Equal(t, []int64{141}, teamIDs(handler.teamsFor("Doesn't work on my PC", windows)))
+	assert.Equal(t, []int64{456, 141}, teamIDs(handler.teamsFor("@jekyll/documentation", windows)))
+	assert.Equal(t, []int64{141}, teamIDs(handler.teamsFor("@jekyll/windows", windows)), "no duplicates")
+	assert.Empty(t, handler.teamsFor("Hello", []*github.Label{{Name: github.String("bug")}}))
+
+	everyone := "@jekyll/documentation @jekyll/windows @jekyll/build @jekyll/performance"
+	assert.Equal(t, []int64{456, 141, 123}, teamIDs(handler.teamsFor(everyone, nil)))
+	handler.SetMaxTeams(2)
+	assert.Equal(t, []int64{456, 141}, teamIDs(handler.teamsFor(everyone, nil)))
+}
+
+func TestWithoutCaptains(t *testing.T) {
+	team := Team{Captains: []*github.User{
+		{Login: github.String("parkr")},
+		{Login: github.String("envygeeks")},
+	}}
+	assert.Equal(t, []string{"envygeeks"}, usersByLogin(withoutCaptains(team, []string{"parkr"}).Captains))
+	assert.Len(t, team.Captains, 2)
+}
+
+func TestWithoutStaffedTeams(t *testing.T) {
+	teams := []Team{
+		{ID: 141, Captains: []*github.User{{Login: github.String("parkr")}, {Login: github.String("envygeeks")}}},
+		{ID: 456, Captains: []*github.User{{Login: github.String("mattr-")}}},
+	}
+	assert.Equal(t, []int64{456}, teamIDs(withoutStaffedTeams(teams, []string{"envygeeks"})))
+	assert.Equal(t, []int64{141, 456}, teamIDs(withoutStaffedTeams(teams, nil)))
+	assert.Empty(t, withoutStaffedTeams(teams, []string{"parkr", "mattr-"}))
+}
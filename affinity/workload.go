@@ -0,0 +1,197 @@
+package affinity
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/ctx"
+)
+
+// SelectionStrategy determines how captains are picked from a team.
+type SelectionStrategy int
+
+const (
+	// RandomSelection picks captains uniformly at random.
+	RandomSelection SelectionStrategy = iota
+
+	// LeastLoadedSelection picks the captains with the fewest open issues
+	// assigned and reviews requested across the enabled repos, counting
+	// the bot's recent assignments extra.
+	LeastLoadedSelection
+)
+
+// recentAssignmentWindow is how long the bot's own assignments add to a
+// captain's workload. An assignment counts one extra when it's brand new,
+// fading to nothing by the end of the window.
+const recentAssignmentWindow = 7 * 24 * time.Hour
+
+var recentAssignments = assignmentLog{data: make(map[string][]time.Time)}
+
+func (s SelectionStrategy) String() string {
+	switch s {
+	case LeastLoadedSelection:
+		return "least-loaded"
+	default:
+		return "random"
+	}
+}
+
+// SetSelectionStrategy sets how captains are picked. Defaults to
+// RandomSelection.
+func (h *Handler) SetSelectionStrategy(strategy SelectionStrategy) {
+	h.strategy = strategy
+}
+
+// Workload is what a captain already has on their plate.
+type Workload struct {
+	// Open issues and PRs assigned to the captain.
+	Assigned int
+	// Open PRs with a review requested from the captain.
+	ReviewRequests int
+	// When the bot assigned the captain something recently.
+	RecentAssignments []time.Time
+}
+
+// Score is the captain's load at the given time. Lower is less busy.
+func (w Workload) Score(now time.Time) float64 {
+	score := float64(w.Assigned + w.ReviewRequests)
+	for _, assignedAt := range w.RecentAssignments {
+		if age := now.Sub(assignedAt); age >= 0 && age < recentAssignmentWindow {
+			score += 1 - float64(age)/float64(recentAssignmentWindow)
+		}
+	}
+	return score
+}
+
+// LeastLoadedCaptainLoginsExcluding returns up to count captains, other
+// than the excluded login, with the lowest workload scores. Ties go to the
+// alphabetically first login, so the same workloads give the same captains.
+func (t Team) LeastLoadedCaptainLoginsExcluding(excludedLogin string, count int, workloads map[string]Workload, now time.Time) []string {
+	candidates := []string{}
+	for _, login := range usersByLogin(t.Captains) {
+		if login != excludedLogin {
+			candidates = append(candidates, login)
+		}
+	}
+
+	scores := map[string]float64{}
+	for _, login := range candidates {
+		scores[login] = workloads[login].Score(now)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if scores[candidates[i]] != scores[candidates[j]] {
+			return scores[candidates[i]] < scores[candidates[j]]
+		}
+		return candidates[i] < candidates[j]
+	})
+
+	if len(candidates) > count {
+		candidates = candidates[:count]
+	}
+	return candidates
+}
+
+// selectCaptains picks count available captains from the team, other than
+// the excluded login, using the handler's selection strategy. If workloads
+// can't be fetched, it falls back to picking at random.
+func (h *Handler) selectCaptains(context *ctx.Context, team Team, excludedLogin string, count int) []string {
+	team = h.withAvailableCaptains(context, team)
+	if h.strategy == LeastLoadedSelection {
+		workloads, err := captainWorkloads(context, h.repos, team.Captains)
+		if err == nil {
+			return team.LeastLoadedCaptainLoginsExcluding(excludedLogin, count, workloads, time.Now())
+		}
+		context.Log("affinity: couldn't fetch workloads for %s, picking at random: %v", team.Mention, err)
+	}
+	return team.RandomCaptainLoginsExcluding(excludedLogin, count)
+}
+
+// captainWorkloads counts the open issues assigned to and reviews requested
+// from each captain across the repos. Every count is one search, and they're
+// all made in a single GraphQL request so a team doesn't use up the search
+// rate limit.
+func captainWorkloads(context *ctx.Context, repos []Repo, captains []*github.User) (map[string]Workload, error) {
+	workloads := map[string]Workload{}
+	logins := usersByLogin(captains)
+	if len(logins) == 0 {
+		return workloads, nil
+	}
+
+	repoQualifiers := make([]string, len(repos))
+	for i, repo := range repos {
+		repoQualifiers[i] = fmt.Sprintf("repo:%s/%s", repo.Owner, repo.Name)
+	}
+	scope := strings.Join(repoQualifiers, " ")
+
+	fields := []string{}
+	for i, login := range logins {
+		fields = append(fields,
+			fmt.Sprintf("a%d: search(query: %q, type: ISSUE) { issueCount }", i, fmt.Sprintf("is:open assignee:%s %s", login, scope)),
+			fmt.Sprintf("r%d: search(query: %q, type: ISSUE) { issueCount }", i, fmt.Sprintf("is:open is:pr review-requested:%s %s", login, scope)),
+		)
+	}
+	req, err := context.GitHub.NewRequest("POST", "graphql", map[string]string{
+		"query": "query { " + strings.Join(fields, " ") + " }",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Data map[string]*struct {
+			IssueCount int `json:"issueCount"`
+		} `json:"data"`
+	}
+	if _, err := context.GitHub.Do(context.Context(), req, &response); err != nil {
+		return nil, err
+	}
+
+	for i, login := range logins {
+		assigned, reviewRequests := response.Data[fmt.Sprintf("a%d", i)], response.Data[fmt.Sprintf("r%d", i)]
+		if assigned == nil || reviewRequests == nil {
+			return nil, fmt.Errorf("captainWorkloads: no search results for %s", login)
+		}
+		workloads[login] = Workload{
+			Assigned:          assigned.IssueCount,
+			ReviewRequests:    reviewRequests.IssueCount,
+			RecentAssignments: recentAssignments.get(login),
+		}
+	}
+	return workloads, nil
+}
+
+// assignmentLog remembers when the bot assigned each captain something.
+type assignmentLog struct {
+	sync.Mutex // protects 'data'
+	data       map[string][]time.Time
+}
+
+func (l *assignmentLog) add(logins []string, at time.Time) {
+	l.Lock()
+	defer l.Unlock()
+	for _, login := range logins {
+		l.data[login] = append(l.recentLocked(login, at), at)
+	}
+}
+
+func (l *assignmentLog) get(login string) []time.Time {
+	l.Lock()
+	defer l.Unlock()
+	return append([]time.Time{}, l.recentLocked(login, time.Now())...)
+}
+
+// recentLocked returns the login's assignments still within the window.
+// The caller must hold the lock.
+func (l *assignmentLog) recentLocked(login string, now time.Time) []time.Time {
+	recent := []time.Time{}
+	for _, assignedAt := range l.data[login] {
+		if now.Sub(assignedAt) < recentAssignmentWindow {
+			recent = append(recent, assignedAt)
+		}
+	}
+	return recent
+}
@@ -0,0 +1,93 @@
+package affinity
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkloadScore(t *testing.T) {
+	now := time.Date(2016, time.January, 8, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, 0.0, Workload{}.Score(now))
+	assert.Equal(t, 5.0, Workload{Assigned: 3, ReviewRequests: 2}.Score(now))
+
+	workload := Workload{Assigned: 1, RecentAssignments: []time.Time{
+		now,                                  // counts fully
+		now.Add(-recentAssignmentWindow / 2), // counts half
+		now.Add(-recentAssignmentWindow),     // too old
+	}}
+	assert.Equal(t, 2.5, workload.Score(now))
+}
+
+func TestTeamLeastLoadedCaptainLoginsExcluding(t *testing.T) {
+	now := time.Now()
+	team := Team{Captains: []*github.User{
+		{Login: github.String("parkr")},
+		{Login: github.String("envygeeks")},
+		{Login: github.String("mattr-")},
+		{Login: github.String("ashmaroli")},
+	}}
+	workloads := map[string]Workload{
+		"parkr":     {Assigned: 0},
+		"envygeeks": {Assigned: 4, ReviewRequests: 1},
+		"mattr-":    {Assigned: 1},
+		"ashmaroli": {Assigned: 1},
+	}
+
+	assert.Equal(t, []string{"parkr"}, team.LeastLoadedCaptainLoginsExcluding("", 1, workloads, now))
+	assert.Equal(t, []string{"ashmaroli", "mattr-"}, team.LeastLoadedCaptainLoginsExcluding("parkr", 2, workloads, now))
+	assert.Equal(t, []string{"ashmaroli", "mattr-", "envygeeks"}, team.LeastLoadedCaptainLoginsExcluding("parkr", 5, workloads, now))
+
+	// A recent assignment tips the balance.
+	workloads["ashmaroli"] = Workload{Assigned: 1, RecentAssignments: []time.Time{now.Add(-time.Hour)}}
+	assert.Equal(t, []string{"mattr-"}, team.LeastLoadedCaptainLoginsExcluding("parkr", 1, workloads, now))
+
+	// Captains we know nothing about aren't busy.
+	delete(workloads, "envygeeks")
+	assert.Equal(t, []string{"envygeeks", "parkr"}, team.LeastLoadedCaptainLoginsExcluding("", 2, workloads, now))
+}
+
+func TestAssignmentLog(t *testing.T) {
+	log := assignmentLog{data: make(map[string][]time.Time)}
+	now := time.Now()
+	log.add([]string{"parkr"}, now.Add(-2*recentAssignmentWindow))
+	log.add([]string{"parkr", "envygeeks"}, now)
+	assert.Len(t, log.get("parkr"), 1)
+	assert.Len(t, log.get("envygeeks"), 1)
+	assert.Len(t, log.get("mattr-"), 0)
+}
+
+func TestCaptainWorkloads(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+
+	requests := 0
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+		requests++
+		var body struct{ Query string }
+		json.NewDecoder(r.Body).Decode(&body)
+		assert.Contains(t, body.Query, `a1: search(query: "is:open assignee:envygeeks repo:o/r repo:o/s", type: ISSUE) { issueCount }`)
+		assert.Contains(t, body.Query, `r0: search(query: "is:open is:pr review-requested:parkr repo:o/r repo:o/s", type: ISSUE) { issueCount }`)
+		fmt.Fprint(w, `{"data":{"a0":{"issueCount":3},"r0":{"issueCount":1},"a1":{"issueCount":0},"r1":{"issueCount":2}}}`)
+	})
+
+	repos := []Repo{{Owner: "o", Name: "r"}, {Owner: "o", Name: "s"}}
+	captains := []*github.User{{Login: github.String("parkr")}, {Login: github.String("envygeeks")}}
+	workloads, err := captainWorkloads(context, repos, captains)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, requests, "one request for the whole team")
+	assert.Equal(t, 3, workloads["parkr"].Assigned)
+	assert.Equal(t, 1, workloads["parkr"].ReviewRequests)
+	assert.Equal(t, 2, workloads["envygeeks"].ReviewRequests)
+
+	_, err = captainWorkloads(context, repos, append(captains, &github.User{Login: github.String("mattr-")}))
+	assert.EqualError(t, err, "captainWorkloads: no search results for mattr-")
+}
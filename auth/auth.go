@@ -4,6 +4,7 @@ package auth
 import (
 	"fmt"
 	"log"
+	"sort"
 
 	"github.com/google/go-github/v73/github"
 	"github.com/jekyll/jekyllbot/ctx"
@@ -22,6 +23,7 @@ var (
 	teamHasPushAccessCache = map[string]*github.Repository{}
 	teamMembershipCache    = map[string]teamMembershipAnswer{}
 	orgOwnersCache         = map[string][]*github.User{}
+	teamMembersCache       = map[string][]*github.User{}
 )
 
 type authenticator struct {
@@ -40,6 +42,50 @@ func CommenterHasPushAccess(context *ctx.Context, owner, repo, commenterLogin st
 	return false
 }
 
+// UsersWithPushAccess returns the logins of every member of a team in the
+// org which has push access to the given repo, sorted alphabetically.
+func UsersWithPushAccess(context *ctx.Context, owner, repo string) []string {
+	auth := authenticator{context: context}
+	seen := map[string]bool{}
+	logins := []string{}
+	for _, team := range auth.teamsForOrg(owner) {
+		if !auth.teamHasPushAccess(*team.Organization.ID, *team.ID, owner, repo) {
+			continue
+		}
+		for _, member := range auth.teamMembers(*team.Organization.ID, *team.ID) {
+			if login := member.GetLogin(); login != "" && !seen[login] {
+				seen[login] = true
+				logins = append(logins, login)
+			}
+		}
+	}
+	sort.Strings(logins)
+	return logins
+}
+
+// UserIsTeamMember returns true if the login is an active member of the team
+// with the given slug in the org.
+func UserIsTeamMember(context *ctx.Context, org, teamSlug, login string) bool {
+	cacheKey := fmt.Sprintf("%s_%s_%s", org, teamSlug, login)
+	if _, ok := teamMembershipCache[cacheKey]; !ok {
+		membership, resp, err := context.GitHub.Teams.GetTeamMembershipBySlug(context.Context(), org, teamSlug, login)
+		if resp != nil && resp.StatusCode == 404 {
+			teamMembershipCache[cacheKey] = teamMembershipNo
+			return false
+		}
+		if err != nil {
+			log.Printf("ERROR performing GetTeamMembershipBySlug(\"%s\", \"%s\", \"%s\"): %v", org, teamSlug, login, err)
+			return false
+		}
+		if membership.GetState() == "active" {
+			teamMembershipCache[cacheKey] = teamMembershipYes
+		} else {
+			teamMembershipCache[cacheKey] = teamMembershipNo
+		}
+	}
+	return teamMembershipCache[cacheKey] == teamMembershipYes
+}
+
 func UserIsOrgOwner(context *ctx.Context, org, login string) bool {
 	auth := authenticator{context: context}
 	for _, owner := range auth.ownersForOrg(org) {
@@ -93,6 +139,24 @@ func (auth authenticator) teamHasPushAccess(orgID, teamID int64, owner, repo str
 	return permissions["push"] || permissions["admin"]
 }
 
+func (auth authenticator) teamMembers(orgID, teamID int64) []*github.User {
+	cacheKey := fmt.Sprintf("%d_%d", orgID, teamID)
+	if _, ok := teamMembersCache[cacheKey]; !ok {
+		members, _, err := auth.context.GitHub.Teams.ListTeamMembersByID(
+			auth.context.Context(),
+			orgID,
+			teamID,
+			&github.TeamListTeamMembersOptions{ListOptions: github.ListOptions{Page: 0, PerPage: 100}},
+		)
+		if err != nil {
+			log.Printf("ERROR performing ListTeamMembersByID(%d, %d): %v", orgID, teamID, err)
+			return nil
+		}
+		teamMembersCache[cacheKey] = members
+	}
+	return teamMembersCache[cacheKey]
+}
+
 func (auth authenticator) teamsForOrg(org string) []*github.Team {
 	if _, ok := teamsCache[org]; !ok {
 		teamz, _, err := auth.context.GitHub.Teams.ListTeams(
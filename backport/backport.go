@@ -0,0 +1,335 @@
+// backport cherry-picks merged pull requests onto stable branches.
+package backport
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/auth"
+	"github.com/jekyll/jekyllbot/ctx"
+)
+
+var (
+	// LabelName is the label added to backport PRs.
+	LabelName = "backport"
+
+	backportCommentRegexp = regexp.MustCompile(`@[a-zA-Z-_]+: backport ([^\r\n]+)`)
+	branchNameRegexp      = regexp.MustCompile(`^[\w.\-/]+$`)
+)
+
+// conflictError is returned when a commit doesn't apply cleanly to the
+// target branch.
+type conflictError struct {
+	sha   string
+	files []string
+}
+
+func (e conflictError) Error() string {
+	return fmt.Sprintf("%s doesn't apply cleanly: %s", e.sha, strings.Join(e.files, ", "))
+}
+
+// BackportHandler handles "@jekyllbot: backport 3.x-stable" comments on
+// merged PRs. The PR's commits are replayed onto a new branch off each
+// target branch, and a PR is opened for each.
+func BackportHandler(context *ctx.Context, payload interface{}) error {
+	event, ok := payload.(*github.IssueCommentEvent)
+	if !ok {
+		return context.NewError("backport.BackportHandler: not an issue comment event")
+	}
+
+	if event.GetAction() != "created" {
+		return context.NewError("backport.BackportHandler: comment action is %q, not created", event.GetAction())
+	}
+
+	if event.Issue == nil || event.Issue.PullRequestLinks == nil {
+		return context.NewError("backport.BackportHandler: comment not on a pull request")
+	}
+
+	targets := parseBackportComment(event.Comment.GetBody())
+	if targets == nil {
+		return context.NewError("backport.BackportHandler: not a backport comment")
+	}
+
+	owner, repo, number := *event.Repo.Owner.Login, *event.Repo.Name, *event.Issue.Number
+	context.SetIssue(owner, repo, number)
+	commenter := event.Comment.User.GetLogin()
+	if !auth.CommenterHasPushAccess(context, owner, repo, commenter) {
+		return context.NewError("backport.BackportHandler: %s isn't allowed to backport on %s/%s", commenter, owner, repo)
+	}
+
+	pr, _, err := context.GitHub.PullRequests.Get(context.Context(), owner, repo, number)
+	if err != nil {
+		return context.NewError("backport.BackportHandler: couldn't get %s: %v", context.Issue, err)
+	}
+	if !pr.GetMerged() {
+		comment(context, owner, repo, number, "I can only backport pull requests which have been merged.")
+		return context.NewError("backport.BackportHandler: %s isn't merged", context.Issue)
+	}
+
+	commits, err := pullRequestCommits(context, owner, repo, number)
+	if err != nil {
+		return context.NewError("backport.BackportHandler: couldn't list commits for %s: %v", context.Issue, err)
+	}
+
+	for _, target := range targets {
+		backport, err := backportPullRequest(context, owner, repo, pr, commits, target, commenter)
+		switch err := err.(type) {
+		case nil:
+			comment(context, owner, repo, number, fmt.Sprintf("I opened %s to backport this to `%s`.", backport.GetHTMLURL(), target))
+		case conflictError:
+			files := ""
+			if len(err.files) > 0 {
+				files = " These files changed on both sides:\n\n" + bulletList(err.files) + "\n\n"
+			}
+			comment(context, owner, repo, number, fmt.Sprintf(
+				"I couldn't backport this to `%s` because %s doesn't apply cleanly.%sYou'll have to backport this one by hand.",
+				target, err.sha, files))
+		default:
+			comment(context, owner, repo, number, fmt.Sprintf("I couldn't backport this to `%s`: %v", target, err))
+			context.Log("backport.BackportHandler: error backporting %s to %s: %v", context.Issue, target, err)
+		}
+	}
+
+	return nil
+}
+
+// parseBackportComment returns the target branches in the comment, or nil
+// if it isn't a backport comment.
+func parseBackportComment(body string) []string {
+	matches := backportCommentRegexp.FindStringSubmatch(body)
+	if matches == nil {
+		return nil
+	}
+	targets := []string{}
+	for _, target := range strings.Fields(strings.Replace(matches[1], ",", " ", -1)) {
+		if branchNameRegexp.MatchString(target) {
+			targets = append(targets, target)
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+	return targets
+}
+
+// backportPullRequest cherry-picks the commits onto a new branch off the
+// target and opens a PR for it. If a commit doesn't apply cleanly, the
+// branch is deleted and a conflictError is returned.
+func backportPullRequest(context *ctx.Context, owner, repo string, pr *github.PullRequest, commits []*github.RepositoryCommit, target, requester string) (*github.PullRequest, error) {
+	targetRef, _, err := context.GitHub.Git.GetRef(context.Context(), owner, repo, "heads/"+target)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't find branch %s: %v", target, err)
+	}
+	head, _, err := context.GitHub.Git.GetCommit(context.Context(), owner, repo, targetRef.GetObject().GetSHA())
+	if err != nil {
+		return nil, err
+	}
+
+	// The cherry-picks are merged on the backport branch itself, so it's
+	// made before anything is picked.
+	branch := fmt.Sprintf("backport-%d-to-%s", pr.GetNumber(), target)
+	_, _, err = context.GitHub.Git.CreateRef(context.Context(), owner, repo, &github.Reference{
+		Ref:    github.String("refs/heads/" + branch),
+		Object: &github.GitObject{SHA: head.SHA},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create branch %s: %v", branch, err)
+	}
+
+	for _, commit := range commits {
+		if len(commit.Parents) != 1 {
+			// Merges from the base branch would bring the whole base
+			// branch along with them.
+			continue
+		}
+		head, err = cherryPick(context, owner, repo, branch, commit, head)
+		if err != nil {
+			if _, derr := context.GitHub.Git.DeleteRef(context.Context(), owner, repo, "heads/"+branch); derr != nil {
+				context.Log("backport: couldn't delete branch %s on %s/%s: %v", branch, owner, repo, derr)
+			}
+			return nil, err
+		}
+	}
+
+	backport, _, err := context.GitHub.PullRequests.Create(context.Context(), owner, repo, &github.NewPullRequest{
+		Title: github.String(fmt.Sprintf("Backport #%d to %s: %s", pr.GetNumber(), target, pr.GetTitle())),
+		Head:  github.String(branch),
+		Base:  github.String(target),
+		Body: github.String(fmt.Sprintf("Backport of #%d to `%s`, as requested by @%s.\n\n---\n\n%s",
+			pr.GetNumber(), target, requester, pr.GetBody())),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open pull request: %v", err)
+	}
+
+	_, _, err = context.GitHub.Issues.AddLabelsToIssue(context.Context(), owner, repo, backport.GetNumber(), []string{LabelName})
+	if err != nil {
+		context.Log("backport: couldn't label %s: %v", backport.GetHTMLURL(), err)
+	}
+
+	return backport, nil
+}
+
+// cherryPick applies the changes the commit made to its parent onto head,
+// and returns the new commit, which the branch then points at. The Merges
+// API has no cherry-pick, so the branch is first reset to a commit with
+// head's files whose parent is the commit's parent. Merging the commit into
+// that is then a 3-way merge of the commit's changes with everything which
+// is different on head, and the result only needs reparenting onto head.
+func cherryPick(context *ctx.Context, owner, repo, branch string, commit *github.RepositoryCommit, head *github.Commit) (*github.Commit, error) {
+	sibling, _, err := context.GitHub.Git.CreateCommit(context.Context(), owner, repo, &github.Commit{
+		Message: github.String(fmt.Sprintf("Temporary commit to cherry-pick %s", commit.GetSHA())),
+		Tree:    &github.Tree{SHA: head.GetTree().SHA},
+		Parents: []*github.Commit{{SHA: commit.Parents[0].SHA}},
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := updateBranch(context, owner, repo, branch, sibling.GetSHA()); err != nil {
+		return nil, err
+	}
+
+	merged, resp, err := context.GitHub.Repositories.Merge(context.Context(), owner, repo, &github.RepositoryMergeRequest{
+		Base: github.String(branch),
+		Head: github.String(commit.GetSHA()),
+	})
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusConflict {
+			return nil, conflictError{sha: commit.GetSHA(), files: conflictingFiles(context, owner, repo, commit, head)}
+		}
+		return nil, err
+	}
+
+	tree := merged.GetCommit().GetTree().GetSHA()
+	if tree == head.GetTree().GetSHA() {
+		// Already applied; put the branch back.
+		return head, updateBranch(context, owner, repo, branch, head.GetSHA())
+	}
+
+	picked, _, err := context.GitHub.Git.CreateCommit(context.Context(), owner, repo, &github.Commit{
+		Message: github.String(commit.GetCommit().GetMessage()),
+		Author:  commit.GetCommit().GetAuthor(),
+		Tree:    &github.Tree{SHA: github.String(tree)},
+		Parents: []*github.Commit{{SHA: head.SHA}},
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return picked, updateBranch(context, owner, repo, branch, picked.GetSHA())
+}
+
+func updateBranch(context *ctx.Context, owner, repo, branch, sha string) error {
+	_, _, err := context.GitHub.Git.UpdateRef(context.Context(), owner, repo, &github.Reference{
+		Ref:    github.String("refs/heads/" + branch),
+		Object: &github.GitObject{SHA: github.String(sha)},
+	}, true)
+	return err
+}
+
+// conflictingFiles lists the files which the commit changes and which are
+// also different on head, for the conflict message. The merge doesn't say
+// which of them actually conflicted.
+func conflictingFiles(context *ctx.Context, owner, repo string, commit *github.RepositoryCommit, head *github.Commit) []string {
+	parent, _, err := context.GitHub.Git.GetCommit(context.Context(), owner, repo, commit.Parents[0].GetSHA())
+	if err != nil {
+		context.Log("backport: couldn't get %s: %v", commit.Parents[0].GetSHA(), err)
+		return nil
+	}
+
+	trees := []map[string]*github.TreeEntry{}
+	for _, sha := range []string{parent.GetTree().GetSHA(), commit.GetCommit().GetTree().GetSHA(), head.GetTree().GetSHA()} {
+		entries, err := treeEntries(context, owner, repo, sha)
+		if err != nil {
+			context.Log("backport: couldn't list the files %s conflicts in: %v", commit.GetSHA(), err)
+			return nil
+		}
+		trees = append(trees, entries)
+	}
+	return changedOnBothSides(trees[0], trees[1], trees[2])
+}
+
+// changedOnBothSides returns the paths which were changed from base in
+// theirs, and which are different again in ours.
+func changedOnBothSides(base, theirs, ours map[string]*github.TreeEntry) []string {
+	paths := []string{}
+	for path := range base {
+		paths = append(paths, path)
+	}
+	for path := range theirs {
+		if _, ok := base[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	changed := []string{}
+	for _, path := range paths {
+		b, t, o := base[path], theirs[path], ours[path]
+		if sameEntry(b, t) || sameEntry(o, t) || sameEntry(o, b) {
+			continue // unchanged, already applied, or only changed by the commit
+		}
+		changed = append(changed, path)
+	}
+	return changed
+}
+
+func sameEntry(a, b *github.TreeEntry) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.GetSHA() == b.GetSHA() && a.GetMode() == b.GetMode()
+}
+
+// treeEntries returns the files in the tree, by path.
+func treeEntries(context *ctx.Context, owner, repo, sha string) (map[string]*github.TreeEntry, error) {
+	tree, _, err := context.GitHub.Git.GetTree(context.Context(), owner, repo, sha, true)
+	if err != nil {
+		return nil, err
+	}
+	if tree.GetTruncated() {
+		return nil, fmt.Errorf("tree %s is too big to backport through the API", sha)
+	}
+	entries := map[string]*github.TreeEntry{}
+	for _, entry := range tree.Entries {
+		if entry.GetType() != "tree" {
+			entries[entry.GetPath()] = entry
+		}
+	}
+	return entries, nil
+}
+
+func pullRequestCommits(context *ctx.Context, owner, repo string, number int) ([]*github.RepositoryCommit, error) {
+	var commits []*github.RepositoryCommit
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		page, resp, err := context.GitHub.PullRequests.ListCommits(context.Context(), owner, repo, number, opts)
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return commits, nil
+}
+
+func comment(context *ctx.Context, owner, repo string, number int, body string) {
+	_, _, err := context.GitHub.Issues.CreateComment(context.Context(), owner, repo, number, &github.IssueComment{Body: github.String(body)})
+	if err != nil {
+		context.Log("backport: couldn't comment on %s/%s#%d: %v", owner, repo, number, err)
+	}
+}
+
+func bulletList(items []string) string {
+	lines := make([]string, len(items))
+	for i, item := range items {
+		lines[i] = fmt.Sprintf("- `%s`", item)
+	}
+	return strings.Join(lines, "\n")
+}
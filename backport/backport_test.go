@@ -0,0 +1,192 @@
+package backport
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBackportComment(t *testing.T) {
+	assert.Nil(t, parseBackportComment("please backport this"))
+	assert.Nil(t, parseBackportComment("@jekyllbot: merge +fix"))
+	assert.Equal(t, []string{"3.x-stable"}, parseBackportComment("@jekyllbot: backport 3.x-stable"))
+	assert.Equal(t, []string{"3.x-stable", "2.x-stable"}, parseBackportComment("@jekyllbot: backport 3.x-stable, 2.x-stable\nthanks!"))
+}
+
+func TestChangedOnBothSides(t *testing.T) {
+	entry := func(sha string) *github.TreeEntry {
+		return &github.TreeEntry{SHA: github.String(sha), Mode: github.String("100644"), Type: github.String("blob")}
+	}
+	base := map[string]*github.TreeEntry{
+		"unchanged.rb": entry("a"),
+		"modified.rb":  entry("b"),
+		"removed.rb":   entry("c"),
+		"both.rb":      entry("d"),
+		"applied.rb":   entry("e"),
+	}
+	theirs := map[string]*github.TreeEntry{
+		"unchanged.rb": entry("a"),
+		"modified.rb":  entry("b2"),
+		"both.rb":      entry("d2"),
+		"applied.rb":   entry("e2"),
+		"added.rb":     entry("f"),
+	}
+	ours := map[string]*github.TreeEntry{
+		"unchanged.rb": entry("a"),
+		"modified.rb":  entry("b"),
+		"removed.rb":   entry("c"),
+		"both.rb":      entry("d3"),
+		"applied.rb":   entry("e2"),
+	}
+
+	assert.Equal(t, []string{"both.rb"}, changedOnBothSides(base, theirs, ours))
+}
+
+// The commit and the target branch both change lib/jekyll.rb, in different
+// places. The Merges API combines them, so the backport goes ahead.
+func TestBackportPullRequestMergesFileChangedOnBothSides(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+
+	mux.HandleFunc("/repos/o/r/git/ref/heads/3.x-stable", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"ref":"refs/heads/3.x-stable","object":{"sha":"stable"}}`)
+	})
+	mux.HandleFunc("/repos/o/r/git/commits/stable", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"sha":"stable","tree":{"sha":"stable-tree"}}`)
+	})
+	refs := []string{}
+	mux.HandleFunc("/repos/o/r/git/refs", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+		var v struct {
+			Ref string `json:"ref"`
+			SHA string `json:"sha"`
+		}
+		json.NewDecoder(r.Body).Decode(&v)
+		assert.Equal(t, "refs/heads/backport-1-to-3.x-stable", v.Ref)
+		refs = append(refs, v.SHA)
+		fmt.Fprint(w, `{}`)
+	})
+	mux.HandleFunc("/repos/o/r/git/refs/heads/backport-1-to-3.x-stable", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "PATCH")
+		var v struct {
+			SHA   string `json:"sha"`
+			Force bool   `json:"force"`
+		}
+		json.NewDecoder(r.Body).Decode(&v)
+		assert.True(t, v.Force)
+		refs = append(refs, v.SHA)
+		fmt.Fprint(w, `{}`)
+	})
+	type createdCommit struct {
+		Message string   `json:"message"`
+		Tree    string   `json:"tree"`
+		Parents []string `json:"parents"`
+	}
+	created := []createdCommit{}
+	mux.HandleFunc("/repos/o/r/git/commits", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+		var v createdCommit
+		json.NewDecoder(r.Body).Decode(&v)
+		created = append(created, v)
+		fmt.Fprintf(w, `{"sha":"created-%d"}`, len(created))
+	})
+	mux.HandleFunc("/repos/o/r/merges", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+		v := new(github.RepositoryMergeRequest)
+		json.NewDecoder(r.Body).Decode(v)
+		assert.Equal(t, "backport-1-to-3.x-stable", v.GetBase())
+		assert.Equal(t, "fix", v.GetHead())
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"sha":"merged","commit":{"tree":{"sha":"merged-tree"}}}`)
+	})
+	mux.HandleFunc("/repos/o/r/pulls", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+		fmt.Fprint(w, `{"number":2,"html_url":"https://github.com/o/r/pull/2"}`)
+	})
+	mux.HandleFunc("/repos/o/r/issues/2/labels", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	})
+
+	pr := &github.PullRequest{Number: github.Int(1), Title: github.String("Fix the thing")}
+	commits := []*github.RepositoryCommit{{
+		SHA:     github.String("fix"),
+		Parents: []*github.Commit{{SHA: github.String("main")}},
+		Commit: &github.Commit{
+			Message: github.String("Fix the thing"),
+			Tree:    &github.Tree{SHA: github.String("fix-tree")},
+		},
+	}}
+
+	backport, err := backportPullRequest(context, "o", "r", pr, commits, "3.x-stable", "parkr")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, backport.GetNumber())
+	if assert.Len(t, created, 2) {
+		// The stable branch's files on the commit's parent, to merge into.
+		assert.Equal(t, createdCommit{Message: "Temporary commit to cherry-pick fix", Tree: "stable-tree", Parents: []string{"main"}}, created[0])
+		// The merged files on the stable branch.
+		assert.Equal(t, createdCommit{Message: "Fix the thing", Tree: "merged-tree", Parents: []string{"stable"}}, created[1])
+	}
+	assert.Equal(t, []string{"stable", "created-1", "created-2"}, refs)
+}
+
+func TestBackportPullRequestConflict(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+
+	mux.HandleFunc("/repos/o/r/git/ref/heads/3.x-stable", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"ref":"refs/heads/3.x-stable","object":{"sha":"stable"}}`)
+	})
+	mux.HandleFunc("/repos/o/r/git/commits/stable", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"sha":"stable","tree":{"sha":"stable-tree"}}`)
+	})
+	mux.HandleFunc("/repos/o/r/git/commits/main", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"sha":"main","tree":{"sha":"main-tree"}}`)
+	})
+	mux.HandleFunc("/repos/o/r/git/refs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{}`)
+	})
+	deleted := false
+	mux.HandleFunc("/repos/o/r/git/refs/heads/backport-1-to-3.x-stable", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "DELETE" {
+			deleted = true
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		fmt.Fprint(w, `{}`)
+	})
+	mux.HandleFunc("/repos/o/r/git/commits", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"sha":"sibling"}`)
+	})
+	mux.HandleFunc("/repos/o/r/merges", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message":"Merge conflict"}`, http.StatusConflict)
+	})
+	trees := map[string]string{
+		"main-tree":   `[{"path":"lib/jekyll.rb","sha":"a","mode":"100644","type":"blob"}]`,
+		"fix-tree":    `[{"path":"lib/jekyll.rb","sha":"b","mode":"100644","type":"blob"}]`,
+		"stable-tree": `[{"path":"lib/jekyll.rb","sha":"c","mode":"100644","type":"blob"}]`,
+	}
+	for sha, entries := range trees {
+		entries := entries
+		mux.HandleFunc("/repos/o/r/git/trees/"+sha, func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"tree":%s}`, entries)
+		})
+	}
+
+	pr := &github.PullRequest{Number: github.Int(1)}
+	commits := []*github.RepositoryCommit{{
+		SHA:     github.String("fix"),
+		Parents: []*github.Commit{{SHA: github.String("main")}},
+		Commit:  &github.Commit{Tree: &github.Tree{SHA: github.String("fix-tree")}},
+	}}
+
+	_, err := backportPullRequest(context, "o", "r", pr, commits, "3.x-stable", "parkr")
+	assert.Equal(t, conflictError{sha: "fix", files: []string{"lib/jekyll.rb"}}, err)
+	assert.True(t, deleted, "the backport branch should be deleted")
+}
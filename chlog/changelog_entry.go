@@ -0,0 +1,88 @@
+package chlog
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/parkr/changelog"
+)
+
+const defaultSkipChangelogLabel = "skip-changelog"
+
+// changelogOverrideRegexp matches a "Changelog:" line in a PR body, which
+// looks like one of:
+//
+//	Changelog: Fix the flux capacitor
+//	Changelog: +bug Fix the flux capacitor
+//	Changelog: +bug
+//	Changelog: skip
+var changelogOverrideRegexp = regexp.MustCompile(`(?im)^[ \t]*changelog:[ \t]*(?:\+([a-zA-Z-_]+))?[ \t]*([^\r\n]*?)[ \t]*\r?$`)
+
+// changelogEntry is what a merged PR contributes to the changelog.
+type changelogEntry struct {
+	// The section to put the line in, or changeSectionLabelNone.
+	Section string
+	Line    *changelog.ChangeLine
+	// Why the PR is left out of the changelog, if it is.
+	Skip string
+}
+
+// changelogOverride is the parsed "Changelog:" line from a PR body.
+type changelogOverride struct {
+	label, summary string
+	skip           bool
+}
+
+func parseChangelogOverride(body string) (changelogOverride, bool) {
+	matches := changelogOverrideRegexp.FindStringSubmatch(body)
+	if matches == nil {
+		return changelogOverride{}, false
+	}
+	if strings.EqualFold(matches[2], "skip") && matches[1] == "" {
+		return changelogOverride{skip: true}, true
+	}
+	return changelogOverride{label: downcaseAndHyphenize(matches[1]), summary: matches[2]}, true
+}
+
+// newChangelogEntry works out the changelog entry for the PR. The PR title
+// and the category from the merge command are used, unless the PR body has
+// a "Changelog:" line. The category from the merge command always wins, as
+// it comes from the maintainer doing the merge.
+func newChangelogEntry(config RepoConfig, req mergeAndLabelRequest, pr *github.PullRequest) changelogEntry {
+	for _, label := range pr.Labels {
+		if strings.EqualFold(label.GetName(), config.SkipChangelogLabel) {
+			return changelogEntry{Skip: fmt.Sprintf("it is labeled `%s`", config.SkipChangelogLabel)}
+		}
+	}
+
+	section, summary := req.ChangeSectionLabel, pr.GetTitle()
+	if override, ok := parseChangelogOverride(pr.GetBody()); ok {
+		if override.skip {
+			return changelogEntry{Skip: "its description says `Changelog: skip`"}
+		}
+		if override.summary != "" {
+			summary = override.summary
+		}
+		if override.label != "" && section == changeSectionLabelNone {
+			categories := changelogCategories(config.Categories)
+			section = categories.sectionForLabel(categories.normalizeLabel(override.label))
+		}
+	}
+
+	line := newChangeLine(summary, pr.GetNumber())
+	if config.CreditAuthors && pr.GetUser().GetLogin() != "" && pr.GetUser().GetType() != "Bot" {
+		line.Summary += fmt.Sprintf(" (@%s)", pr.GetUser().GetLogin())
+	}
+
+	return changelogEntry{Section: section, Line: line}
+}
+
+func newChangeLine(prTitle string, number int) *changelog.ChangeLine {
+	return &changelog.ChangeLine{
+		Summary:   template.HTMLEscapeString(prTitle),
+		Reference: fmt.Sprintf("#%d", number),
+	}
+}
@@ -0,0 +1,68 @@
+package chlog
+
+import (
+	"testing"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseChangelogOverride(t *testing.T) {
+	_, ok := parseChangelogOverride("Fixes #12.")
+	assert.False(t, ok)
+
+	override, ok := parseChangelogOverride("Fixes #12.\r\n\r\nChangelog: Fix the flux capacitor\r\n")
+	assert.True(t, ok)
+	assert.Equal(t, changelogOverride{summary: "Fix the flux capacitor"}, override)
+
+	override, ok = parseChangelogOverride("changelog: +Bug   Fix the flux capacitor  ")
+	assert.True(t, ok)
+	assert.Equal(t, changelogOverride{label: "bug", summary: "Fix the flux capacitor"}, override)
+
+	override, ok = parseChangelogOverride("Changelog: skip")
+	assert.True(t, ok)
+	assert.True(t, override.skip)
+}
+
+func TestNewChangelogEntry(t *testing.T) {
+	config := configForRepo("o", "unconfigured")
+	req := mergeAndLabelRequest{Owner: "o", Repo: "unconfigured", ChangeSectionLabel: changeSectionLabelNone}
+	pr := &github.PullRequest{
+		Number: github.Int(12),
+		Title:  github.String("Fix <the> thing"),
+		User:   &github.User{Login: github.String("parkr"), Type: github.String("User")},
+	}
+
+	entry := newChangelogEntry(config, req, pr)
+	assert.Equal(t, changeSectionLabelNone, entry.Section)
+	assert.Equal(t, "  * Fix &lt;the&gt; thing (#12)", entry.Line.String())
+
+	config.CreditAuthors = true
+	pr.Body = github.String("Changelog: +bug Fix the flux capacitor")
+	entry = newChangelogEntry(config, req, pr)
+	assert.Equal(t, "Bug Fixes", entry.Section)
+	assert.Equal(t, "  * Fix the flux capacitor (@parkr) (#12)", entry.Line.String())
+
+	// The maintainer's category wins.
+	req.ChangeSectionLabel = "Documentation"
+	entry = newChangelogEntry(config, req, pr)
+	assert.Equal(t, "Documentation", entry.Section)
+
+	pr.Body = github.String("Changelog: skip")
+	assert.Equal(t, "its description says `Changelog: skip`", newChangelogEntry(config, req, pr).Skip)
+
+	pr.Body = nil
+	pr.Labels = []*github.Label{{Name: github.String("skip-changelog")}}
+	assert.Equal(t, "it is labeled `skip-changelog`", newChangelogEntry(config, req, pr).Skip)
+}
+
+func TestVersionNotesExcludesInternalSections(t *testing.T) {
+	history := "## HEAD\n\n### Bug Fixes\n\n  * Fix a thing (#1)\n\n### Development Fixes\n\n  * Fix the tests (#2)\n"
+	changes, err := parseChangelogFile(ChangelogFormatHistory, history)
+	assert.NoError(t, err)
+
+	notes, ok := changes.VersionNotes(unreleasedVersion, historyCategories.internalSections())
+	assert.True(t, ok)
+	assert.Equal(t, "### Bug Fixes\n\n  * Fix a thing (#1)", notes)
+	assert.Equal(t, history, changes.String())
+}
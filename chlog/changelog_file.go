@@ -0,0 +1,101 @@
+package chlog
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/parkr/changelog"
+)
+
+// unreleasedVersion is the name of the unreleased version, whatever the
+// changelog format calls it.
+const unreleasedVersion = "HEAD"
+
+// changelogFile is a parsed changelog, in any of the supported formats.
+type changelogFile interface {
+	// AddLine adds the line to the unreleased version, in the given section,
+	// or directly to the version if the section is changeSectionLabelNone.
+	AddLine(section string, line *changelog.ChangeLine)
+	// HasReference returns true if the version has a line with the reference.
+	HasReference(version, reference string) bool
+	// VersionNotes returns the changes for the version, without its heading
+	// or the excluded sections.
+	VersionNotes(version string, excludedSections []string) (string, bool)
+	// Release turns the unreleased changes into the given version. It
+	// returns false if there are no unreleased changes.
+	Release(version, date string) bool
+	// String renders the changelog as markdown.
+	String() string
+}
+
+// parseChangelogFile parses the contents of a changelog in the given format.
+func parseChangelogFile(format, contents string) (changelogFile, error) {
+	switch format {
+	case ChangelogFormatHistory:
+		changes, err := parseChangelog(contents)
+		if err != nil {
+			return nil, err
+		}
+		return historyChangelog{changes}, nil
+	case ChangelogFormatKeepAChangelog:
+		return parseKeepAChangelog(contents), nil
+	default:
+		return nil, fmt.Errorf("unknown changelog format %q", format)
+	}
+}
+
+// historyChangelog is a History.markdown file as parkr/changelog parses it.
+type historyChangelog struct {
+	*changelog.Changelog
+}
+
+func (c historyChangelog) AddLine(section string, line *changelog.ChangeLine) {
+	if section == changeSectionLabelNone {
+		c.AddLineToVersion(unreleasedVersion, line)
+	} else {
+		c.AddLineToSubsection(unreleasedVersion, section, line)
+	}
+}
+
+func (c historyChangelog) HasReference(version, reference string) bool {
+	return versionHasReference(c.GetVersion(version), reference)
+}
+
+func (c historyChangelog) VersionNotes(version string, excludedSections []string) (string, bool) {
+	versionLog := c.GetVersion(version)
+	if versionLog == nil {
+		return "", false
+	}
+	included := *versionLog
+	included.Subsections = nil
+	for _, subsection := range versionLog.Subsections {
+		if !containsSection(excludedSections, subsection.Name) {
+			included.Subsections = append(included.Subsections, subsection)
+		}
+	}
+	return strings.Join(strings.SplitN(included.String(), "\n\n", 2)[1:], "\n"), true
+}
+
+func (c historyChangelog) Release(version, date string) bool {
+	versionLog := c.GetVersion(unreleasedVersion)
+	if versionLog == nil {
+		return false
+	}
+	versionLog.Version, versionLog.Date = version, date
+	return true
+}
+
+func containsSection(sections []string, section string) bool {
+	for _, s := range sections {
+		if strings.EqualFold(s, section) {
+			return true
+		}
+	}
+	return false
+}
+
+// referenceRegexp matches the reference as a whole, so #12 doesn't match #123.
+func referenceRegexp(reference string) *regexp.Regexp {
+	return regexp.MustCompile(regexp.QuoteMeta(reference) + `\b`)
+}
@@ -5,6 +5,9 @@ import (
 	"github.com/jekyll/jekyllbot/ctx"
 )
 
+// CloseMilestoneOnRelease closes the milestone for a published release and
+// creates the milestones for the next patch and minor versions. Anything
+// still open in the released milestone moves to the upcoming one.
 func CloseMilestoneOnRelease(context *ctx.Context, payload interface{}) error {
 	release, ok := payload.(*github.ReleaseEvent)
 	if !ok {
@@ -19,29 +22,87 @@ func CloseMilestoneOnRelease(context *ctx.Context, payload interface{}) error {
 		return context.NewError("chlog.CloseMilestoneOnRelease: a prerelease or draft release")
 	}
 
-	owner, repo := *release.Repo.Owner.Login, *release.Repo.Name
+	owner, repo, tag := *release.Repo.Owner.Login, *release.Repo.Name, *release.Release.TagName
 
-	milestones, _, err := context.GitHub.Issues.ListMilestones(context.Context(), owner, repo, &github.MilestoneListOptions{
-		State:       "open",
-		ListOptions: github.ListOptions{Page: 0, PerPage: 200},
-	})
+	milestones, err := openMilestones(context, owner, repo)
 	if err != nil {
 		return context.NewError("chlog.CloseMilestoneOnRelease: couldn't fetch milestones for %s/%s: %+v", owner, repo, err)
 	}
 
-	for _, milestone := range milestones {
-		if *milestone.Title == *release.Release.TagName {
-			context.Log("chlog.CloseMilestoneOnRelease: found milestone (%d)", *milestone.Number)
+	released := findMilestone(milestones, tag)
+	titleStyle := tag
+	if released != nil {
+		titleStyle = released.GetTitle()
+	}
 
-			_, _, err := context.GitHub.Issues.EditMilestone(
-				context.Context(), owner, repo, *milestone.Number, &github.Milestone{State: github.String("closed")})
+	if releasedVersion := milestoneVersion(tag); releasedVersion != nil {
+		for _, title := range nextMilestoneTitles(tag, titleStyle) {
+			if findMilestone(milestones, title) != nil {
+				continue
+			}
+			milestone, _, err := context.GitHub.Issues.CreateMilestone(context.Context(), owner, repo, &github.Milestone{Title: github.String(title)})
 			if err != nil {
-				return context.NewError("chlog.CloseMilestoneOnRelease: couldn't close milestone for %s/%s: %+v", owner, repo, err)
+				context.Log("chlog.CloseMilestoneOnRelease: couldn't create milestone '%s' on %s/%s: %+v", title, owner, repo, err)
+				continue
+			}
+			context.Log("chlog.CloseMilestoneOnRelease: created milestone '%s' (%d)", title, milestone.GetNumber())
+			milestones = append(milestones, milestone)
+		}
+
+		if released != nil {
+			if upcoming := upcomingMilestone(milestones, releasedVersion); upcoming != nil {
+				if err := moveOpenIssues(context, owner, repo, released, upcoming); err != nil {
+					context.Log("chlog.CloseMilestoneOnRelease: couldn't move open issues to '%s' on %s/%s: %+v", upcoming.GetTitle(), owner, repo, err)
+				}
 			}
 		}
 	}
 
-	context.Log("chlog.CloseMilestoneOnRelease: no milestone with title '%s' on %s/%s", *release.Release.TagName, owner, repo)
+	if released == nil {
+		context.Log("chlog.CloseMilestoneOnRelease: no milestone with title '%s' on %s/%s", tag, owner, repo)
+		return nil
+	}
 
+	context.Log("chlog.CloseMilestoneOnRelease: found milestone (%d)", released.GetNumber())
+	_, _, err = context.GitHub.Issues.EditMilestone(
+		context.Context(), owner, repo, released.GetNumber(), &github.Milestone{State: github.String("closed")})
+	if err != nil {
+		return context.NewError("chlog.CloseMilestoneOnRelease: couldn't close milestone for %s/%s: %+v", owner, repo, err)
+	}
+	context.Log("chlog.CloseMilestoneOnRelease: closed milestone '%s' on %s/%s", released.GetTitle(), owner, repo)
+
+	return nil
+}
+
+// nextMilestoneTitles returns the titles of the next patch and minor
+// milestones after the released version, with a leading "v" if the
+// titleStyle has one.
+func nextMilestoneTitles(released, titleStyle string) []string {
+	prefix := ""
+	if len(titleStyle) > 0 && titleStyle[0] == 'v' {
+		prefix = "v"
+	}
+	titles := []string{}
+	for _, bump := range []string{"patch", "minor"} {
+		if next, err := nextVersion(released, bump); err == nil {
+			titles = append(titles, prefix+next)
+		}
+	}
+	return titles
+}
+
+// moveOpenIssues moves the open issues and PRs in one milestone to another.
+func moveOpenIssues(context *ctx.Context, owner, repo string, from, to *github.Milestone) error {
+	issues, err := openIssuesInMilestone(context, owner, repo, from.GetNumber())
+	if err != nil {
+		return err
+	}
+	for _, issue := range issues {
+		_, _, err := context.GitHub.Issues.Edit(context.Context(), owner, repo, issue.GetNumber(), &github.IssueRequest{Milestone: to.Number})
+		if err != nil {
+			return err
+		}
+		context.Log("chlog.CloseMilestoneOnRelease: moved %s/%s#%d from '%s' to '%s'", owner, repo, issue.GetNumber(), from.GetTitle(), to.GetTitle())
+	}
 	return nil
 }
@@ -0,0 +1,135 @@
+package chlog
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/ctx"
+	"github.com/jekyll/jekyllbot/labeler"
+	"github.com/jekyll/jekyllbot/releases"
+)
+
+// CommentOnReleasedIssues comments on each PR in a published release, and on
+// each issue those PRs fixed, to say which release it's in. The PRs are the
+// ones with commits between the previous release and this one. It never
+// comments twice about the same release.
+func CommentOnReleasedIssues(context *ctx.Context, payload interface{}) error {
+	release, ok := payload.(*github.ReleaseEvent)
+	if !ok {
+		return context.NewError("chlog.CommentOnReleasedIssues: not a release event")
+	}
+
+	if release.GetAction() != "published" {
+		return context.NewError("chlog.CommentOnReleasedIssues: not a published release")
+	}
+
+	if release.Release.GetPrerelease() || release.Release.GetDraft() {
+		return context.NewError("chlog.CommentOnReleasedIssues: a prerelease or draft release")
+	}
+
+	owner, repo, tag := *release.Repo.Owner.Login, *release.Repo.Name, release.Release.GetTagName()
+
+	previous, err := releases.PreviousRelease(context, githubRepo{owner, repo}, tag)
+	if err != nil {
+		return context.NewError("chlog.CommentOnReleasedIssues: couldn't find the release before %s on %s/%s: %+v", tag, owner, repo, err)
+	}
+	if previous == nil {
+		context.Log("chlog.CommentOnReleasedIssues: %s is the first release of %s/%s, not commenting", tag, owner, repo)
+		return nil
+	}
+
+	prs, err := pullRequestsBetween(context, owner, repo, previous.GetTagName(), tag)
+	if err != nil {
+		return context.NewError("chlog.CommentOnReleasedIssues: couldn't find the pull requests in %s on %s/%s: %+v", tag, owner, repo, err)
+	}
+
+	body := releasedComment(tag, release.Release.GetHTMLURL())
+	for _, number := range releasedIssueNumbers(prs) {
+		if err := commentOnce(context, owner, repo, number, body); err != nil {
+			context.Log("chlog.CommentOnReleasedIssues: couldn't comment on %s/%s#%d: %+v", owner, repo, number, err)
+		}
+	}
+
+	return nil
+}
+
+func releasedComment(tag, url string) string {
+	return fmt.Sprintf("This was released in [%s](%s). :tada:", tag, url)
+}
+
+// releasedIssueNumbers returns the PRs and the issues they fixed, in order.
+func releasedIssueNumbers(prs []*github.PullRequest) []int {
+	seen := map[int]bool{}
+	numbers := []int{}
+	add := func(number int) {
+		if !seen[number] {
+			seen[number] = true
+			numbers = append(numbers, number)
+		}
+	}
+	for _, pr := range prs {
+		add(pr.GetNumber())
+		for _, issue := range labeler.LinkedIssues(pr.GetBody()) {
+			add(issue)
+		}
+	}
+	sort.Ints(numbers)
+	return numbers
+}
+
+// pullRequestsBetween returns the merged PRs with commits between the base
+// and head refs.
+func pullRequestsBetween(context *ctx.Context, owner, repo, base, head string) ([]*github.PullRequest, error) {
+	seen := map[int]bool{}
+	prs := []*github.PullRequest{}
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		comparison, resp, err := context.GitHub.Repositories.CompareCommits(context.Context(), owner, repo, base, head, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, commit := range comparison.Commits {
+			commitPRs, _, err := context.GitHub.PullRequests.ListPullRequestsWithCommit(context.Context(), owner, repo, commit.GetSHA(), nil)
+			if err != nil {
+				return nil, err
+			}
+			for _, pr := range commitPRs {
+				if pr.MergedAt == nil || seen[pr.GetNumber()] {
+					continue
+				}
+				seen[pr.GetNumber()] = true
+				prs = append(prs, pr)
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return prs, nil
+}
+
+// commentOnce comments on the issue unless the same comment is already there.
+func commentOnce(context *ctx.Context, owner, repo string, number int, body string) error {
+	opts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		comments, resp, err := context.GitHub.Issues.ListComments(context.Context(), owner, repo, number, opts)
+		if err != nil {
+			return err
+		}
+		for _, comment := range comments {
+			if strings.TrimSpace(comment.GetBody()) == body {
+				return nil
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.ListOptions.Page = resp.NextPage
+	}
+
+	_, _, err := context.GitHub.Issues.CreateComment(context.Context(), owner, repo, number, &github.IssueComment{Body: github.String(body)})
+	return err
+}
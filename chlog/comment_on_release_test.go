@@ -0,0 +1,73 @@
+package chlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReleasedIssueNumbers(t *testing.T) {
+	prs := []*github.PullRequest{
+		{Number: github.Int(12), Body: github.String("Fixes #3. Closes #10")},
+		{Number: github.Int(11), Body: github.String("Resolves #3")},
+		{Number: github.Int(13)},
+	}
+	assert.Equal(t, []int{3, 10, 11, 12, 13}, releasedIssueNumbers(prs))
+}
+
+func TestCommentOnReleasedIssues(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+
+	mux.HandleFunc("/repos/o/r/releases", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"tag_name":"v1.1.0"},{"tag_name":"v1.0.0"},{"tag_name":"v1.1.0-rc1","prerelease":true},{"tag_name":"v0.9.0"}]`)
+	})
+	mux.HandleFunc("/repos/o/r/compare/v1.0.0...v1.1.0", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"commits":[{"sha":"a"},{"sha":"b"}]}`)
+	})
+	mux.HandleFunc("/repos/o/r/commits/a/pulls", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"number":5,"merged_at":"2016-01-01T00:00:00Z","body":"Fixes #2"},{"number":6}]`)
+	})
+	mux.HandleFunc("/repos/o/r/commits/b/pulls", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"number":5,"merged_at":"2016-01-01T00:00:00Z","body":"Fixes #2"}]`)
+	})
+
+	body := "This was released in [v1.1.0](https://github.com/o/r/releases/tag/v1.1.0). :tada:"
+	commented := []int{}
+	for _, number := range []int{2, 5} {
+		number := number
+		mux.HandleFunc(fmt.Sprintf("/repos/o/r/issues/%d/comments", number), func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case "GET":
+				if number == 2 {
+					fmt.Fprintf(w, `[{"body":%q}]`, body)
+				} else {
+					fmt.Fprint(w, `[{"body":"Thanks!"}]`)
+				}
+			case "POST":
+				comment := new(github.IssueComment)
+				json.NewDecoder(r.Body).Decode(comment)
+				assert.Equal(t, body, comment.GetBody())
+				commented = append(commented, number)
+				fmt.Fprint(w, `{}`)
+			}
+		})
+	}
+
+	err := CommentOnReleasedIssues(context, &github.ReleaseEvent{
+		Action: github.String("published"),
+		Release: &github.RepositoryRelease{
+			TagName: github.String("v1.1.0"),
+			HTMLURL: github.String("https://github.com/o/r/releases/tag/v1.1.0"),
+		},
+		Repo: &github.Repository{Owner: &github.User{Login: github.String("o")}, Name: github.String("r")},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{5}, commented)
+}
@@ -0,0 +1,125 @@
+package chlog
+
+import (
+	"regexp"
+	"sync"
+)
+
+const (
+	// ChangelogFormatHistory is a History.markdown as parkr/changelog reads
+	// and writes it, with "## HEAD" for unreleased changes.
+	ChangelogFormatHistory = "history"
+	// ChangelogFormatKeepAChangelog is a CHANGELOG.md in the format described
+	// at https://keepachangelog.com, with "## [Unreleased]" for unreleased
+	// changes.
+	ChangelogFormatKeepAChangelog = "keep-a-changelog"
+)
+
+var (
+	// defaultMergeMethods are allowed when a repo doesn't say otherwise.
+	// The first one is used if the merge command doesn't specify one.
+	defaultMergeMethods = []string{"squash", "merge", "rebase"}
+
+	repoConfigs = repoConfigMap{data: make(map[string]RepoConfig)}
+)
+
+// RepoConfig customizes how chlog behaves for a single repo.
+type RepoConfig struct {
+	// The merge methods the merge command may use, out of "squash",
+	// "merge" and "rebase". The first is used when the command doesn't
+	// ask for one. Defaults to all three, preferring squash.
+	MergeMethods []string
+
+	// The path to the changelog in the repo. Defaults to "History.markdown",
+	// or "CHANGELOG.md" for the Keep a Changelog format.
+	ChangelogFile string
+	// The format of the changelog. Defaults to ChangelogFormatHistory.
+	ChangelogFormat string
+	// The changelog categories the merge command accepts. Defaults to
+	// historyCategories, or keepAChangelogCategories for the Keep a
+	// Changelog format.
+	Categories []ChangelogCategory
+
+	// Whether to credit the PR author on each changelog line, like
+	// "Fix the thing (@parkr) (#123)".
+	CreditAuthors bool
+	// PRs with this label are left out of the changelog. Defaults to
+	// "skip-changelog".
+	SkipChangelogLabel string
+
+	// The file the release command bumps the version in. Defaults to
+	// "lib/<repo>/version.rb".
+	VersionFile string
+
+	// The tags which CreateReleaseOnTagHandler makes releases for. The first
+	// group of the first matching pattern is the version. Versions like
+	// 1.2.3.pre.rc1 and 1.2.3-rc.1 are released as prereleases. Defaults to
+	// vX.Y.Z, vX.Y.Z.pre.betaN and vX.Y.Z-rc.N style tags.
+	TagPatterns []*regexp.Regexp
+	// Whether releases are created as drafts, for a human to review and
+	// publish.
+	DraftReleases bool
+
+	// Whether PRs wait for the "<owner>/lgtm" status or check run before
+	// they're merged, even if it hasn't been posted yet. Set this for the
+	// repos the lgtm handler is enabled for.
+	RequireLGTM bool
+}
+
+type repoConfigMap struct {
+	sync.RWMutex // protects 'data'
+	data         map[string]RepoConfig
+}
+
+// SetRepoConfig customizes chlog's behaviour for the given repo.
+func SetRepoConfig(owner, repo string, config RepoConfig) {
+	repoConfigs.Lock()
+	defer repoConfigs.Unlock()
+	repoConfigs.data[repoKey(owner, repo)] = config
+}
+
+// configForRepo returns the repo's configuration with defaults filled in.
+func configForRepo(owner, repo string) RepoConfig {
+	repoConfigs.RLock()
+	config := repoConfigs.data[repoKey(owner, repo)]
+	repoConfigs.RUnlock()
+
+	if len(config.MergeMethods) == 0 {
+		config.MergeMethods = defaultMergeMethods
+	}
+	if config.ChangelogFormat == "" {
+		config.ChangelogFormat = ChangelogFormatHistory
+	}
+	if config.ChangelogFile == "" {
+		config.ChangelogFile = "History.markdown"
+		if config.ChangelogFormat == ChangelogFormatKeepAChangelog {
+			config.ChangelogFile = "CHANGELOG.md"
+		}
+	}
+	if len(config.Categories) == 0 {
+		config.Categories = historyCategories
+		if config.ChangelogFormat == ChangelogFormatKeepAChangelog {
+			config.Categories = keepAChangelogCategories
+		}
+	}
+	if len(config.TagPatterns) == 0 {
+		config.TagPatterns = defaultTagPatterns
+	}
+	if config.VersionFile == "" {
+		config.VersionFile = "lib/" + repo + "/version.rb"
+	}
+	if config.SkipChangelogLabel == "" {
+		config.SkipChangelogLabel = defaultSkipChangelogLabel
+	}
+	return config
+}
+
+// allowsMergeMethod returns true if the repo allows the merge method.
+func (c RepoConfig) allowsMergeMethod(method string) bool {
+	for _, allowed := range c.MergeMethods {
+		if allowed == method {
+			return true
+		}
+	}
+	return false
+}
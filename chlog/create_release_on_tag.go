@@ -1,14 +1,29 @@
 package chlog
 
 import (
+	"fmt"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/google/go-github/v73/github"
 	"github.com/jekyll/jekyllbot/ctx"
+	"github.com/jekyll/jekyllbot/releases"
 )
 
-var versionTagRegexp = regexp.MustCompile(`v(\d+\.\d+\.\d+)(\.pre\.(beta|rc)\d+)?`)
+var (
+	versionTagRegexp = regexp.MustCompile(`v(\d+\.\d+\.\d+(?:\.pre\.(?:beta|rc)\d+)?)`)
+
+	// semverPrereleaseTagRegexp matches tags like v1.2.3-rc.1 and v1.2.3-beta2.
+	semverPrereleaseTagRegexp = regexp.MustCompile(`^v(\d+\.\d+\.\d+-(?:alpha|beta|pre|rc)\.?\d+)$`)
+
+	// defaultTagPatterns are the release tags understood when a repo
+	// doesn't say otherwise.
+	defaultTagPatterns = []*regexp.Regexp{semverPrereleaseTagRegexp, versionTagRegexp}
+
+	pullRequestReferenceRegexp = regexp.MustCompile(`\(#(\d+)\)`)
+)
 
 func CreateReleaseOnTagHandler(context *ctx.Context, payload interface{}) error {
 	create, ok := payload.(*github.CreateEvent)
@@ -20,33 +35,44 @@ func CreateReleaseOnTagHandler(context *ctx.Context, payload interface{}) error
 		return context.NewError("chlog.CreateReleaseOnTagHandler: not a tag create event")
 	}
 
-	version := extractVersion(*create.Ref)
+	owner, name := *create.Repo.Owner.Login, *create.Repo.Name
+	config := configForRepo(owner, name)
+
+	version := extractVersionWithPatterns(config.TagPatterns, *create.Ref)
 	if version == "" {
 		return context.NewError("chlog.CreateReleaseOnTagHandler: not a version tag (%s)", *create.Ref)
 	}
+	isPreRelease := isPrereleaseVersion(version)
 
-	isPreRelease := strings.Index(version, ".pre") >= 0
-	desiredRef := version
-	if isPreRelease {
-		// Working with a pre-release. Use HEAD.
-		desiredRef = "HEAD"
+	// Read the changelog and pull out the notes for this version. Internal
+	// changes are of no interest to users, so leave them out.
+	historyFileContents, _, err := getHistoryContents(context, owner, name)
+	if err != nil {
+		return context.NewError("chlog.CreateReleaseOnTagHandler: could not read %s: %v", config.ChangelogFile, err)
 	}
-
-	owner, name := *create.Repo.Owner.Login, *create.Repo.Name
-
-	// Read History.markdown, add line to appropriate change section
-	historyFileContents, _ := getHistoryContents(context, owner, name)
-	changes, err := parseChangelog(historyFileContents)
+	changes, err := parseChangelogFile(config.ChangelogFormat, historyFileContents)
 	if err != nil {
-		return context.NewError("chlog.CreateReleaseOnTagHandler: could not parse history file: %v", err)
+		return context.NewError("chlog.CreateReleaseOnTagHandler: could not parse %s: %v", config.ChangelogFile, err)
 	}
-
-	versionLog := changes.GetVersion(desiredRef)
-	if versionLog == nil {
-		return context.NewError("chlog.CreateReleaseOnTagHandler: no '%s' version in history file", desiredRef)
+	excluded := changelogCategories(config.Categories).internalSections()
+	releaseBodyForVersion, ok := changes.VersionNotes(version, excluded)
+	if !ok && isPreRelease {
+		// Working with a pre-release. Use the unreleased changes.
+		releaseBodyForVersion, ok = changes.VersionNotes(unreleasedVersion, excluded)
+	}
+	if !ok {
+		context.Log("chlog.CreateReleaseOnTagHandler: no '%s' version in %s, generating notes from merged pull requests", version, config.ChangelogFile)
+		releaseBodyForVersion, err = notesFromMergedPullRequests(context, owner, name, config)
+		if err != nil {
+			return context.NewError("chlog.CreateReleaseOnTagHandler: no '%s' version in %s, and couldn't generate notes: %v", version, config.ChangelogFile, err)
+		}
 	}
 
-	releaseBodyForVersion := strings.Join(strings.SplitN(versionLog.String(), "\n\n", 2)[1:], "\n")
+	contributors, err := contributorsTo(context, owner, name, releaseBodyForVersion)
+	if err != nil {
+		context.Log("chlog.CreateReleaseOnTagHandler: couldn't find contributors for %s: %v", version, err)
+	}
+	releaseBodyForVersion += contributorsSection(contributors)
 
 	_, _, err = context.GitHub.Repositories.CreateRelease(
 		context.Context(),
@@ -55,19 +81,105 @@ func CreateReleaseOnTagHandler(context *ctx.Context, payload interface{}) error
 			TagName:    create.Ref,
 			Name:       create.Ref,
 			Body:       github.String(releaseBodyForVersion),
-			Draft:      github.Bool(false),
+			Draft:      github.Bool(config.DraftReleases),
 			Prerelease: github.Bool(isPreRelease),
 		})
 	if err != nil {
-		context.NewError("chlog.CreateReleaseOnTagHandler: error creating release: %v", err)
+		return context.NewError("chlog.CreateReleaseOnTagHandler: error creating release: %v", err)
 	}
 
 	return nil
 }
 
 func extractVersion(tag string) string {
-	if versionTagRegexp.MatchString(tag) {
-		return strings.Replace(tag, "v", "", 1)
+	return extractVersionWithPatterns(defaultTagPatterns, tag)
+}
+
+// extractVersionWithPatterns returns the version in the tag, which is the
+// first group of the first matching pattern, or "" if none match.
+func extractVersionWithPatterns(patterns []*regexp.Regexp, tag string) string {
+	for _, pattern := range patterns {
+		if matches := pattern.FindStringSubmatch(tag); matches != nil && len(matches) > 1 {
+			return matches[1]
+		}
 	}
 	return ""
 }
+
+// isPrereleaseVersion returns true for versions like 1.2.3.pre.rc1 and
+// 1.2.3-rc.1.
+func isPrereleaseVersion(version string) bool {
+	return strings.Contains(version, ".pre") || strings.Contains(version, "-")
+}
+
+// notesFromMergedPullRequests generates release notes from the PRs merged
+// since the latest release, for when the changelog has nothing to say.
+func notesFromMergedPullRequests(context *ctx.Context, owner, repo string, config RepoConfig) (string, error) {
+	latestRelease, err := releases.LatestRelease(context, githubRepo{owner, repo})
+	if err != nil {
+		return "", err
+	}
+	if latestRelease == nil {
+		return "", fmt.Errorf("no previous release to start from")
+	}
+
+	merged, err := pullRequestsMergedSince(context, owner, repo, defaultBranch(context, owner, repo), latestRelease.GetCreatedAt().Time)
+	if err != nil {
+		return "", err
+	}
+
+	changes, _ := parseChangelogFile(config.ChangelogFormat, "")
+	categories := changelogCategories(config.Categories)
+	for _, pr := range merged {
+		req := mergeAndLabelRequest{
+			Owner: owner, Repo: repo, PullNumber: pr.GetNumber(),
+			ChangeSectionLabel: categories.sectionForLabels(pr.Labels),
+		}
+		if entry := newChangelogEntry(config, req, pr); entry.Skip == "" {
+			changes.AddLine(entry.Section, entry.Line)
+		}
+	}
+
+	notes, _ := changes.VersionNotes(unreleasedVersion, categories.internalSections())
+	return notes, nil
+}
+
+// contributorsTo returns the authors of the PRs referenced in the notes,
+// sorted, leaving out bots. PRs which can't be fetched are skipped, and the
+// last error is returned.
+func contributorsTo(context *ctx.Context, owner, repo, notes string) ([]string, error) {
+	var lastErr error
+	seen := map[string]bool{}
+	contributors := []string{}
+	for _, matches := range pullRequestReferenceRegexp.FindAllStringSubmatch(notes, -1) {
+		number, _ := strconv.Atoi(matches[1])
+		issue, _, err := context.GitHub.Issues.Get(context.Context(), owner, repo, number)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		login := issue.GetUser().GetLogin()
+		if login == "" || seen[login] || issue.GetUser().GetType() == "Bot" {
+			continue
+		}
+		seen[login] = true
+		contributors = append(contributors, login)
+	}
+	sort.Slice(contributors, func(i, j int) bool {
+		return strings.ToLower(contributors[i]) < strings.ToLower(contributors[j])
+	})
+	return contributors, lastErr
+}
+
+// contributorsSection renders the contributors as a section of the
+// release notes.
+func contributorsSection(contributors []string) string {
+	if len(contributors) == 0 {
+		return ""
+	}
+	lines := make([]string, len(contributors))
+	for i, login := range contributors {
+		lines[i] = "- @" + login
+	}
+	return "\n\n### Contributors\n\n" + strings.Join(lines, "\n")
+}
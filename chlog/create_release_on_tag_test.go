@@ -1,7 +1,16 @@
 package chlog
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
 	"testing"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/ctx"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestVersionTagRegexpMatchString(t *testing.T) {
@@ -33,3 +42,72 @@ func TestExtractVersion(t *testing.T) {
 		}
 	}
 }
+
+func TestExtractVersionWithPatterns(t *testing.T) {
+	cases := map[string]string{
+		"v1.2.3-rc.1":  "1.2.3-rc.1",
+		"v1.2.3-beta2": "1.2.3-beta2",
+		"v1.2.3":       "1.2.3",
+		"release-1":    "",
+	}
+	for input, expected := range cases {
+		assert.Equal(t, expected, extractVersionWithPatterns(defaultTagPatterns, input), "for %q", input)
+	}
+
+	custom := []*regexp.Regexp{regexp.MustCompile(`^release-(\d+\.\d+)$`)}
+	assert.Equal(t, "1.2", extractVersionWithPatterns(custom, "release-1.2"))
+	assert.Equal(t, "", extractVersionWithPatterns(custom, "v1.2.3"))
+
+	assert.True(t, isPrereleaseVersion("1.2.3-rc.1"))
+	assert.True(t, isPrereleaseVersion("3.2.0.pre.beta12"))
+	assert.False(t, isPrereleaseVersion("1.2.3"))
+}
+
+func TestCreateReleaseOnTagHandler(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+	SetRepoConfig("o", "drafts", RepoConfig{DraftReleases: true})
+
+	mux.HandleFunc("/repos/o/drafts", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"default_branch":"main"}`)
+	})
+	mux.HandleFunc("/repos/o/drafts/contents/History.markdown", func(w http.ResponseWriter, r *http.Request) {
+		history := "## 1.1.0 / 2016-02-01\n\n### Bug Fixes\n\n  * Fix a thing (#2)\n  * Fix another (#3)\n\n### Development Fixes\n\n  * Fix the tests (#4)\n"
+		json.NewEncoder(w).Encode(&github.RepositoryContent{
+			Content: github.String(base64.StdEncoding.EncodeToString([]byte(history))),
+			SHA:     github.String("sha1"),
+		})
+	})
+	authors := map[int]string{
+		2: `{"login":"zoe","type":"User"}`,
+		3: `{"login":"Alice","type":"User"}`,
+		4: `{"login":"dependabot[bot]","type":"Bot"}`,
+	}
+	for number, author := range authors {
+		author := author
+		mux.HandleFunc(fmt.Sprintf("/repos/o/drafts/issues/%d", number), func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"user":%s}`, author)
+		})
+	}
+	created := false
+	mux.HandleFunc("/repos/o/drafts/releases", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+		release := new(github.RepositoryRelease)
+		json.NewDecoder(r.Body).Decode(release)
+		assert.True(t, release.GetDraft())
+		assert.False(t, release.GetPrerelease())
+		assert.Equal(t, "### Bug Fixes\n\n  * Fix a thing (#2)\n  * Fix another (#3)\n\n### Contributors\n\n- @Alice\n- @zoe", release.GetBody())
+		created = true
+		http.Error(w, `{"message":"Validation Failed"}`, http.StatusUnprocessableEntity)
+	})
+
+	err := CreateReleaseOnTagHandler(context, &github.CreateEvent{
+		RefType: github.String("tag"),
+		Ref:     github.String("v1.1.0"),
+		Repo:    &github.Repository{Owner: &github.User{Login: github.String("o")}, Name: github.String("drafts")},
+	})
+	assert.True(t, created)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "error creating release")
+}
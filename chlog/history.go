@@ -0,0 +1,118 @@
+package chlog
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/ctx"
+)
+
+const maxHistoryCommitAttempts = 5
+
+var (
+	historyLocks = repoLocks{locks: make(map[string]*sync.Mutex)}
+
+	// historyRetryDelay is how long to wait before re-reading the history
+	// file after a conflict. It grows with each attempt.
+	historyRetryDelay = 500 * time.Millisecond
+)
+
+// repoLocks hands out one mutex per repo so that only one History update
+// per repo is in flight at a time.
+type repoLocks struct {
+	sync.Mutex // protects 'locks'
+	locks      map[string]*sync.Mutex
+}
+
+func (l *repoLocks) forRepo(owner, repo string) *sync.Mutex {
+	l.Lock()
+	defer l.Unlock()
+	key := repoKey(owner, repo)
+	if _, ok := l.locks[key]; !ok {
+		l.locks[key] = &sync.Mutex{}
+	}
+	return l.locks[key]
+}
+
+// historyUpdate is the outcome of updateHistory.
+type historyUpdate struct {
+	// The commit which updated the history file, if one was made.
+	Commit *github.Commit
+	// The number of times the update was attempted.
+	Attempts int
+	// The path of the changelog which was updated.
+	File string
+}
+
+// updateHistory reads the repo's changelog, applies the change and commits
+// it. Updates to the same repo are serialized. If the file changed
+// underneath us (a 409 from the API), it is re-read and the change
+// re-applied, up to maxHistoryCommitAttempts times. If the change produces
+// no difference, nothing is committed.
+func updateHistory(context *ctx.Context, owner, repo string, number int, change func(changes changelogFile)) (historyUpdate, error) {
+	lock := historyLocks.forRepo(owner, repo)
+	lock.Lock()
+	defer lock.Unlock()
+
+	config := configForRepo(owner, repo)
+	update := historyUpdate{File: config.ChangelogFile}
+	for {
+		update.Attempts++
+
+		historyFileContents, historySHA, err := getHistoryContents(context, owner, repo)
+		if err != nil {
+			return update, err
+		}
+		changes, err := parseChangelogFile(config.ChangelogFormat, historyFileContents)
+		if err != nil {
+			return update, err
+		}
+		before := changes.String()
+		change(changes)
+		newHistoryFileContents := changes.String()
+		if newHistoryFileContents == before {
+			return update, nil
+		}
+
+		response, err := commitHistoryFile(context, historySHA, owner, repo, number, newHistoryFileContents)
+		if err == nil {
+			update.Commit = &response.Commit
+			return update, nil
+		}
+
+		if !isConflict(err) || update.Attempts >= maxHistoryCommitAttempts {
+			return update, err
+		}
+
+		context.Log("chlog: %s on %s/%s changed underneath us (attempt %d), retrying", config.ChangelogFile, owner, repo, update.Attempts)
+		time.Sleep(time.Duration(update.Attempts) * historyRetryDelay)
+	}
+}
+
+// isConflict returns true if the error is a 409 Conflict from the API,
+// which is what UpdateFile returns when the given SHA is out of date.
+func isConflict(err error) bool {
+	var errResponse *github.ErrorResponse
+	return errors.As(err, &errResponse) &&
+		errResponse.Response != nil &&
+		errResponse.Response.StatusCode == http.StatusConflict
+}
+
+// historyUpdateMessage describes the outcome of updating the history file
+// for a PR, for a comment on the PR.
+func historyUpdateMessage(update historyUpdate, err error) string {
+	switch {
+	case err != nil && update.Attempts > 1:
+		return fmt.Sprintf("I couldn't add this pull request to %s after %d attempts: %v", update.File, update.Attempts, err)
+	case err != nil:
+		return fmt.Sprintf("I couldn't add this pull request to %s: %v", update.File, err)
+	case update.Commit == nil:
+		return fmt.Sprintf("This pull request was already in %s, so I left it alone.", update.File)
+	default:
+		return fmt.Sprintf("I added this pull request to %s in %s.", update.File, update.Commit.GetHTMLURL())
+	}
+}
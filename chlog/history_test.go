@@ -0,0 +1,117 @@
+package chlog
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateHistoryRetriesOnConflict(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+	historyRetryDelay = 0
+
+	history := "## HEAD\n\n### Bug Fixes\n\n  * Fix a thing (#1)\n"
+	historySHA := "sha1"
+	reads, writes := 0, 0
+
+	mux.HandleFunc("/repos/o/r", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"default_branch":"main"}`)
+	})
+	mux.HandleFunc("/repos/o/r/contents/History.markdown", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			reads++
+			json.NewEncoder(w).Encode(&github.RepositoryContent{
+				Content: github.String(base64.StdEncoding.EncodeToString([]byte(history))),
+				SHA:     github.String(historySHA),
+			})
+		case "PUT":
+			writes++
+			opts := new(github.RepositoryContentFileOptions)
+			json.NewDecoder(r.Body).Decode(opts)
+			if writes == 1 {
+				// Someone else merged a PR in the meantime.
+				history = "## HEAD\n\n### Bug Fixes\n\n  * Fix a thing (#1)\n  * Fix another thing (#2)\n"
+				historySHA = "sha2"
+				http.Error(w, `{"message":"is at sha2 but expected sha1"}`, http.StatusConflict)
+				return
+			}
+			assert.Equal(t, "sha2", opts.GetSHA())
+			assert.Contains(t, string(opts.Content), "Fix another thing (#2)")
+			assert.Contains(t, string(opts.Content), "Fix a third thing (#3)")
+			fmt.Fprint(w, `{"commit":{"sha":"abc123","html_url":"https://github.com/o/r/commit/abc123"}}`)
+		}
+	})
+
+	update, err := updateHistory(context, "o", "r", 3, func(changes changelogFile) {
+		changes.AddLine("Bug Fixes", newChangeLine("Fix a third thing", 3))
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, update.Attempts)
+	assert.Equal(t, 2, reads)
+	assert.Equal(t, 2, writes)
+	assert.Equal(t, "I added this pull request to History.markdown in https://github.com/o/r/commit/abc123.",
+		historyUpdateMessage(update, err))
+}
+
+func TestUpdateHistoryNoChange(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+
+	mux.HandleFunc("/repos/o/r", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"default_branch":"main"}`)
+	})
+	mux.HandleFunc("/repos/o/r/contents/History.markdown", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		json.NewEncoder(w).Encode(&github.RepositoryContent{
+			Content: github.String(base64.StdEncoding.EncodeToString([]byte("## HEAD\n\n  * Thing (#1)\n"))),
+			SHA:     github.String("sha1"),
+		})
+	})
+
+	update, err := updateHistory(context, "o", "r", 1, func(changes changelogFile) {
+		assert.True(t, changes.HasReference(unreleasedVersion, "#1"))
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, update.Commit)
+	assert.Equal(t, "This pull request was already in History.markdown, so I left it alone.", historyUpdateMessage(update, err))
+}
+
+func TestUpdateHistoryReadError(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+
+	mux.HandleFunc("/repos/o/r", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"default_branch":"main"}`)
+	})
+	mux.HandleFunc("/repos/o/r/contents/History.markdown", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		http.Error(w, `{"message":"Server Error"}`, http.StatusInternalServerError)
+	})
+
+	update, err := updateHistory(context, "o", "r", 1, func(changes changelogFile) {
+		t.Fatal("the change shouldn't be applied to a changelog which couldn't be read")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, update.Attempts)
+	assert.Nil(t, update.Commit)
+}
+
+func TestHistoryUpdateMessage(t *testing.T) {
+	err := errors.New("boom")
+	assert.Equal(t, "I couldn't add this pull request to History.markdown: boom",
+		historyUpdateMessage(historyUpdate{Attempts: 1, File: "History.markdown"}, err))
+	assert.Equal(t, "I couldn't add this pull request to History.markdown after 5 attempts: boom",
+		historyUpdateMessage(historyUpdate{Attempts: 5, File: "History.markdown"}, err))
+}
@@ -0,0 +1,218 @@
+package chlog
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/parkr/changelog"
+)
+
+const keepAChangelogUnreleased = "Unreleased"
+
+var (
+	keepAChangelogVersionRegexp = regexp.MustCompile(`^##\s+\[?([^\]\s]+)\]?`)
+	keepAChangelogLinkRegexp    = regexp.MustCompile(`^\[[^\]]+\]:\s`)
+)
+
+// keepAChangelog is a CHANGELOG.md in the Keep a Changelog format:
+//
+//	# Changelog
+//
+//	## [Unreleased]
+//
+//	### Added
+//
+//	- A new thing (#12)
+//
+//	## [1.0.0] - 2017-06-20
+//	...
+//
+//	[Unreleased]: https://github.com/owner/repo/compare/v1.0.0...HEAD
+//
+// Anything it doesn't understand is kept as-is.
+type keepAChangelog struct {
+	// Lines before the first version, like the title.
+	preamble []string
+	versions []*keepAChangelogVersion
+	// Link reference definitions at the end of the file.
+	links []string
+}
+
+type keepAChangelogVersion struct {
+	heading  string
+	name     string
+	lines    []string
+	sections []*keepAChangelogSection
+}
+
+type keepAChangelogSection struct {
+	name  string
+	lines []string
+}
+
+func parseKeepAChangelog(contents string) *keepAChangelog {
+	c := &keepAChangelog{}
+	var version *keepAChangelogVersion
+	var section *keepAChangelogSection
+
+	for _, line := range strings.Split(strings.Replace(contents, "\r\n", "\n", -1), "\n") {
+		switch {
+		case keepAChangelogLinkRegexp.MatchString(line):
+			c.links = append(c.links, line)
+		case keepAChangelogVersionRegexp.MatchString(line):
+			version = &keepAChangelogVersion{
+				heading: line,
+				name:    keepAChangelogVersionRegexp.FindStringSubmatch(line)[1],
+			}
+			section = nil
+			c.versions = append(c.versions, version)
+		case strings.HasPrefix(line, "### ") && version != nil:
+			section = &keepAChangelogSection{name: strings.TrimSpace(strings.TrimPrefix(line, "### "))}
+			version.sections = append(version.sections, section)
+		case section != nil:
+			section.lines = append(section.lines, line)
+		case version != nil:
+			version.lines = append(version.lines, line)
+		default:
+			c.preamble = append(c.preamble, line)
+		}
+	}
+
+	return c
+}
+
+// version returns the named version. HEAD means the Unreleased version.
+func (c *keepAChangelog) version(name string) *keepAChangelogVersion {
+	if name == unreleasedVersion {
+		name = keepAChangelogUnreleased
+	}
+	for _, version := range c.versions {
+		if strings.EqualFold(version.name, name) {
+			return version
+		}
+	}
+	return nil
+}
+
+func (c *keepAChangelog) AddLine(section string, line *changelog.ChangeLine) {
+	version := c.version(unreleasedVersion)
+	if version == nil {
+		version = &keepAChangelogVersion{
+			heading: "## [" + keepAChangelogUnreleased + "]",
+			name:    keepAChangelogUnreleased,
+		}
+		c.versions = append([]*keepAChangelogVersion{version}, c.versions...)
+	}
+
+	entry := "- " + line.Summary
+	if line.Reference != "" {
+		entry += " (" + line.Reference + ")"
+	}
+
+	if section == changeSectionLabelNone {
+		version.lines = append(trimBlankLines(version.lines), entry)
+		return
+	}
+
+	for _, s := range version.sections {
+		if strings.EqualFold(s.name, section) {
+			s.lines = append(trimBlankLines(s.lines), entry)
+			return
+		}
+	}
+	version.sections = append(version.sections, &keepAChangelogSection{name: section, lines: []string{entry}})
+}
+
+func (c *keepAChangelog) HasReference(version, reference string) bool {
+	v := c.version(version)
+	if v == nil {
+		return false
+	}
+	matcher := referenceRegexp(reference)
+	lines := append([]string{}, v.lines...)
+	for _, section := range v.sections {
+		lines = append(lines, section.lines...)
+	}
+	for _, line := range lines {
+		if matcher.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *keepAChangelog) VersionNotes(version string, excludedSections []string) (string, bool) {
+	v := c.version(version)
+	if v == nil {
+		return "", false
+	}
+	included := *v
+	included.sections = nil
+	for _, section := range v.sections {
+		if !containsSection(excludedSections, section.name) {
+			included.sections = append(included.sections, section)
+		}
+	}
+	return strings.Join(included.blocks()[1:], "\n\n"), true
+}
+
+// Release renames the Unreleased version and starts a new, empty one.
+func (c *keepAChangelog) Release(version, date string) bool {
+	v := c.version(unreleasedVersion)
+	if v == nil {
+		return false
+	}
+	v.name = version
+	v.heading = "## [" + version + "] - " + date
+	unreleased := &keepAChangelogVersion{
+		heading: "## [" + keepAChangelogUnreleased + "]",
+		name:    keepAChangelogUnreleased,
+	}
+	for i := range c.versions {
+		if c.versions[i] == v {
+			c.versions = append(c.versions[:i], append([]*keepAChangelogVersion{unreleased}, c.versions[i:]...)...)
+			break
+		}
+	}
+	return true
+}
+
+func (c *keepAChangelog) String() string {
+	blocks := []string{}
+	if preamble := trimBlankLines(c.preamble); len(preamble) > 0 {
+		blocks = append(blocks, strings.Join(preamble, "\n"))
+	}
+	for _, version := range c.versions {
+		blocks = append(blocks, version.blocks()...)
+	}
+	if len(c.links) > 0 {
+		blocks = append(blocks, strings.Join(c.links, "\n"))
+	}
+	return strings.Join(blocks, "\n\n") + "\n"
+}
+
+// blocks returns the version's heading, lines and sections as paragraphs.
+func (v *keepAChangelogVersion) blocks() []string {
+	blocks := []string{v.heading}
+	if lines := trimBlankLines(v.lines); len(lines) > 0 {
+		blocks = append(blocks, strings.Join(lines, "\n"))
+	}
+	for _, section := range v.sections {
+		blocks = append(blocks, "### "+section.name)
+		if lines := trimBlankLines(section.lines); len(lines) > 0 {
+			blocks = append(blocks, strings.Join(lines, "\n"))
+		}
+	}
+	return blocks
+}
+
+// trimBlankLines removes blank lines from the start and end of lines.
+func trimBlankLines(lines []string) []string {
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,81 @@
+package chlog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const keepAChangelogContents = `# Changelog
+
+All notable changes to this project will be documented in this file.
+
+## [Unreleased]
+
+### Fixed
+
+- Fix a thing (#12)
+
+## [1.0.0] - 2017-06-20
+
+### Added
+
+- Initial release (#1)
+
+[Unreleased]: https://github.com/o/r/compare/v1.0.0...HEAD
+[1.0.0]: https://github.com/o/r/releases/tag/v1.0.0
+`
+
+func TestKeepAChangelogRoundTrip(t *testing.T) {
+	changes, err := parseChangelogFile(ChangelogFormatKeepAChangelog, keepAChangelogContents)
+	assert.NoError(t, err)
+	assert.Equal(t, keepAChangelogContents, changes.String())
+}
+
+func TestKeepAChangelogAddLine(t *testing.T) {
+	changes, err := parseChangelogFile(ChangelogFormatKeepAChangelog, keepAChangelogContents)
+	assert.NoError(t, err)
+
+	assert.True(t, changes.HasReference(unreleasedVersion, "#12"))
+	assert.False(t, changes.HasReference(unreleasedVersion, "#1"))
+	assert.True(t, changes.HasReference("1.0.0", "#1"))
+
+	changes.AddLine("Fixed", newChangeLine("Fix another thing", 13))
+	changes.AddLine("Added", newChangeLine("Add <a> thing", 14))
+	notes, ok := changes.VersionNotes(unreleasedVersion, nil)
+	assert.True(t, ok)
+	assert.Equal(t, "### Fixed\n\n- Fix a thing (#12)\n- Fix another thing (#13)\n\n### Added\n\n- Add &lt;a&gt; thing (#14)", notes)
+	assert.Contains(t, changes.String(), "- Add &lt;a&gt; thing (#14)\n\n## [1.0.0] - 2017-06-20")
+
+	notes, ok = changes.VersionNotes("1.0.0", nil)
+	assert.True(t, ok)
+	assert.Equal(t, "### Added\n\n- Initial release (#1)", notes)
+
+	_, ok = changes.VersionNotes("2.0.0", nil)
+	assert.False(t, ok)
+}
+
+func TestKeepAChangelogAddLineWithoutUnreleased(t *testing.T) {
+	changes, err := parseChangelogFile(ChangelogFormatKeepAChangelog, "# Changelog\n\n## [1.0.0]\n\n- Initial release\n")
+	assert.NoError(t, err)
+
+	changes.AddLine("Fixed", newChangeLine("Fix a thing", 2))
+	assert.Equal(t, "# Changelog\n\n## [Unreleased]\n\n### Fixed\n\n- Fix a thing (#2)\n\n## [1.0.0]\n\n- Initial release\n", changes.String())
+}
+
+func TestRepoConfigChangelog(t *testing.T) {
+	config := configForRepo("o", "unconfigured")
+	assert.Equal(t, "History.markdown", config.ChangelogFile)
+	assert.Equal(t, ChangelogFormatHistory, config.ChangelogFormat)
+
+	SetRepoConfig("o", "keep-a-changelog", RepoConfig{ChangelogFormat: ChangelogFormatKeepAChangelog})
+	config = configForRepo("o", "keep-a-changelog")
+	assert.Equal(t, "CHANGELOG.md", config.ChangelogFile)
+	categories := changelogCategories(config.Categories)
+	assert.Equal(t, "Fixed", categories.sectionForLabel(categories.normalizeLabel("bug")))
+	assert.Equal(t, "Added", categories.sectionForLabel(categories.normalizeLabel("feature")))
+
+	req := mergeAndLabelRequest{Owner: "o", Repo: "keep-a-changelog"}
+	req.applyMergeCommand(parseMergeCommand("@jekyllbot: merge +fix"))
+	assert.Equal(t, "Fixed", req.ChangeSectionLabel)
+}
@@ -5,11 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"regexp"
 	"strings"
 	"sync"
-	"text/template"
 
 	"github.com/google/go-github/v73/github"
 	"github.com/jekyll/jekyllbot/auth"
@@ -19,17 +19,26 @@ import (
 
 const changeSectionLabelNone = "none"
 
-// changelogCategory is a changelog category, like "Site Enhancements" and such.
-type changelogCategory struct {
+// ChangelogCategory is a changelog category, like "Site Enhancements" and
+// such. The merge command accepts any label starting with the Prefix, and
+// the PR is filed under the Section and given the Labels. Internal
+// categories are left out of release notes.
+type ChangelogCategory struct {
 	Prefix, Slug, Section string
 	Labels                []string
+	Internal              bool
 }
 
+// changelogCategories is a repo's table of changelog categories.
+type changelogCategories []ChangelogCategory
+
 var (
-	mergeCommentRegexp = regexp.MustCompile("@[a-zA-Z-_]+: (merge|:shipit:|:ship:)( \\+([a-zA-Z-_ ]+))?")
-	mergeOptions       = &github.PullRequestOptions{MergeMethod: "squash"}
+	mergeCommentRegexp     = regexp.MustCompile("@[a-zA-Z-_]+: (merge|:shipit:|:ship:)([^\\n]*)")
+	mergeOptionRegexp      = regexp.MustCompile("^[a-zA-Z-_ ]+")
+	mergeCommitBlockRegexp = regexp.MustCompile("(?s)```commit[ \\t]*\\r?\\n(.*?)```")
 
-	categories = []changelogCategory{
+	// historyCategories are the categories used in History.markdown.
+	historyCategories = changelogCategories{
 		{
 			Prefix:  "major",
 			Slug:    "major-enhancements",
@@ -55,10 +64,11 @@ var (
 			Labels:  []string{"bug", "fix"},
 		},
 		{
-			Prefix:  "dev",
-			Slug:    "development-fixes",
-			Section: "Development Fixes",
-			Labels:  []string{"internal", "fix"},
+			Prefix:   "dev",
+			Slug:     "development-fixes",
+			Section:  "Development Fixes",
+			Labels:   []string{"internal", "fix"},
+			Internal: true,
 		},
 		{
 			Prefix:  "doc",
@@ -79,6 +89,58 @@ var (
 			Labels:  []string{"documentation"},
 		},
 	}
+
+	// keepAChangelogCategories are the categories from https://keepachangelog.com.
+	keepAChangelogCategories = changelogCategories{
+		{
+			Prefix:  "add",
+			Slug:    "added",
+			Section: "Added",
+			Labels:  []string{"feature"},
+		},
+		{
+			Prefix:  "feat",
+			Slug:    "added",
+			Section: "Added",
+			Labels:  []string{"feature"},
+		},
+		{
+			Prefix:  "change",
+			Slug:    "changed",
+			Section: "Changed",
+			Labels:  []string{"enhancement"},
+		},
+		{
+			Prefix:  "deprecat",
+			Slug:    "deprecated",
+			Section: "Deprecated",
+			Labels:  []string{"deprecation"},
+		},
+		{
+			Prefix:  "remove",
+			Slug:    "removed",
+			Section: "Removed",
+			Labels:  []string{"removal"},
+		},
+		{
+			Prefix:  "fix",
+			Slug:    "fixed",
+			Section: "Fixed",
+			Labels:  []string{"bug", "fix"},
+		},
+		{
+			Prefix:  "bug",
+			Slug:    "fixed",
+			Section: "Fixed",
+			Labels:  []string{"bug", "fix"},
+		},
+		{
+			Prefix:  "security",
+			Slug:    "security",
+			Section: "Security",
+			Labels:  []string{"security"},
+		},
+	}
 )
 
 type mergeAndLabelRequest struct {
@@ -90,6 +152,29 @@ type mergeAndLabelRequest struct {
 	CommenterLogin string
 	// The changelog label in which to place the PR in the History/Changelog file
 	ChangeSectionLabel string
+	// The merge method ("squash", "merge" or "rebase"); blank for the repo's default
+	MergeMethod string
+	// The commit title and message to merge with; blank for the defaults
+	CommitTitle, CommitMessage string
+}
+
+// mergeCommand is a parsed "@jekyllbot: merge" comment, which looks like:
+//
+//	@jekyllbot: merge +bug +rebase
+//
+//	```commit
+//	Custom commit title
+//
+//	Custom commit message.
+//	```
+//
+// Each "+option" is either a merge method or a changelog label. The commit
+// block is optional.
+type mergeCommand struct {
+	isReq                      bool
+	label                      string
+	method                     string
+	commitTitle, commitMessage string
 }
 
 func parseIssueCommentEvent(context *ctx.Context, event *github.IssueCommentEvent) (mergeAndLabelRequest, error) {
@@ -102,20 +187,15 @@ func parseIssueCommentEvent(context *ctx.Context, event *github.IssueCommentEven
 
 	req.Owner, req.Repo, req.PullNumber = *event.Repo.Owner.Login, *event.Repo.Name, *event.Issue.Number
 
-	isReq, labelFromComment := parseMergeRequestComment(*event.Comment.Body)
+	command := parseMergeCommand(*event.Comment.Body)
 
 	// Is It a merge request comment?
-	if !isReq {
+	if !command.isReq {
 		return *req, context.NewError("MergeAndLabel: not a merge request comment")
 	}
 
-	// Should it be labeled?
-	if labelFromComment != "" {
-		req.ChangeSectionLabel = sectionForLabel(labelFromComment)
-	} else {
-		req.ChangeSectionLabel = changeSectionLabelNone
-	}
-	fmt.Printf("changeSectionLabel = '%s'\n", req.ChangeSectionLabel)
+	req.applyMergeCommand(command)
+	context.Log("changeSectionLabel = '%s'", req.ChangeSectionLabel)
 
 	req.CommenterLogin = *event.Comment.User.Login
 
@@ -133,22 +213,33 @@ func parsePullRequestReviewEvent(context *ctx.Context, event *github.PullRequest
 
 	req.CommenterLogin = *event.Review.User.Login
 
-	isReq, labelFromComment := parseMergeRequestComment(*event.Review.Body)
+	command := parseMergeCommand(*event.Review.Body)
 
 	// Is It a merge request comment?
-	if !isReq {
+	if !command.isReq {
 		return *req, context.NewError("MergeAndLabel: not a merge request review comment")
 	}
 
+	req.applyMergeCommand(command)
+	context.Log("changeSectionLabel = '%s'", req.ChangeSectionLabel)
+
+	return *req, nil
+}
+
+// applyMergeCommand copies the options from the merge command to the
+// request, looking the label up in the repo's changelog categories.
+func (req *mergeAndLabelRequest) applyMergeCommand(command mergeCommand) {
+	categories := changelogCategories(configForRepo(req.Owner, req.Repo).Categories)
+
 	// Should it be labeled?
-	if labelFromComment != "" {
-		req.ChangeSectionLabel = sectionForLabel(labelFromComment)
+	if command.label != "" {
+		req.ChangeSectionLabel = categories.sectionForLabel(categories.normalizeLabel(command.label))
 	} else {
 		req.ChangeSectionLabel = changeSectionLabelNone
 	}
-	fmt.Printf("changeSectionLabel = '%s'\n", req.ChangeSectionLabel)
 
-	return *req, nil
+	req.MergeMethod = command.method
+	req.CommitTitle, req.CommitMessage = command.commitTitle, command.commitMessage
 }
 
 func parseMergeAndLabelRequest(context *ctx.Context, payload interface{}) (mergeAndLabelRequest, error) {
@@ -171,68 +262,160 @@ func MergeAndLabel(context *ctx.Context, payload interface{}) error {
 		log.Println("MergeAndLabel: received event:", payload)
 	}
 
-	var wg sync.WaitGroup
-
 	owner, repo, number := req.Owner, req.Repo, req.PullNumber
 	ref := fmt.Sprintf("%s/%s#%d", owner, repo, number)
 
 	// Does the user have merge/label abilities?
 	if !auth.CommenterHasPushAccess(context, owner, repo, req.CommenterLogin) {
 		log.Printf("%s isn't authenticated to merge anything on %s/%s", req.CommenterLogin, req.Owner, req.Repo)
+		commentOnPullRequest(context, req, refusalMessage(fmt.Sprintf("@%s doesn't have push access to %s/%s", req.CommenterLogin, owner, repo)))
 		return errors.New("commenter isn't allowed to merge")
 	}
 
-	// Merge
-	commitMsg := fmt.Sprintf("Merge pull request %v", number)
-	_, _, mergeErr := context.GitHub.PullRequests.Merge(context.Context(), owner, repo, number, commitMsg, mergeOptions)
-	if mergeErr != nil {
-		return context.NewError("MergeAndLabel: error merging %s: %v", ref, mergeErr)
+	// Is the merge method allowed here?
+	config := configForRepo(owner, repo)
+	if req.MergeMethod == "" {
+		req.MergeMethod = config.MergeMethods[0]
+	}
+	if !config.allowsMergeMethod(req.MergeMethod) {
+		commentOnPullRequest(context, req, refusalMessage(fmt.Sprintf(
+			"%s/%s doesn't allow the %s merge method (it allows: %s)",
+			owner, repo, req.MergeMethod, strings.Join(config.MergeMethods, ", "))))
+		return context.NewError("MergeAndLabel: merge method %q isn't allowed on %s/%s", req.MergeMethod, owner, repo)
 	}
 
-	// Delete branch
+	// Is it still open?
+	pr, _, err := context.GitHub.PullRequests.Get(context.Context(), owner, repo, number)
+	if err != nil {
+		return context.NewError("MergeAndLabel: error getting PR info %s: %v", ref, err)
+	}
+	if pr.GetMerged() {
+		commentOnPullRequest(context, req, refusalMessage("it has already been merged"))
+		return context.NewError("MergeAndLabel: refusing to merge %s: already merged", ref)
+	}
+	if pr.GetState() != "open" {
+		commentOnPullRequest(context, req, refusalMessage("it is "+pr.GetState()))
+		return context.NewError("MergeAndLabel: refusing to merge %s: it is %s", ref, pr.GetState())
+	}
+
+	// Are the checks green? If they're pending, wait for them in the queue.
+	state, reasons, err := pullRequestChecksState(context, owner, repo, pr)
+	if err != nil {
+		return context.NewError("MergeAndLabel: error getting checks for %s: %v", ref, err)
+	}
+	switch state {
+	case checksStatePending:
+		return enqueueMerge(context, req, reasons)
+	case checksStateFailure:
+		commentOnPullRequest(context, req, refusalMessage(reasons...))
+		return context.NewError("MergeAndLabel: refusing to merge %s: %s", ref, strings.Join(reasons, ", "))
+	}
+
+	summary := &mergeSummary{intro: "Here's what I did:"}
+	err = mergeAndLabel(context, req, summary)
+	commentOnPullRequest(context, req, summary.String())
+	if err == nil && summary.hasFailures() {
+		return context.NewError("MergeAndLabel: merged %s, but some steps failed", ref)
+	}
+	return err
+}
+
+// mergeAndLabel merges the PR, deletes its branch, labels it and adds it
+// to the changelog, recording the outcome of each step in the summary.
+func mergeAndLabel(context *ctx.Context, req mergeAndLabelRequest, summary *mergeSummary) error {
+	var wg sync.WaitGroup
+
+	owner, repo, number := req.Owner, req.Repo, req.PullNumber
+	ref := fmt.Sprintf("%s/%s#%d", owner, repo, number)
+
 	repoInfo, _, getRepoErr := context.GitHub.PullRequests.Get(context.Context(), owner, repo, number)
 	if getRepoErr != nil {
+		summary.failed("I couldn't merge this pull request: %v", getRepoErr)
 		return context.NewError("MergeAndLabel: error getting PR info %s: %v", ref, getRepoErr)
 	}
 
 	if repoInfo == nil {
+		summary.failed("I couldn't merge this pull request: GitHub didn't tell me anything about it.")
 		return context.NewError("MergeAndLabel: tried to get PR, but couldn't. repoInfo was nil.")
 	}
 
+	// Merge
+	config := configForRepo(owner, repo)
+	method := req.MergeMethod
+	if method == "" {
+		method = config.MergeMethods[0]
+	}
+	commitMsg := req.CommitMessage
+	if commitMsg == "" {
+		commitMsg = fmt.Sprintf("Merge pull request %v", number)
+	}
+	if method == "squash" {
+		commits, err := listPullRequestCommits(context, owner, repo, number)
+		if err != nil {
+			context.Log("MergeAndLabel: error listing commits for %s: %v", ref, err)
+		}
+		commitMsg = appendTrailers(commitMsg, coAuthorTrailers(commits, repoInfo.GetUser().GetLogin()))
+	}
+	mergeOptions := &github.PullRequestOptions{MergeMethod: method, CommitTitle: req.CommitTitle}
+	result, _, mergeErr := context.GitHub.PullRequests.Merge(context.Context(), owner, repo, number, commitMsg, mergeOptions)
+	if mergeErr != nil {
+		summary.failed("I couldn't merge this pull request: %v", mergeErr)
+		return context.NewError("MergeAndLabel: error merging %s: %v", ref, mergeErr)
+	}
+	summary.done("I merged this pull request (%s) as %s, as requested by @%s.", method, shortSHA(result.GetSHA()), req.CommenterLogin)
+
 	// Delete branch
 	if deletableRef(repoInfo, owner) {
 		wg.Add(1)
 		go func() {
-			ref := fmt.Sprintf("heads/%s", *repoInfo.Head.Ref)
-			_, deleteBranchErr := context.GitHub.Git.DeleteRef(context.Context(), owner, repo, ref)
+			branch := *repoInfo.Head.Ref
+			_, deleteBranchErr := context.GitHub.Git.DeleteRef(context.Context(), owner, repo, "heads/"+branch)
 			if deleteBranchErr != nil {
-				fmt.Printf("MergeAndLabel: error deleting branch %v\n", mergeErr)
+				context.Log("MergeAndLabel: error deleting branch %s on %s: %v", branch, ref, deleteBranchErr)
+				summary.failed("I couldn't delete the `%s` branch: %v", branch, deleteBranchErr)
+			} else {
+				summary.done("I deleted the `%s` branch.", branch)
 			}
 			wg.Done()
 		}()
 	}
 
+	entry := newChangelogEntry(config, req, repoInfo)
+	if entry.Skip != "" {
+		summary.skipped("I left this pull request out of %s because %s.", config.ChangelogFile, entry.Skip)
+		wg.Wait()
+		return nil
+	}
+
 	wg.Add(1)
 	go func() {
-		err := addLabelsForSubsection(context, owner, repo, number, req.ChangeSectionLabel)
-		if err != nil {
+		labels, err := addLabelsForSubsection(context, owner, repo, number, entry.Section)
+		switch {
+		case err != nil:
 			fmt.Printf("MergeAndLabel: error applying labels: %v\n", err)
+			summary.failed("I couldn't add the %s labels: %v", quotedList(labels), err)
+		case len(labels) > 0:
+			summary.done("I added the %s labels.", quotedList(labels))
 		}
 		wg.Done()
 	}()
 
 	wg.Add(1)
 	go func() {
-		// Read History.markdown, add line to appropriate change section
-		historyFileContents, historySHA := getHistoryContents(context, owner, repo)
-
-		// Add merge reference to history
-		newHistoryFileContents := addMergeReference(historyFileContents, req.ChangeSectionLabel, *repoInfo.Title, number)
-
-		// Commit change to History.markdown
-		commitErr := commitHistoryFile(context, historySHA, owner, repo, number, newHistoryFileContents)
-		if commitErr != nil {
-			fmt.Printf("comments: error committing updated history %v\n", mergeErr)
+		// Add merge reference to the changelog, retrying on conflicts.
+		update, commitErr := updateHistory(context, owner, repo, number, func(changes changelogFile) {
+			if !changes.HasReference(unreleasedVersion, entry.Line.Reference) {
+				changes.AddLine(entry.Section, entry.Line)
+			}
+		})
+		switch {
+		case commitErr != nil:
+			context.Log("MergeAndLabel: error committing updated history for %s: %v", ref, commitErr)
+			summary.failed("%s", historyUpdateMessage(update, commitErr))
+		case update.Commit == nil:
+			summary.skipped("%s", historyUpdateMessage(update, commitErr))
+		default:
+			summary.done("%s", historyUpdateMessage(update, commitErr))
 		}
 		wg.Done()
 	}()
@@ -242,20 +425,111 @@ func MergeAndLabel(context *ctx.Context, payload interface{}) error {
 	return nil
 }
 
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+func quotedList(items []string) string {
+	quoted := make([]string, len(items))
+	for i, item := range items {
+		quoted[i] = "`" + item + "`"
+	}
+	return strings.Join(quoted, ", ")
+}
+
 func parseMergeRequestComment(commentBody string) (bool, string) {
-	matches := mergeCommentRegexp.FindAllStringSubmatch(commentBody, -1)
-	if matches == nil || matches[0] == nil {
-		return false, ""
+	command := parseMergeCommand(commentBody)
+	return command.isReq, normalizeLabel(command.label)
+}
+
+func parseMergeCommand(commentBody string) mergeCommand {
+	matches := mergeCommentRegexp.FindStringSubmatch(commentBody)
+	if matches == nil {
+		return mergeCommand{}
+	}
+
+	command := mergeCommand{isReq: true}
+	options := strings.Split(matches[2], "+")
+	for _, option := range options[1:] {
+		option = strings.TrimSpace(mergeOptionRegexp.FindString(option))
+		if option == "" {
+			continue
+		}
+		option = downcaseAndHyphenize(option)
+		switch option {
+		case "squash", "merge", "rebase":
+			command.method = option
+		default:
+			if command.label == "" {
+				command.label = option
+			}
+		}
 	}
 
-	var label string
-	if len(matches[0]) >= 4 {
-		if labelFromComment := matches[0][3]; labelFromComment != "" {
-			label = downcaseAndHyphenize(labelFromComment)
+	if block := mergeCommitBlockRegexp.FindStringSubmatch(commentBody); block != nil {
+		lines := strings.SplitN(strings.TrimSpace(strings.Replace(block[1], "\r\n", "\n", -1)), "\n", 2)
+		command.commitTitle = strings.TrimSpace(lines[0])
+		if len(lines) > 1 {
+			command.commitMessage = strings.TrimSpace(lines[1])
 		}
 	}
 
-	return true, normalizeLabel(label)
+	return command
+}
+
+func listPullRequestCommits(context *ctx.Context, owner, repo string, number int) ([]*github.RepositoryCommit, error) {
+	var commits []*github.RepositoryCommit
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		page, resp, err := context.GitHub.PullRequests.ListCommits(context.Context(), owner, repo, number, opts)
+		if err != nil {
+			return commits, err
+		}
+		commits = append(commits, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return commits, nil
+}
+
+// coAuthorTrailers returns a Co-authored-by trailer for each distinct
+// author of the commits, other than the PR author, who GitHub credits
+// with the squashed commit anyway.
+func coAuthorTrailers(commits []*github.RepositoryCommit, prAuthor string) []string {
+	trailers := []string{}
+	seen := map[string]bool{}
+	for _, commit := range commits {
+		if prAuthor != "" && strings.EqualFold(commit.GetAuthor().GetLogin(), prAuthor) {
+			continue
+		}
+		author := commit.GetCommit().GetAuthor()
+		if author.GetEmail() == "" || seen[strings.ToLower(author.GetEmail())] {
+			continue
+		}
+		seen[strings.ToLower(author.GetEmail())] = true
+		trailers = append(trailers, fmt.Sprintf("Co-authored-by: %s <%s>", author.GetName(), author.GetEmail()))
+	}
+	return trailers
+}
+
+// appendTrailers adds the trailers to the end of the commit message, leaving
+// out any which are already present.
+func appendTrailers(message string, trailers []string) string {
+	missing := []string{}
+	for _, trailer := range trailers {
+		if !strings.Contains(message, trailer) {
+			missing = append(missing, trailer)
+		}
+	}
+	if len(missing) == 0 {
+		return message
+	}
+	return strings.TrimRight(message, "\n") + "\n\n" + strings.Join(missing, "\n")
 }
 
 func downcaseAndHyphenize(label string) string {
@@ -263,6 +537,18 @@ func downcaseAndHyphenize(label string) string {
 }
 
 func normalizeLabel(label string) string {
+	return historyCategories.normalizeLabel(label)
+}
+
+func sectionForLabel(slug string) string {
+	return historyCategories.sectionForLabel(slug)
+}
+
+func labelsForSubsection(changeSectionLabel string) []string {
+	return historyCategories.labelsForSubsection(changeSectionLabel)
+}
+
+func (categories changelogCategories) normalizeLabel(label string) string {
 	for _, category := range categories {
 		if strings.HasPrefix(label, category.Prefix) {
 			return category.Slug
@@ -272,7 +558,7 @@ func normalizeLabel(label string) string {
 	return label
 }
 
-func sectionForLabel(slug string) string {
+func (categories changelogCategories) sectionForLabel(slug string) string {
 	for _, category := range categories {
 		if slug == category.Slug {
 			return category.Section
@@ -282,7 +568,7 @@ func sectionForLabel(slug string) string {
 	return slug
 }
 
-func labelsForSubsection(changeSectionLabel string) []string {
+func (categories changelogCategories) labelsForSubsection(changeSectionLabel string) []string {
 	for _, category := range categories {
 		if changeSectionLabel == category.Section {
 			return category.Labels
@@ -292,6 +578,38 @@ func labelsForSubsection(changeSectionLabel string) []string {
 	return []string{}
 }
 
+// sectionForLabels returns the section of the category whose labels best
+// match the PR's labels, or changeSectionLabelNone if none match. Ties go
+// to the category listed first.
+func (categories changelogCategories) sectionForLabels(labels []*github.Label) string {
+	section, best := changeSectionLabelNone, 0
+	for _, category := range categories {
+		matches := 0
+		for _, label := range labels {
+			for _, categoryLabel := range category.Labels {
+				if strings.EqualFold(label.GetName(), categoryLabel) {
+					matches++
+				}
+			}
+		}
+		if matches > best {
+			section, best = category.Section, matches
+		}
+	}
+	return section
+}
+
+// internalSections returns the sections of the internal categories.
+func (categories changelogCategories) internalSections() []string {
+	sections := []string{}
+	for _, category := range categories {
+		if category.Internal {
+			sections = append(sections, category.Section)
+		}
+	}
+	return sections
+}
+
 func selectSectionLabel(labels []github.Label) string {
 	for _, label := range labels {
 		if sectionForLabel(*label.Name) != *label.Name {
@@ -306,38 +624,45 @@ func containsChangeLabel(commentBody string) bool {
 	return labelFromComment != ""
 }
 
-func addLabelsForSubsection(context *ctx.Context, owner, repo string, number int, changeSectionLabel string) error {
-	labels := labelsForSubsection(changeSectionLabel)
+// addLabelsForSubsection adds the labels for the changelog section to the
+// PR, and returns them. Not every section has labels.
+func addLabelsForSubsection(context *ctx.Context, owner, repo string, number int, changeSectionLabel string) ([]string, error) {
+	labels := changelogCategories(configForRepo(owner, repo).Categories).labelsForSubsection(changeSectionLabel)
 
 	if len(labels) < 1 {
-		return fmt.Errorf("no labels for changeSectionLabel='%s'", changeSectionLabel)
+		return labels, nil
 	}
 
 	_, _, err := context.GitHub.Issues.AddLabelsToIssue(context.Context(), owner, repo, number, labels)
-	return err
+	return labels, err
 }
 
-func getHistoryContents(context *ctx.Context, owner, repo string) (content, sha string) {
-	defaultBranch := "master" // fallback
+// getHistoryContents reads the repo's changelog from its default branch. A
+// changelog which doesn't exist yet is empty.
+func getHistoryContents(context *ctx.Context, owner, repo string) (content, sha string, err error) {
+	filename := configForRepo(owner, repo).ChangelogFile
 	repoInfo, _, err := context.GitHub.Repositories.Get(context.Context(), owner, repo)
 	if err != nil {
-		fmt.Printf("comments: error getting default branch for %s/%s", owner, repo)
+		return "", "", fmt.Errorf("couldn't get the default branch of %s/%s: %v", owner, repo, err)
 	}
+	defaultBranch := "master" // fallback
 	if repoInfo.GetDefaultBranch() != "" {
 		defaultBranch = repoInfo.GetDefaultBranch()
 	}
-	contents, _, _, err := context.GitHub.Repositories.GetContents(
+	contents, _, resp, err := context.GitHub.Repositories.GetContents(
 		context.Context(),
 		owner,
 		repo,
-		"History.markdown",
+		filename,
 		&github.RepositoryContentGetOptions{Ref: "heads/" + defaultBranch},
 	)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return "", "", nil
+	}
 	if err != nil {
-		fmt.Printf("comments: error getting History.markdown %v\n", err)
-		return "", ""
+		return "", "", fmt.Errorf("couldn't read %s from %s/%s: %v", filename, owner, repo, err)
 	}
-	return base64Decode(*contents.Content), *contents.SHA
+	return base64Decode(*contents.Content), *contents.SHA, nil
 }
 
 func base64Decode(encoded string) string {
@@ -359,27 +684,34 @@ func parseChangelog(historyFileContents string) (*changelog.Changelog, error) {
 }
 
 func addMergeReference(historyFileContents, changeSectionLabel, prTitle string, number int) string {
-	changes, err := parseChangelog(historyFileContents)
+	changes, err := parseChangelogFile(ChangelogFormatHistory, historyFileContents)
 	if err != nil {
 		fmt.Printf("comments: error %v\n", err)
 		return historyFileContents
 	}
 
-	changeLine := &changelog.ChangeLine{
-		Summary:   template.HTMLEscapeString(prTitle),
-		Reference: fmt.Sprintf("#%d", number),
-	}
-
 	// Put either directly in the version history or in a subsection.
-	if changeSectionLabel == changeSectionLabelNone {
-		changes.AddLineToVersion("HEAD", changeLine)
-	} else {
-		changes.AddLineToSubsection("HEAD", changeSectionLabel, changeLine)
-	}
+	changes.AddLine(changeSectionLabel, newChangeLine(prTitle, number))
 
 	return changes.String()
 }
 
+func versionHasReference(version *changelog.Version, reference string) bool {
+	if version == nil {
+		return false
+	}
+	lines := append([]*changelog.ChangeLine{}, version.History...)
+	for _, subsection := range version.Subsections {
+		lines = append(lines, subsection.History...)
+	}
+	for _, line := range lines {
+		if line.Reference == reference {
+			return true
+		}
+	}
+	return false
+}
+
 func deletableRef(pr *github.PullRequest, owner string) bool {
 	return pr != nil &&
 		pr.Head != nil &&
@@ -393,7 +725,8 @@ func deletableRef(pr *github.PullRequest, owner string) bool {
 		*pr.Head.Ref != "gh-pages"
 }
 
-func commitHistoryFile(context *ctx.Context, historySHA, owner, repo string, number int, newHistoryFileContents string) error {
+func commitHistoryFile(context *ctx.Context, historySHA, owner, repo string, number int, newHistoryFileContents string) (*github.RepositoryContentResponse, error) {
+	filename := configForRepo(owner, repo).ChangelogFile
 	repositoryContentsOptions := &github.RepositoryContentFileOptions{
 		Message: github.String(fmt.Sprintf("Update history to reflect merge of #%d [ci skip]", number)),
 		Content: []byte(newHistoryFileContents),
@@ -403,11 +736,11 @@ func commitHistoryFile(context *ctx.Context, historySHA, owner, repo string, num
 			Email: github.String("jekyllbot@jekyllrb.com"),
 		},
 	}
-	updateResponse, _, err := context.GitHub.Repositories.UpdateFile(context.Context(), owner, repo, "History.markdown", repositoryContentsOptions)
+	updateResponse, _, err := context.GitHub.Repositories.UpdateFile(context.Context(), owner, repo, filename, repositoryContentsOptions)
 	if err != nil {
-		fmt.Printf("comments: error committing History.markdown: %v\n", err)
-		return err
+		context.Log("commitHistoryFile: error committing %s to %s/%s: %v", filename, owner, repo, err)
+		return nil, err
 	}
 	fmt.Printf("comments: updateResponse: %s\n", updateResponse)
-	return nil
+	return updateResponse, nil
 }
@@ -241,3 +241,59 @@ func TestAddMergeReference(t *testing.T) {
 	historyFile = addMergeReference(string(jekyllHistory), "Development Fixes", "A marvelous change.", 41526)
 	assert.Contains(t, historyFile, "* A marvelous change. (#41526)\n\n### Site Enhancements")
 }
+
+func TestParseMergeCommand(t *testing.T) {
+	command := parseMergeCommand("@jekyllbot: merge +fix +rebase")
+	assert.True(t, command.isReq)
+	assert.Equal(t, "fix", command.label)
+	assert.Equal(t, "rebase", command.method)
+
+	command = parseMergeCommand("@jekyllbot: merge +Squash")
+	assert.Equal(t, "", command.label)
+	assert.Equal(t, "squash", command.method)
+
+	command = parseMergeCommand("@jekyllbot: :shipit: +doc\n\n```commit\nFix the docs\n\nThey were wrong.\nNow they aren't.\n```\n")
+	assert.Equal(t, "doc", command.label)
+	assert.Equal(t, "", command.method)
+	assert.Equal(t, "Fix the docs", command.commitTitle)
+	assert.Equal(t, "They were wrong.\nNow they aren't.", command.commitMessage)
+
+	command = parseMergeCommand("@jekyllbot: merge +merge\n```commit\nJust a title\n```")
+	assert.Equal(t, "merge", command.method)
+	assert.Equal(t, "Just a title", command.commitTitle)
+	assert.Equal(t, "", command.commitMessage)
+}
+
+func TestRepoConfigMergeMethods(t *testing.T) {
+	assert.Equal(t, []string{"squash", "merge", "rebase"}, configForRepo("o", "unconfigured").MergeMethods)
+
+	SetRepoConfig("o", "rebase-only", RepoConfig{MergeMethods: []string{"rebase"}})
+	config := configForRepo("o", "rebase-only")
+	assert.True(t, config.allowsMergeMethod("rebase"))
+	assert.False(t, config.allowsMergeMethod("squash"))
+}
+
+func TestCoAuthorTrailers(t *testing.T) {
+	commit := func(login, name, email string) *github.RepositoryCommit {
+		return &github.RepositoryCommit{
+			Author: &github.User{Login: github.String(login)},
+			Commit: &github.Commit{Author: &github.CommitAuthor{Name: github.String(name), Email: github.String(email)}},
+		}
+	}
+	commits := []*github.RepositoryCommit{
+		commit("author", "PR Author", "author@example.com"),
+		commit("helper", "Helper", "helper@example.com"),
+		commit("helper", "Helper", "HELPER@example.com"),
+		commit("", "Anonymous", "anon@example.com"),
+	}
+
+	trailers := coAuthorTrailers(commits, "author")
+	assert.Equal(t, []string{
+		"Co-authored-by: Helper <helper@example.com>",
+		"Co-authored-by: Anonymous <anon@example.com>",
+	}, trailers)
+
+	assert.Equal(t, "Merge pull request 1\n\nCo-authored-by: Helper <helper@example.com>\nCo-authored-by: Anonymous <anon@example.com>",
+		appendTrailers("Merge pull request 1", trailers))
+	assert.Equal(t, "Merge pull request 1", appendTrailers("Merge pull request 1", []string{}))
+}
@@ -0,0 +1,421 @@
+package chlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/auth"
+	"github.com/jekyll/jekyllbot/ctx"
+	"github.com/jekyll/jekyllbot/search"
+	"github.com/parkr/githubapi/githubsearch"
+)
+
+const (
+	checksStateSuccess = "success"
+	checksStatePending = "pending"
+	checksStateFailure = "failure"
+)
+
+var (
+	cancelMergeCommentRegexp = regexp.MustCompile(`@[a-zA-Z-_]+: (?i:cancel merge|merge cancel|unqueue)`)
+
+	mergeQueue = queuedMerges{data: make(map[string][]mergeAndLabelRequest)}
+)
+
+// The queue lives in memory, so the bot's queue comments carry the request
+// in a hidden marker and RestoreMergeQueue rebuilds it from them on startup.
+// Every comment which takes a PR out of the queue carries the unqueued
+// marker.
+const (
+	queuedMarkerPrefix = "<!-- chlog:merge-queued "
+	queuedMarkerSuffix = " -->"
+	unqueuedMarker     = "<!-- chlog:merge-unqueued -->"
+)
+
+// queuedMerges holds the merge requests waiting on checks, per repo.
+type queuedMerges struct {
+	sync.Mutex // protects 'data'
+	data       map[string][]mergeAndLabelRequest
+}
+
+func repoKey(owner, repo string) string {
+	return owner + "/" + repo
+}
+
+// enqueue adds the request to its repo's queue. It returns false if the
+// PR is already queued.
+func (q *queuedMerges) enqueue(req mergeAndLabelRequest) bool {
+	q.Lock()
+	defer q.Unlock()
+	key := repoKey(req.Owner, req.Repo)
+	for _, queued := range q.data[key] {
+		if queued.PullNumber == req.PullNumber {
+			return false
+		}
+	}
+	q.data[key] = append(q.data[key], req)
+	return true
+}
+
+// remove takes the PR out of its repo's queue. It returns false if the PR
+// wasn't queued, so only one caller ever acts on a queued request.
+func (q *queuedMerges) remove(owner, repo string, number int) (mergeAndLabelRequest, bool) {
+	q.Lock()
+	defer q.Unlock()
+	key := repoKey(owner, repo)
+	for i, queued := range q.data[key] {
+		if queued.PullNumber == number {
+			q.data[key] = append(q.data[key][:i:i], q.data[key][i+1:]...)
+			if len(q.data[key]) == 0 {
+				delete(q.data, key)
+			}
+			return queued, true
+		}
+	}
+	return mergeAndLabelRequest{}, false
+}
+
+// list returns a copy of the queued requests for the repo, oldest first.
+func (q *queuedMerges) list(owner, repo string) []mergeAndLabelRequest {
+	q.Lock()
+	defer q.Unlock()
+	return append([]mergeAndLabelRequest{}, q.data[repoKey(owner, repo)]...)
+}
+
+// ProcessMergeQueue re-evaluates the queued merges for a repo whenever a
+// status, check suite or review comes in, merging those which have gone
+// green and rejecting those which have failed.
+func ProcessMergeQueue(context *ctx.Context, payload interface{}) error {
+	var owner, repo string
+	switch event := payload.(type) {
+	case *github.StatusEvent:
+		owner, repo = *event.Repo.Owner.Login, *event.Repo.Name
+	case *github.CheckSuiteEvent:
+		if event.GetAction() != "completed" {
+			return context.NewError("ProcessMergeQueue: check suite action is %q, not completed", event.GetAction())
+		}
+		owner, repo = *event.Repo.Owner.Login, *event.Repo.Name
+	case *github.PullRequestReviewEvent:
+		owner, repo = *event.Repo.Owner.Login, *event.Repo.Name
+	default:
+		return context.NewError("ProcessMergeQueue: not a status, check_suite or pull_request_review event")
+	}
+
+	queued := mergeQueue.list(owner, repo)
+	if len(queued) == 0 {
+		return nil
+	}
+
+	for _, req := range queued {
+		if err := processQueuedMerge(context, req); err != nil {
+			context.Log("ProcessMergeQueue: %v", err)
+		}
+	}
+	return nil
+}
+
+func processQueuedMerge(context *ctx.Context, req mergeAndLabelRequest) error {
+	ref := fmt.Sprintf("%s/%s#%d", req.Owner, req.Repo, req.PullNumber)
+
+	pr, _, err := context.GitHub.PullRequests.Get(context.Context(), req.Owner, req.Repo, req.PullNumber)
+	if err != nil {
+		return fmt.Errorf("error getting PR info %s: %v", ref, err)
+	}
+
+	if pr.GetState() != "open" {
+		if _, ok := mergeQueue.remove(req.Owner, req.Repo, req.PullNumber); ok {
+			context.Log("ProcessMergeQueue: %s is %s; removed from the merge queue", ref, pr.GetState())
+		}
+		return nil
+	}
+
+	state, reasons, err := pullRequestChecksState(context, req.Owner, req.Repo, pr)
+	if err != nil {
+		return fmt.Errorf("error getting checks for %s: %v", ref, err)
+	}
+
+	switch state {
+	case checksStatePending:
+		return nil
+	case checksStateFailure:
+		if _, ok := mergeQueue.remove(req.Owner, req.Repo, req.PullNumber); !ok {
+			return nil // someone else got to it first
+		}
+		return commentOnPullRequest(context, req, fmt.Sprintf(
+			"I've removed this pull request from the merge queue because %s. Fix it up and ask me to merge again. :wrench:\n\n%s",
+			strings.Join(reasons, ", and "), unqueuedMarker))
+	default:
+		if _, ok := mergeQueue.remove(req.Owner, req.Repo, req.PullNumber); !ok {
+			return nil // someone else got to it first
+		}
+		summary := &mergeSummary{intro: "All checks passed, so here's what I did:"}
+		err := mergeAndLabel(context, req, summary)
+		commentOnPullRequest(context, req, summary.String()+"\n\n"+unqueuedMarker)
+		return err
+	}
+}
+
+// CancelQueuedMerge removes a PR from the merge queue when someone with
+// push access comments "@jekyllbot: cancel merge".
+func CancelQueuedMerge(context *ctx.Context, payload interface{}) error {
+	event, ok := payload.(*github.IssueCommentEvent)
+	if !ok {
+		return context.NewError("CancelQueuedMerge: not an issue comment event")
+	}
+
+	if event.GetAction() != "created" {
+		return context.NewError("CancelQueuedMerge: comment action is %q, not created", event.GetAction())
+	}
+
+	if event.Issue == nil || event.Issue.PullRequestLinks == nil {
+		return context.NewError("CancelQueuedMerge: comment not on a pull request")
+	}
+
+	if !cancelMergeCommentRegexp.MatchString(event.Comment.GetBody()) {
+		return context.NewError("CancelQueuedMerge: not a cancel merge comment")
+	}
+
+	owner, repo, number := *event.Repo.Owner.Login, *event.Repo.Name, *event.Issue.Number
+	commenter := event.Comment.User.GetLogin()
+	if !auth.CommenterHasPushAccess(context, owner, repo, commenter) {
+		return context.NewError("CancelQueuedMerge: %s isn't allowed to cancel merges on %s/%s", commenter, owner, repo)
+	}
+
+	req, ok := mergeQueue.remove(owner, repo, number)
+	if !ok {
+		return context.NewError("CancelQueuedMerge: %s/%s#%d is not in the merge queue", owner, repo, number)
+	}
+
+	return commentOnPullRequest(context, req, fmt.Sprintf(
+		"Okay, @%s. I've removed this pull request from the merge queue.\n\n%s", commenter, unqueuedMarker))
+}
+
+// enqueueMerge puts the request into the merge queue and lets everyone know.
+func enqueueMerge(context *ctx.Context, req mergeAndLabelRequest, reasons []string) error {
+	if !mergeQueue.enqueue(req) {
+		return context.NewError("MergeAndLabel: %s/%s#%d is already in the merge queue", req.Owner, req.Repo, req.PullNumber)
+	}
+
+	marker, err := json.Marshal(req)
+	if err != nil {
+		return context.NewError("MergeAndLabel: couldn't encode the merge request for %s/%s#%d: %v", req.Owner, req.Repo, req.PullNumber, err)
+	}
+
+	position := len(mergeQueue.list(req.Owner, req.Repo))
+	return commentOnPullRequest(context, req, fmt.Sprintf(
+		"Some checks are still pending (%s), so I've added this pull request to the merge queue (position %d). "+
+			"I'll merge it once everything is green. Comment `@jekyllbot: cancel merge` to remove it from the queue.\n\n%s%s%s",
+		strings.Join(reasons, ", "), position, queuedMarkerPrefix, marker, queuedMarkerSuffix))
+}
+
+// queuedRequestFromComment returns the request encoded in the bot's queue
+// comment. It returns false if the comment doesn't put the PR in the queue.
+func queuedRequestFromComment(body string) (mergeAndLabelRequest, bool) {
+	start := strings.Index(body, queuedMarkerPrefix)
+	if start < 0 {
+		return mergeAndLabelRequest{}, false
+	}
+	encoded := body[start+len(queuedMarkerPrefix):]
+	end := strings.Index(encoded, queuedMarkerSuffix)
+	if end < 0 {
+		return mergeAndLabelRequest{}, false
+	}
+	var req mergeAndLabelRequest
+	if err := json.Unmarshal([]byte(encoded[:end]), &req); err != nil {
+		return mergeAndLabelRequest{}, false
+	}
+	return req, true
+}
+
+// RestoreMergeQueue rebuilds the merge queue after a restart. It looks at
+// the open PRs in the org which the bot has commented on, and queues those
+// whose latest queue comment from the bot put them in the queue rather than
+// took them out. The queue order follows those comments.
+func RestoreMergeQueue(context *ctx.Context, org string) error {
+	bot := context.CurrentlyAuthedGitHubUser().GetLogin()
+	if bot == "" {
+		return fmt.Errorf("RestoreMergeQueue: couldn't tell who the bot is")
+	}
+
+	issues, err := search.GitHubIssues(context, githubsearch.IssueSearchParameters{
+		Type:         githubsearch.PullRequest,
+		Organization: org,
+		State:        githubsearch.Open,
+		Commenter:    bot,
+	})
+	if err != nil {
+		return fmt.Errorf("RestoreMergeQueue: %v", err)
+	}
+
+	type queuedAt struct {
+		req mergeAndLabelRequest
+		at  time.Time
+	}
+	queued := []queuedAt{}
+	for _, issue := range issues {
+		owner, repo := issueRepo(issue)
+		if owner == "" {
+			continue
+		}
+		opts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+		var latest *queuedAt
+		for {
+			comments, resp, err := context.GitHub.Issues.ListComments(context.Context(), owner, repo, issue.GetNumber(), opts)
+			if err != nil {
+				return fmt.Errorf("RestoreMergeQueue: couldn't list comments on %s/%s#%d: %v", owner, repo, issue.GetNumber(), err)
+			}
+			for _, comment := range comments {
+				if comment.GetUser().GetLogin() != bot {
+					continue
+				}
+				if req, ok := queuedRequestFromComment(comment.GetBody()); ok {
+					latest = &queuedAt{req: req, at: comment.GetCreatedAt().Time}
+				} else if strings.Contains(comment.GetBody(), unqueuedMarker) {
+					latest = nil
+				}
+			}
+			if resp.NextPage == 0 {
+				break
+			}
+			opts.ListOptions.Page = resp.NextPage
+		}
+		if latest != nil {
+			queued = append(queued, *latest)
+		}
+	}
+
+	sort.SliceStable(queued, func(i, j int) bool { return queued[i].at.Before(queued[j].at) })
+	for _, q := range queued {
+		if mergeQueue.enqueue(q.req) {
+			context.Log("RestoreMergeQueue: restored %s/%s#%d to the merge queue", q.req.Owner, q.req.Repo, q.req.PullNumber)
+		}
+	}
+	return nil
+}
+
+// issueRepo returns the owner and name of the repo a search result is in.
+func issueRepo(issue github.Issue) (string, string) {
+	parts := strings.Split(issue.GetRepositoryURL(), "/")
+	if len(parts) < 2 {
+		return "", ""
+	}
+	return parts[len(parts)-2], parts[len(parts)-1]
+}
+
+func commentOnPullRequest(context *ctx.Context, req mergeAndLabelRequest, body string) error {
+	_, _, err := context.GitHub.Issues.CreateComment(
+		context.Context(), req.Owner, req.Repo, req.PullNumber,
+		&github.IssueComment{Body: github.String(body)})
+	if err != nil {
+		return context.NewError("chlog: couldn't comment on %s/%s#%d: %v", req.Owner, req.Repo, req.PullNumber, err)
+	}
+	return nil
+}
+
+// pullRequestChecksState determines whether the PR is ready to merge. The
+// required checks come from branch protection; if the base branch isn't
+// protected, every reported status and check run counts. The LGTM status
+// always counts when it is present, and is waited for when the repo
+// requires it. The reasons describe the checks which are pending or
+// failing.
+func pullRequestChecksState(context *ctx.Context, owner, repo string, pr *github.PullRequest) (string, []string, error) {
+	if pr.Mergeable != nil && !pr.GetMergeable() {
+		return checksStateFailure, []string{"it has merge conflicts"}, nil
+	}
+
+	extra := []string{}
+	if configForRepo(owner, repo).RequireLGTM {
+		extra = append(extra, owner+"/lgtm")
+	}
+	return commitChecksState(context, owner, repo, pr.GetHead().GetSHA(), pr.GetBase().GetRef(), extra...)
+}
+
+// commitChecksState determines whether the checks on the commit are green,
+// using the required checks from the branch's protection. The extra checks
+// are required too, and count as pending until they're reported.
+func commitChecksState(context *ctx.Context, owner, repo, sha, branch string, extra ...string) (string, []string, error) {
+	states := map[string]string{}
+
+	combined, _, err := context.GitHub.Repositories.GetCombinedStatus(context.Context(), owner, repo, sha, &github.ListOptions{PerPage: 100})
+	if err != nil {
+		return "", nil, err
+	}
+	for _, status := range combined.Statuses {
+		switch status.GetState() {
+		case "success":
+			states[status.GetContext()] = checksStateSuccess
+		case "pending":
+			states[status.GetContext()] = checksStatePending
+		default:
+			states[status.GetContext()] = checksStateFailure
+		}
+	}
+
+	checkRuns, _, err := context.GitHub.Checks.ListCheckRunsForRef(context.Context(), owner, repo, sha, &github.ListCheckRunsOptions{
+		ListOptions: github.ListOptions{PerPage: 100},
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	for _, run := range checkRuns.CheckRuns {
+		switch {
+		case run.GetStatus() != "completed":
+			states[run.GetName()] = checksStatePending
+		case run.GetConclusion() == "success" || run.GetConclusion() == "neutral" || run.GetConclusion() == "skipped":
+			states[run.GetName()] = checksStateSuccess
+		default:
+			states[run.GetName()] = checksStateFailure
+		}
+	}
+
+	required := []string{}
+	if checks, _, err := context.GitHub.Repositories.GetRequiredStatusChecks(context.Context(), owner, repo, branch); err == nil && checks != nil {
+		if checks.Contexts != nil {
+			required = append(required, *checks.Contexts...)
+		}
+		if checks.Checks != nil {
+			for _, check := range *checks.Checks {
+				required = append(required, check.Context)
+			}
+		}
+	}
+	if len(required) == 0 {
+		for name := range states {
+			required = append(required, name)
+		}
+	} else if _, ok := states[owner+"/lgtm"]; ok {
+		required = append(required, owner+"/lgtm")
+	}
+	required = append(required, extra...)
+	sort.Strings(required)
+
+	pending, failing := []string{}, []string{}
+	seen := map[string]bool{}
+	for _, name := range required {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		switch states[name] {
+		case checksStateSuccess:
+		case checksStateFailure:
+			failing = append(failing, fmt.Sprintf("`%s` failed", name))
+		default:
+			pending = append(pending, fmt.Sprintf("`%s`", name))
+		}
+	}
+
+	if len(failing) > 0 {
+		return checksStateFailure, failing, nil
+	}
+	if len(pending) > 0 {
+		return checksStatePending, pending, nil
+	}
+	return checksStateSuccess, nil, nil
+}
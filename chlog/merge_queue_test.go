@@ -0,0 +1,207 @@
+package chlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueuedMerges(t *testing.T) {
+	queue := queuedMerges{data: make(map[string][]mergeAndLabelRequest)}
+
+	assert.True(t, queue.enqueue(mergeAndLabelRequest{Owner: "o", Repo: "r", PullNumber: 1}))
+	assert.True(t, queue.enqueue(mergeAndLabelRequest{Owner: "o", Repo: "r", PullNumber: 2}))
+	assert.True(t, queue.enqueue(mergeAndLabelRequest{Owner: "o", Repo: "other", PullNumber: 1}))
+	assert.False(t, queue.enqueue(mergeAndLabelRequest{Owner: "o", Repo: "r", PullNumber: 1}))
+
+	queued := queue.list("o", "r")
+	assert.Len(t, queued, 2)
+	assert.Equal(t, 1, queued[0].PullNumber)
+	assert.Equal(t, 2, queued[1].PullNumber)
+
+	req, ok := queue.remove("o", "r", 1)
+	assert.True(t, ok)
+	assert.Equal(t, 1, req.PullNumber)
+	_, ok = queue.remove("o", "r", 1)
+	assert.False(t, ok)
+	assert.Len(t, queue.list("o", "r"), 1)
+	assert.Len(t, queue.list("o", "other"), 1)
+}
+
+func TestCancelMergeCommentRegexp(t *testing.T) {
+	cases := map[string]bool{
+		"@jekyllbot: cancel merge": true,
+		"@jekyllbot: Cancel Merge": true,
+		"@jekyllbot: unqueue":      true,
+		"@jekyllbot: merge":        false,
+		"please cancel merge":      false,
+	}
+	for input, expected := range cases {
+		assert.Equal(t, expected, cancelMergeCommentRegexp.MatchString(input), "for %q", input)
+	}
+}
+
+func TestPullRequestChecksState(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+	pr := &github.PullRequest{
+		Number: github.Int(1),
+		Head:   &github.PullRequestBranch{SHA: github.String("deadbeef")},
+		Base:   &github.PullRequestBranch{Ref: github.String("main")},
+	}
+
+	statuses := []*github.RepoStatus{}
+	checkRuns := []*github.CheckRun{}
+	required := []string{}
+	mux.HandleFunc("/repos/o/r/commits/deadbeef/status", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&github.CombinedStatus{Statuses: statuses})
+	})
+	mux.HandleFunc("/repos/o/r/commits/deadbeef/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&github.ListCheckRunsResults{CheckRuns: checkRuns})
+	})
+	mux.HandleFunc("/repos/o/r/branches/main/protection/required_status_checks", func(w http.ResponseWriter, r *http.Request) {
+		if len(required) == 0 {
+			http.Error(w, "Branch not protected", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(&github.RequiredStatusChecks{Contexts: &required})
+	})
+
+	// Nothing reported at all.
+	state, reasons, err := pullRequestChecksState(context, "o", "r", pr)
+	assert.NoError(t, err)
+	assert.Equal(t, checksStateSuccess, state)
+	assert.Empty(t, reasons)
+
+	// Unprotected: everything reported counts.
+	statuses = []*github.RepoStatus{
+		{Context: github.String("o/lgtm"), State: github.String("pending")},
+		{Context: github.String("ci/travis"), State: github.String("success")},
+	}
+	checkRuns = []*github.CheckRun{
+		{Name: github.String("test"), Status: github.String("completed"), Conclusion: github.String("success")},
+	}
+	state, reasons, err = pullRequestChecksState(context, "o", "r", pr)
+	assert.NoError(t, err)
+	assert.Equal(t, checksStatePending, state)
+	assert.Equal(t, []string{"`o/lgtm`"}, reasons)
+
+	// Protected: only required checks (and LGTM) count.
+	required = []string{"test", "lint"}
+	statuses[0].State = github.String("success")
+	checkRuns = append(checkRuns, &github.CheckRun{Name: github.String("optional"), Status: github.String("completed"), Conclusion: github.String("failure")})
+	state, reasons, err = pullRequestChecksState(context, "o", "r", pr)
+	assert.NoError(t, err)
+	assert.Equal(t, checksStatePending, state)
+	assert.Equal(t, []string{"`lint`"}, reasons)
+
+	checkRuns = append(checkRuns, &github.CheckRun{Name: github.String("lint"), Status: github.String("completed"), Conclusion: github.String("failure")})
+	state, reasons, err = pullRequestChecksState(context, "o", "r", pr)
+	assert.NoError(t, err)
+	assert.Equal(t, checksStateFailure, state)
+	assert.Equal(t, []string{"`lint` failed"}, reasons)
+
+	// A repo which requires LGTM waits for it even before it's posted.
+	SetRepoConfig("o", "r", RepoConfig{RequireLGTM: true})
+	defer SetRepoConfig("o", "r", RepoConfig{})
+	required = []string{"test"}
+	statuses = []*github.RepoStatus{}
+	state, reasons, err = pullRequestChecksState(context, "o", "r", pr)
+	assert.NoError(t, err)
+	assert.Equal(t, checksStatePending, state)
+	assert.Equal(t, []string{"`o/lgtm`"}, reasons)
+
+	required = []string{}
+	state, reasons, err = pullRequestChecksState(context, "o", "r", pr)
+	assert.NoError(t, err)
+	assert.Equal(t, checksStateFailure, state, "the failing optional check counts when unprotected")
+	assert.Equal(t, []string{"`lint` failed", "`optional` failed"}, reasons)
+
+	statuses = []*github.RepoStatus{{Context: github.String("o/lgtm"), State: github.String("success")}}
+	required = []string{"test"}
+	state, reasons, err = pullRequestChecksState(context, "o", "r", pr)
+	assert.NoError(t, err)
+	assert.Equal(t, checksStateSuccess, state)
+	assert.Empty(t, reasons)
+
+	pr.Mergeable = github.Bool(false)
+	state, reasons, err = pullRequestChecksState(context, "o", "r", pr)
+	assert.NoError(t, err)
+	assert.Equal(t, checksStateFailure, state)
+	assert.Equal(t, []string{"it has merge conflicts"}, reasons)
+}
+
+func TestQueuedRequestFromComment(t *testing.T) {
+	req, ok := queuedRequestFromComment("I'll merge it once everything is green.\n\n" +
+		`<!-- chlog:merge-queued {"Owner":"o","Repo":"r","PullNumber":1,"ChangeSectionLabel":"bug"} -->`)
+	assert.True(t, ok)
+	assert.Equal(t, mergeAndLabelRequest{Owner: "o", Repo: "r", PullNumber: 1, ChangeSectionLabel: "bug"}, req)
+
+	_, ok = queuedRequestFromComment("Okay. I've removed this pull request from the merge queue.\n\n" + unqueuedMarker)
+	assert.False(t, ok)
+	_, ok = queuedRequestFromComment("<!-- chlog:merge-queued {not json} -->")
+	assert.False(t, ok)
+}
+
+func TestRestoreMergeQueue(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+	mergeQueue = queuedMerges{data: make(map[string][]mergeAndLabelRequest)}
+	defer func() { mergeQueue = queuedMerges{data: make(map[string][]mergeAndLabelRequest)} }()
+
+	queuedComment := func(number int, day int) *github.IssueComment {
+		return &github.IssueComment{
+			User:      &github.User{Login: github.String("jekyllbot")},
+			CreatedAt: &github.Timestamp{Time: time.Date(2024, time.January, day, 0, 0, 0, 0, time.UTC)},
+			Body: github.String(fmt.Sprintf("I'll merge it once everything is green.\n\n"+
+				`<!-- chlog:merge-queued {"Owner":"o","Repo":"r","PullNumber":%d,"ChangeSectionLabel":"bug"} -->`, number)),
+		}
+	}
+
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"login":"jekyllbot"}`)
+	})
+	mux.HandleFunc("/search/issues", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		assert.Contains(t, r.URL.Query().Get("q"), "commenter:jekyllbot")
+		fmt.Fprint(w, `{"items":[
+			{"number":1,"repository_url":"https://api.github.com/repos/o/r"},
+			{"number":2,"repository_url":"https://api.github.com/repos/o/r"},
+			{"number":3,"repository_url":"https://api.github.com/repos/o/r"}
+		]}`)
+	})
+	mux.HandleFunc("/repos/o/r/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]*github.IssueComment{queuedComment(1, 2)})
+	})
+	mux.HandleFunc("/repos/o/r/issues/2/comments", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]*github.IssueComment{
+			queuedComment(2, 1),
+			{User: &github.User{Login: github.String("jekyllbot")}, Body: github.String("Okay, @parkr. I've removed this pull request from the merge queue.\n\n" + unqueuedMarker)},
+		})
+	})
+	mux.HandleFunc("/repos/o/r/issues/3/comments", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]*github.IssueComment{
+			{User: &github.User{Login: github.String("jekyllbot")}, Body: github.String("Okay, @parkr. I've removed this pull request from the merge queue.\n\n" + unqueuedMarker)},
+			queuedComment(3, 1),
+			// Someone quoting the bot doesn't put the PR back in the queue.
+			{User: &github.User{Login: github.String("parkr")}, Body: github.String("> " + unqueuedMarker)},
+		})
+	})
+
+	assert.NoError(t, RestoreMergeQueue(context, "o"))
+
+	queued := mergeQueue.list("o", "r")
+	if assert.Len(t, queued, 2) {
+		assert.Equal(t, 3, queued[0].PullNumber, "queued first")
+		assert.Equal(t, 1, queued[1].PullNumber)
+		assert.Equal(t, "bug", queued[1].ChangeSectionLabel)
+	}
+}
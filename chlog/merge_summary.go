@@ -0,0 +1,74 @@
+package chlog
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// mergeSummary collects the outcome of each step of merging a PR, so they
+// can be reported in one comment. Steps run concurrently, so it's safe to
+// add to from several goroutines.
+type mergeSummary struct {
+	sync.Mutex // protects 'steps'
+	// The first line of the comment.
+	intro string
+	steps []mergeStep
+}
+
+type mergeStep struct {
+	emoji, message string
+	failed         bool
+}
+
+// done records a step which succeeded.
+func (s *mergeSummary) done(format string, args ...interface{}) {
+	s.add(mergeStep{emoji: ":white_check_mark:", message: fmt.Sprintf(format, args...)})
+}
+
+// failed records a step which failed.
+func (s *mergeSummary) failed(format string, args ...interface{}) {
+	s.add(mergeStep{emoji: ":x:", message: fmt.Sprintf(format, args...), failed: true})
+}
+
+// skipped records a step which wasn't needed.
+func (s *mergeSummary) skipped(format string, args ...interface{}) {
+	s.add(mergeStep{emoji: ":heavy_minus_sign:", message: fmt.Sprintf(format, args...)})
+}
+
+func (s *mergeSummary) add(step mergeStep) {
+	s.Lock()
+	defer s.Unlock()
+	s.steps = append(s.steps, step)
+}
+
+// hasFailures returns true if any step failed.
+func (s *mergeSummary) hasFailures() bool {
+	s.Lock()
+	defer s.Unlock()
+	for _, step := range s.steps {
+		if step.failed {
+			return true
+		}
+	}
+	return false
+}
+
+// String renders the summary as a comment.
+func (s *mergeSummary) String() string {
+	s.Lock()
+	defer s.Unlock()
+	lines := []string{}
+	for _, step := range s.steps {
+		lines = append(lines, fmt.Sprintf("- %s %s", step.emoji, step.message))
+	}
+	if s.intro == "" {
+		return strings.Join(lines, "\n")
+	}
+	return s.intro + "\n\n" + strings.Join(lines, "\n")
+}
+
+// refusalMessage explains why a merge was refused.
+func refusalMessage(reasons ...string) string {
+	return fmt.Sprintf("I can't merge this pull request because %s.", strings.Join(reasons, ", and "))
+}
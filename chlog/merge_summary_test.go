@@ -0,0 +1,69 @@
+package chlog
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeAndLabelSummary(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+
+	mux.HandleFunc("/repos/o/r/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number":1,"title":"Fix a thing","user":{"login":"author"},
+			"head":{"ref":"fix-a-thing","repo":{"owner":{"login":"o"}}}}`)
+	})
+	mux.HandleFunc("/repos/o/r/pulls/1/commits", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	})
+	mux.HandleFunc("/repos/o/r/pulls/1/merge", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "PUT")
+		fmt.Fprint(w, `{"sha":"abcdef123456","merged":true}`)
+	})
+	mux.HandleFunc("/repos/o/r/git/refs/heads/fix-a-thing", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "DELETE")
+		http.Error(w, `{"message":"Reference does not exist"}`, http.StatusUnprocessableEntity)
+	})
+	mux.HandleFunc("/repos/o/r/issues/1/labels", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+		fmt.Fprint(w, `[]`)
+	})
+	mux.HandleFunc("/repos/o/r", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"default_branch":"main"}`)
+	})
+	mux.HandleFunc("/repos/o/r/contents/History.markdown", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			json.NewEncoder(w).Encode(&github.RepositoryContent{
+				Content: github.String(base64.StdEncoding.EncodeToString([]byte("## HEAD\n"))),
+				SHA:     github.String("sha1"),
+			})
+		case "PUT":
+			fmt.Fprint(w, `{"commit":{"sha":"fedcba","html_url":"https://github.com/o/r/commit/fedcba"}}`)
+		}
+	})
+
+	req := mergeAndLabelRequest{Owner: "o", Repo: "r", PullNumber: 1, CommenterLogin: "parkr", ChangeSectionLabel: "Bug Fixes", MergeMethod: "squash"}
+	summary := &mergeSummary{intro: "Here's what I did:"}
+	assert.NoError(t, mergeAndLabel(context, req, summary))
+	assert.True(t, summary.hasFailures())
+
+	comment := summary.String()
+	assert.Contains(t, comment, "Here's what I did:\n\n- :white_check_mark: I merged this pull request (squash) as abcdef1, as requested by @parkr.\n")
+	assert.Contains(t, comment, "- :x: I couldn't delete the `fix-a-thing` branch: ")
+	assert.Contains(t, comment, "- :white_check_mark: I added the `bug`, `fix` labels.")
+	assert.Contains(t, comment, "- :white_check_mark: I added this pull request to History.markdown in https://github.com/o/r/commit/fedcba.")
+}
+
+func TestRefusalMessage(t *testing.T) {
+	assert.Equal(t, "I can't merge this pull request because `lint` failed, and `test` failed.",
+		refusalMessage("`lint` failed", "`test` failed"))
+}
@@ -0,0 +1,132 @@
+package chlog
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/hashicorp/go-version"
+	"github.com/jekyll/jekyllbot/ctx"
+)
+
+// versionTitleRegexp matches milestone titles like "v1.2.3" and "1.2.3".
+var versionTitleRegexp = regexp.MustCompile(`^v?\d+\.\d+\.\d+$`)
+
+// MilestoneMergedPullRequest puts merged PRs without a milestone into the
+// upcoming one, which is the open milestone with the lowest version.
+func MilestoneMergedPullRequest(context *ctx.Context, payload interface{}) error {
+	event, ok := payload.(*github.PullRequestEvent)
+	if !ok {
+		return context.NewError("chlog.MilestoneMergedPullRequest: not a pull request event")
+	}
+
+	if event.GetAction() != "closed" || !event.PullRequest.GetMerged() {
+		return context.NewError("chlog.MilestoneMergedPullRequest: pull request wasn't merged")
+	}
+
+	if event.PullRequest.Milestone != nil {
+		return nil
+	}
+
+	owner, repo, number := *event.Repo.Owner.Login, *event.Repo.Name, event.GetNumber()
+	context.SetIssue(owner, repo, number)
+
+	milestones, err := openMilestones(context, owner, repo)
+	if err != nil {
+		return context.NewError("chlog.MilestoneMergedPullRequest: couldn't fetch milestones for %s/%s: %+v", owner, repo, err)
+	}
+
+	upcoming := upcomingMilestone(milestones, nil)
+	if upcoming == nil {
+		context.Log("chlog.MilestoneMergedPullRequest: no upcoming milestone on %s/%s", owner, repo)
+		return nil
+	}
+
+	_, _, err = context.GitHub.Issues.Edit(context.Context(), owner, repo, number, &github.IssueRequest{Milestone: upcoming.Number})
+	if err != nil {
+		return context.NewError("chlog.MilestoneMergedPullRequest: couldn't add %s to '%s': %+v", context.Issue, upcoming.GetTitle(), err)
+	}
+	context.Log("chlog.MilestoneMergedPullRequest: added %s to '%s'", context.Issue, upcoming.GetTitle())
+
+	return nil
+}
+
+// milestoneVersion returns the version a title like "v1.2.3" or "1.2.3" is
+// for, or nil if it isn't a version.
+func milestoneVersion(title string) *version.Version {
+	if !versionTitleRegexp.MatchString(title) {
+		return nil
+	}
+	v, err := version.NewVersion(title)
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+// findMilestone returns the milestone with the title, with or without a
+// leading "v", or nil.
+func findMilestone(milestones []*github.Milestone, title string) *github.Milestone {
+	for _, milestone := range milestones {
+		if strings.TrimPrefix(milestone.GetTitle(), "v") == strings.TrimPrefix(title, "v") {
+			return milestone
+		}
+	}
+	return nil
+}
+
+// upcomingMilestone returns the milestone with the lowest version which is
+// newer than after, or nil. Any version will do if after is nil.
+func upcomingMilestone(milestones []*github.Milestone, after *version.Version) *github.Milestone {
+	var upcoming *github.Milestone
+	var upcomingVersion *version.Version
+	for _, milestone := range milestones {
+		v := milestoneVersion(milestone.GetTitle())
+		if v == nil || (after != nil && !v.GreaterThan(after)) {
+			continue
+		}
+		if upcomingVersion == nil || v.LessThan(upcomingVersion) {
+			upcoming, upcomingVersion = milestone, v
+		}
+	}
+	return upcoming
+}
+
+func openMilestones(context *ctx.Context, owner, repo string) ([]*github.Milestone, error) {
+	var milestones []*github.Milestone
+	opts := &github.MilestoneListOptions{State: "open", ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		page, resp, err := context.GitHub.Issues.ListMilestones(context.Context(), owner, repo, opts)
+		if err != nil {
+			return nil, err
+		}
+		milestones = append(milestones, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return milestones, nil
+}
+
+func openIssuesInMilestone(context *ctx.Context, owner, repo string, number int) ([]*github.Issue, error) {
+	var issues []*github.Issue
+	opts := &github.IssueListByRepoOptions{
+		Milestone:   strconv.Itoa(number),
+		State:       "open",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		page, resp, err := context.GitHub.Issues.ListByRepo(context.Context(), owner, repo, opts)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.ListOptions.Page = resp.NextPage
+	}
+	return issues, nil
+}
@@ -0,0 +1,132 @@
+package chlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/hashicorp/go-version"
+	"github.com/jekyll/jekyllbot/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func testMilestones(titles ...string) []*github.Milestone {
+	milestones := make([]*github.Milestone, len(titles))
+	for i, title := range titles {
+		milestones[i] = &github.Milestone{Number: github.Int(i + 1), Title: github.String(title)}
+	}
+	return milestones
+}
+
+func TestFindMilestone(t *testing.T) {
+	milestones := testMilestones("Backlog", "v3.9.1", "4.0.0")
+	assert.Equal(t, 2, findMilestone(milestones, "v3.9.1").GetNumber())
+	assert.Equal(t, 2, findMilestone(milestones, "3.9.1").GetNumber())
+	assert.Equal(t, 3, findMilestone(milestones, "v4.0.0").GetNumber())
+	assert.Nil(t, findMilestone(milestones, "v4.0.1"))
+}
+
+func TestUpcomingMilestone(t *testing.T) {
+	milestones := testMilestones("Backlog", "v4.1.0", "v3.9.1", "4.0.0", "v3.9.0")
+	assert.Equal(t, "v3.9.0", upcomingMilestone(milestones, nil).GetTitle())
+	assert.Equal(t, "4.0.0", upcomingMilestone(milestones, version.Must(version.NewVersion("3.9.1"))).GetTitle())
+	assert.Nil(t, upcomingMilestone(milestones, version.Must(version.NewVersion("4.1.0"))))
+}
+
+func TestNextMilestoneTitles(t *testing.T) {
+	assert.Equal(t, []string{"v3.9.2", "v3.10.0"}, nextMilestoneTitles("v3.9.1", "v3.9.1"))
+	assert.Equal(t, []string{"3.9.2", "3.10.0"}, nextMilestoneTitles("v3.9.1", "3.9.1"))
+}
+
+func TestCloseMilestoneOnRelease(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+
+	mux.HandleFunc("/repos/o/r/milestones", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			fmt.Fprint(w, `[{"number":1,"title":"3.9.1"},{"number":2,"title":"3.10.0"}]`)
+		case "POST":
+			milestone := new(github.Milestone)
+			json.NewDecoder(r.Body).Decode(milestone)
+			assert.Equal(t, "3.9.2", milestone.GetTitle())
+			fmt.Fprint(w, `{"number":3,"title":"3.9.2"}`)
+		}
+	})
+	mux.HandleFunc("/repos/o/r/issues", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		assert.Equal(t, "1", r.URL.Query().Get("milestone"))
+		assert.Equal(t, "open", r.URL.Query().Get("state"))
+		fmt.Fprint(w, `[{"number":42}]`)
+	})
+	moved := false
+	mux.HandleFunc("/repos/o/r/issues/42", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "PATCH")
+		issue := new(github.IssueRequest)
+		json.NewDecoder(r.Body).Decode(issue)
+		assert.Equal(t, 3, issue.GetMilestone())
+		moved = true
+		fmt.Fprint(w, `{"number":42}`)
+	})
+	closed := false
+	mux.HandleFunc("/repos/o/r/milestones/1", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "PATCH")
+		milestone := new(github.Milestone)
+		json.NewDecoder(r.Body).Decode(milestone)
+		assert.Equal(t, "closed", milestone.GetState())
+		closed = true
+		fmt.Fprint(w, `{"number":1}`)
+	})
+
+	err := CloseMilestoneOnRelease(context, &github.ReleaseEvent{
+		Action: github.String("published"),
+		Release: &github.RepositoryRelease{
+			TagName:    github.String("v3.9.1"),
+			Prerelease: github.Bool(false),
+			Draft:      github.Bool(false),
+		},
+		Repo: &github.Repository{Owner: &github.User{Login: github.String("o")}, Name: github.String("r")},
+	})
+	assert.NoError(t, err)
+	assert.True(t, moved)
+	assert.True(t, closed)
+}
+
+func TestMilestoneMergedPullRequest(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+
+	mux.HandleFunc("/repos/o/r/milestones", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"number":5,"title":"Backlog"},{"number":2,"title":"v3.10.0"},{"number":3,"title":"v3.9.2"}]`)
+	})
+	milestoned := false
+	mux.HandleFunc("/repos/o/r/issues/7", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "PATCH")
+		issue := new(github.IssueRequest)
+		json.NewDecoder(r.Body).Decode(issue)
+		assert.Equal(t, 3, issue.GetMilestone())
+		milestoned = true
+		fmt.Fprint(w, `{"number":7}`)
+	})
+
+	event := &github.PullRequestEvent{
+		Action:      github.String("closed"),
+		Number:      github.Int(7),
+		PullRequest: &github.PullRequest{Merged: github.Bool(true)},
+		Repo:        &github.Repository{Owner: &github.User{Login: github.String("o")}, Name: github.String("r")},
+	}
+	assert.NoError(t, MilestoneMergedPullRequest(context, event))
+	assert.True(t, milestoned)
+
+	milestoned = false
+	event.PullRequest.Milestone = &github.Milestone{Number: github.Int(2)}
+	assert.NoError(t, MilestoneMergedPullRequest(context, event))
+	assert.False(t, milestoned)
+
+	event.PullRequest.Merged = github.Bool(false)
+	assert.Error(t, MilestoneMergedPullRequest(context, event))
+}
@@ -0,0 +1,172 @@
+package chlog
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/ctx"
+)
+
+// HistoryReconciliation is the set of merged PRs which are missing from a
+// repo's changelog, and the changelog with them added.
+type HistoryReconciliation struct {
+	Owner, Repo string
+	// The changelog path and the branch it was read from.
+	File, Branch string
+	// The merged PRs which are missing from the unreleased changes, oldest
+	// first.
+	Missing []*github.PullRequest
+	// The changelog with the missing lines added.
+	Contents string
+
+	sha string
+}
+
+// ReconcileHistory finds the PRs merged into the default branch since the
+// given time which the unreleased section of the changelog doesn't
+// reference. Each missing line is filed under the category matching the
+// PR's labels, unless the PR body overrides it. PRs which are skipped from
+// the changelog aren't considered missing.
+func ReconcileHistory(context *ctx.Context, owner, repo string, since time.Time) (*HistoryReconciliation, error) {
+	config := configForRepo(owner, repo)
+	r := &HistoryReconciliation{Owner: owner, Repo: repo, File: config.ChangelogFile, Branch: defaultBranch(context, owner, repo)}
+
+	historyFileContents, sha, err := getHistoryContents(context, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := parseChangelogFile(config.ChangelogFormat, historyFileContents)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s: %v", config.ChangelogFile, err)
+	}
+	r.sha = sha
+
+	merged, err := pullRequestsMergedSince(context, owner, repo, r.Branch, since)
+	if err != nil {
+		return nil, err
+	}
+
+	categories := changelogCategories(config.Categories)
+	for _, pr := range merged {
+		req := mergeAndLabelRequest{
+			Owner: owner, Repo: repo, PullNumber: pr.GetNumber(),
+			ChangeSectionLabel: categories.sectionForLabels(pr.Labels),
+		}
+		entry := newChangelogEntry(config, req, pr)
+		if entry.Skip != "" || changes.HasReference(unreleasedVersion, entry.Line.Reference) {
+			continue
+		}
+		changes.AddLine(entry.Section, entry.Line)
+		r.Missing = append(r.Missing, pr)
+	}
+	r.Contents = changes.String()
+
+	return r, nil
+}
+
+// Commit commits the reconciled changelog straight to the default branch,
+// and returns the commit URL.
+func (r *HistoryReconciliation) Commit(context *ctx.Context) (string, error) {
+	return r.commit(context, r.Branch)
+}
+
+// OpenPullRequest commits the reconciled changelog to a new branch and
+// opens a PR for it, and returns the PR URL.
+func (r *HistoryReconciliation) OpenPullRequest(context *ctx.Context) (string, error) {
+	base, _, err := context.GitHub.Git.GetRef(context.Context(), r.Owner, r.Repo, "heads/"+r.Branch)
+	if err != nil {
+		return "", fmt.Errorf("couldn't get %s: %v", r.Branch, err)
+	}
+
+	branch := fmt.Sprintf("reconcile-history-%s", time.Now().UTC().Format("20060102150405"))
+	_, _, err = context.GitHub.Git.CreateRef(context.Context(), r.Owner, r.Repo, &github.Reference{
+		Ref:    github.String("refs/heads/" + branch),
+		Object: &github.GitObject{SHA: base.Object.SHA},
+	})
+	if err != nil {
+		return "", fmt.Errorf("couldn't create branch %s: %v", branch, err)
+	}
+
+	if _, err := r.commit(context, branch); err != nil {
+		return "", err
+	}
+
+	pr, _, err := context.GitHub.PullRequests.Create(context.Context(), r.Owner, r.Repo, &github.NewPullRequest{
+		Title: github.String(fmt.Sprintf("Add %d missing pull requests to %s", len(r.Missing), r.File)),
+		Head:  github.String(branch),
+		Base:  github.String(r.Branch),
+		Body:  github.String(r.pullRequestBody()),
+	})
+	if err != nil {
+		return "", fmt.Errorf("couldn't open pull request: %v", err)
+	}
+	return pr.GetHTMLURL(), nil
+}
+
+func (r *HistoryReconciliation) commit(context *ctx.Context, branch string) (string, error) {
+	response, _, err := context.GitHub.Repositories.UpdateFile(context.Context(), r.Owner, r.Repo, r.File, &github.RepositoryContentFileOptions{
+		Message: github.String(fmt.Sprintf("Add %d missing pull requests to %s [ci skip]", len(r.Missing), r.File)),
+		Content: []byte(r.Contents),
+		SHA:     github.String(r.sha),
+		Branch:  github.String(branch),
+		Committer: &github.CommitAuthor{
+			Name:  github.String("jekyllbot"),
+			Email: github.String("jekyllbot@jekyllrb.com"),
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("couldn't commit %s: %v", r.File, err)
+	}
+	return response.Commit.GetHTMLURL(), nil
+}
+
+func (r *HistoryReconciliation) pullRequestBody() string {
+	body := fmt.Sprintf("These pull requests were merged into `%s` but are missing from %s:\n\n", r.Branch, r.File)
+	for _, pr := range r.Missing {
+		body += fmt.Sprintf("- #%d %s\n", pr.GetNumber(), pr.GetTitle())
+	}
+	return body
+}
+
+// pullRequestsMergedSince lists the PRs merged into the branch since the
+// given time, oldest first.
+func pullRequestsMergedSince(context *ctx.Context, owner, repo, branch string, since time.Time) ([]*github.PullRequest, error) {
+	merged := []*github.PullRequest{}
+	opts := &github.PullRequestListOptions{
+		State:       "closed",
+		Base:        branch,
+		Sort:        "updated",
+		Direction:   "desc",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		prs, resp, err := context.GitHub.PullRequests.List(context.Context(), owner, repo, opts)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't list pull requests for %s/%s: %v", owner, repo, err)
+		}
+		for _, pr := range prs {
+			if pr.MergedAt != nil && pr.GetMergedAt().After(since) {
+				merged = append(merged, pr)
+			}
+		}
+		// A PR merged since then was updated since then too.
+		if resp.NextPage == 0 || (len(prs) > 0 && prs[len(prs)-1].GetUpdatedAt().Before(since)) {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].GetMergedAt().Before(merged[j].GetMergedAt().Time)
+	})
+	return merged, nil
+}
+
+func defaultBranch(context *ctx.Context, owner, repo string) string {
+	repoInfo, _, err := context.GitHub.Repositories.Get(context.Context(), owner, repo)
+	if err != nil || repoInfo.GetDefaultBranch() == "" {
+		return "master" // fallback
+	}
+	return repoInfo.GetDefaultBranch()
+}
@@ -0,0 +1,67 @@
+package chlog
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSectionForLabels(t *testing.T) {
+	labels := func(names ...string) []*github.Label {
+		l := []*github.Label{}
+		for _, name := range names {
+			l = append(l, &github.Label{Name: github.String(name)})
+		}
+		return l
+	}
+	assert.Equal(t, changeSectionLabelNone, historyCategories.sectionForLabels(labels()))
+	assert.Equal(t, changeSectionLabelNone, historyCategories.sectionForLabels(labels("question")))
+	assert.Equal(t, "Bug Fixes", historyCategories.sectionForLabels(labels("bug")))
+	assert.Equal(t, "Development Fixes", historyCategories.sectionForLabels(labels("internal", "fix")))
+	assert.Equal(t, "Documentation", historyCategories.sectionForLabels(labels("Documentation")))
+}
+
+func TestReconcileHistory(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+	since := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mux.HandleFunc("/repos/o/r", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"default_branch":"main"}`)
+	})
+	mux.HandleFunc("/repos/o/r/contents/History.markdown", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&github.RepositoryContent{
+			Content: github.String(base64.StdEncoding.EncodeToString([]byte("## HEAD\n\n### Bug Fixes\n\n  * Fix a thing (#1)\n"))),
+			SHA:     github.String("sha1"),
+		})
+	})
+	mux.HandleFunc("/repos/o/r/pulls", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "closed", r.FormValue("state"))
+		assert.Equal(t, "main", r.FormValue("base"))
+		fmt.Fprint(w, `[
+			{"number":4,"title":"Skip me","merged_at":"2016-02-04T00:00:00Z","updated_at":"2016-02-04T00:00:00Z","labels":[{"name":"skip-changelog"}]},
+			{"number":3,"title":"Fix the tests","merged_at":"2016-02-03T00:00:00Z","updated_at":"2016-02-03T00:00:00Z","labels":[{"name":"internal"},{"name":"fix"}]},
+			{"number":5,"title":"Closed, not merged","updated_at":"2016-02-02T00:00:00Z"},
+			{"number":1,"title":"Fix a thing","merged_at":"2016-02-01T00:00:00Z","updated_at":"2016-02-01T00:00:00Z","labels":[{"name":"bug"}]},
+			{"number":2,"title":"Tweak something","merged_at":"2016-01-15T00:00:00Z","updated_at":"2016-01-15T00:00:00Z"},
+			{"number":0,"title":"Old","merged_at":"2015-12-01T00:00:00Z","updated_at":"2015-12-01T00:00:00Z"}
+		]`)
+	})
+
+	r, err := ReconcileHistory(context, "o", "r", since)
+	assert.NoError(t, err)
+	assert.Equal(t, "main", r.Branch)
+	assert.Len(t, r.Missing, 2)
+	assert.Equal(t, 2, r.Missing[0].GetNumber())
+	assert.Equal(t, 3, r.Missing[1].GetNumber())
+	assert.Equal(t, "## HEAD\n\n  * Tweak something (#2)\n\n### Bug Fixes\n\n  * Fix a thing (#1)\n\n### Development Fixes\n\n  * Fix the tests (#3)\n", r.Contents)
+	assert.Equal(t, "These pull requests were merged into `main` but are missing from History.markdown:\n\n- #2 Tweak something\n- #3 Fix the tests\n", r.pullRequestBody())
+}
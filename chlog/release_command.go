@@ -0,0 +1,225 @@
+package chlog
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/hashicorp/go-version"
+	"github.com/jekyll/jekyllbot/auth"
+	"github.com/jekyll/jekyllbot/ctx"
+	"github.com/jekyll/jekyllbot/releases"
+)
+
+const releaseIssueLabel = "release"
+
+var (
+	releaseCommentRegexp = regexp.MustCompile(`@[a-zA-Z-_]+: release (major|minor|patch|v?\d+\.\d+\.\d+\S*)`)
+	versionConstRegexp   = regexp.MustCompile(`(VERSION\s*=\s*["'])([^"']+)(["'])`)
+)
+
+// ReleaseCommandHandler handles "@jekyllbot: release minor" comments on
+// release issues. It bumps the version file, turns the unreleased changes
+// in the changelog into the new version, commits both to the default
+// branch and tags the commit, which kicks off CreateReleaseOnTagHandler.
+func ReleaseCommandHandler(context *ctx.Context, payload interface{}) error {
+	event, ok := payload.(*github.IssueCommentEvent)
+	if !ok {
+		return context.NewError("chlog.ReleaseCommandHandler: not an issue comment event")
+	}
+
+	if event.GetAction() != "created" {
+		return context.NewError("chlog.ReleaseCommandHandler: comment action is %q, not created", event.GetAction())
+	}
+
+	matches := releaseCommentRegexp.FindStringSubmatch(event.Comment.GetBody())
+	if matches == nil {
+		return context.NewError("chlog.ReleaseCommandHandler: not a release comment")
+	}
+
+	if event.Issue.PullRequestLinks != nil || !hasLabel(event.Issue.Labels, releaseIssueLabel) {
+		return context.NewError("chlog.ReleaseCommandHandler: not on a release issue")
+	}
+
+	owner, repo, number := *event.Repo.Owner.Login, *event.Repo.Name, *event.Issue.Number
+	context.SetIssue(owner, repo, number)
+	commenter := event.Comment.User.GetLogin()
+	if !auth.CommenterHasPushAccess(context, owner, repo, commenter) {
+		return context.NewError("chlog.ReleaseCommandHandler: %s isn't allowed to release %s/%s", commenter, owner, repo)
+	}
+
+	reply := func(body string) {
+		if _, _, err := context.GitHub.Issues.CreateComment(context.Context(), owner, repo, number, &github.IssueComment{Body: github.String(body)}); err != nil {
+			context.Log("chlog.ReleaseCommandHandler: couldn't comment on %s: %v", context.Issue, err)
+		}
+	}
+
+	latestRelease, err := releases.LatestRelease(context, githubRepo{owner, repo})
+	if err != nil {
+		return context.NewError("chlog.ReleaseCommandHandler: couldn't get the latest release of %s/%s: %v", owner, repo, err)
+	}
+	current := "0.0.0"
+	if latestRelease != nil {
+		current = latestRelease.GetTagName()
+	}
+	next, err := nextVersion(current, matches[1])
+	if err != nil {
+		reply(fmt.Sprintf("I can't release `%s`: %v.", matches[1], err))
+		return context.NewError("chlog.ReleaseCommandHandler: %v", err)
+	}
+
+	branch := defaultBranch(context, owner, repo)
+	ref, _, err := context.GitHub.Git.GetRef(context.Context(), owner, repo, "heads/"+branch)
+	if err != nil {
+		return context.NewError("chlog.ReleaseCommandHandler: couldn't get %s: %v", branch, err)
+	}
+	state, reasons, err := commitChecksState(context, owner, repo, ref.GetObject().GetSHA(), branch)
+	if err != nil {
+		return context.NewError("chlog.ReleaseCommandHandler: couldn't get checks for %s: %v", branch, err)
+	}
+	if state != checksStateSuccess {
+		reply(fmt.Sprintf("I can't release %s because the checks on `%s` aren't green: %s.", next, branch, strings.Join(reasons, ", ")))
+		return context.NewError("chlog.ReleaseCommandHandler: checks on %s/%s@%s are %s", owner, repo, branch, state)
+	}
+
+	tag, err := cutRelease(context, owner, repo, branch, ref.GetObject().GetSHA(), next, commenter)
+	if err != nil {
+		reply(fmt.Sprintf("I couldn't release %s: %v", next, err))
+		return context.NewError("chlog.ReleaseCommandHandler: couldn't release %s/%s %s: %v", owner, repo, next, err)
+	}
+
+	reply(fmt.Sprintf("I bumped the version to %s and tagged it as [`%s`](https://github.com/%s/%s/tree/%s). :rocket: The release notes will follow shortly.",
+		next, tag, owner, repo, tag))
+	return nil
+}
+
+// nextVersion works out the version to release, given the current version
+// and "major", "minor", "patch" or an explicit version, which must be newer.
+func nextVersion(current, bump string) (string, error) {
+	currentVersion, err := version.NewVersion(current)
+	if err != nil {
+		return "", fmt.Errorf("the latest release %q isn't a version", current)
+	}
+	segments := append(currentVersion.Segments(), 0, 0, 0)[:3]
+
+	switch bump {
+	case "major":
+		return fmt.Sprintf("%d.0.0", segments[0]+1), nil
+	case "minor":
+		return fmt.Sprintf("%d.%d.0", segments[0], segments[1]+1), nil
+	case "patch":
+		if currentVersion.Prerelease() != "" {
+			// 1.2.0-rc1 is followed by 1.2.0.
+			return fmt.Sprintf("%d.%d.%d", segments[0], segments[1], segments[2]), nil
+		}
+		return fmt.Sprintf("%d.%d.%d", segments[0], segments[1], segments[2]+1), nil
+	}
+
+	explicit, err := version.NewVersion(bump)
+	if err != nil {
+		return "", fmt.Errorf("%q isn't a version", bump)
+	}
+	if !explicit.GreaterThan(currentVersion) {
+		return "", fmt.Errorf("it isn't newer than the latest release, %s", current)
+	}
+	return strings.TrimPrefix(bump, "v"), nil
+}
+
+// cutRelease commits the version bump and changelog on top of the branch
+// head, fast-forwards the branch and tags the commit. It returns the tag.
+func cutRelease(context *ctx.Context, owner, repo, branch, headSHA, next, requester string) (string, error) {
+	// Don't race a merge's changelog update.
+	lock := historyLocks.forRepo(owner, repo)
+	lock.Lock()
+	defer lock.Unlock()
+
+	config := configForRepo(owner, repo)
+
+	versionFile, err := fileContents(context, owner, repo, config.VersionFile, headSHA)
+	if err != nil {
+		return "", fmt.Errorf("couldn't read %s: %v", config.VersionFile, err)
+	}
+	if !versionConstRegexp.MatchString(versionFile) {
+		return "", fmt.Errorf("couldn't find a VERSION in %s", config.VersionFile)
+	}
+	versionFile = versionConstRegexp.ReplaceAllString(versionFile, "${1}"+next+"${3}")
+
+	historyFile, err := fileContents(context, owner, repo, config.ChangelogFile, headSHA)
+	if err != nil {
+		return "", fmt.Errorf("couldn't read %s: %v", config.ChangelogFile, err)
+	}
+	changes, err := parseChangelogFile(config.ChangelogFormat, historyFile)
+	if err != nil {
+		return "", fmt.Errorf("couldn't parse %s: %v", config.ChangelogFile, err)
+	}
+	if !changes.Release(next, time.Now().UTC().Format("2006-01-02")) {
+		return "", fmt.Errorf("there are no unreleased changes in %s", config.ChangelogFile)
+	}
+
+	head, _, err := context.GitHub.Git.GetCommit(context.Context(), owner, repo, headSHA)
+	if err != nil {
+		return "", err
+	}
+	tree, _, err := context.GitHub.Git.CreateTree(context.Context(), owner, repo, head.GetTree().GetSHA(), []*github.TreeEntry{
+		{Path: github.String(config.VersionFile), Mode: github.String("100644"), Type: github.String("blob"), Content: github.String(versionFile)},
+		{Path: github.String(config.ChangelogFile), Mode: github.String("100644"), Type: github.String("blob"), Content: github.String(changes.String())},
+	})
+	if err != nil {
+		return "", fmt.Errorf("couldn't create tree: %v", err)
+	}
+	commit, _, err := context.GitHub.Git.CreateCommit(context.Context(), owner, repo, &github.Commit{
+		Message: github.String(fmt.Sprintf("Release :gem: %s\n\nRequested by @%s.", next, requester)),
+		Tree:    &github.Tree{SHA: tree.SHA},
+		Parents: []*github.Commit{{SHA: github.String(headSHA)}},
+	}, nil)
+	if err != nil {
+		return "", fmt.Errorf("couldn't create commit: %v", err)
+	}
+
+	// Not forced, so this fails if someone pushed in the meantime.
+	_, _, err = context.GitHub.Git.UpdateRef(context.Context(), owner, repo, &github.Reference{
+		Ref:    github.String("refs/heads/" + branch),
+		Object: &github.GitObject{SHA: commit.SHA},
+	}, false)
+	if err != nil {
+		return "", fmt.Errorf("couldn't update %s: %v", branch, err)
+	}
+
+	tag := "v" + next
+	_, _, err = context.GitHub.Git.CreateRef(context.Context(), owner, repo, &github.Reference{
+		Ref:    github.String("refs/tags/" + tag),
+		Object: &github.GitObject{SHA: commit.SHA},
+	})
+	if err != nil {
+		return "", fmt.Errorf("committed %s, but couldn't tag it: %v", shortSHA(commit.GetSHA()), err)
+	}
+	return tag, nil
+}
+
+func fileContents(context *ctx.Context, owner, repo, path, ref string) (string, error) {
+	contents, _, _, err := context.GitHub.Repositories.GetContents(context.Context(), owner, repo, path, &github.RepositoryContentGetOptions{Ref: ref})
+	if err != nil {
+		return "", err
+	}
+	return contents.GetContent()
+}
+
+func hasLabel(labels []*github.Label, name string) bool {
+	for _, label := range labels {
+		if strings.EqualFold(label.GetName(), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// githubRepo is a releases.Repository.
+type githubRepo struct {
+	owner, name string
+}
+
+func (r githubRepo) Owner() string  { return r.owner }
+func (r githubRepo) Name() string   { return r.name }
+func (r githubRepo) String() string { return r.owner + "/" + r.name }
@@ -0,0 +1,71 @@
+package chlog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReleaseCommentRegexp(t *testing.T) {
+	cases := map[string]string{
+		"@jekyllbot: release minor":  "minor",
+		"@jekyllbot: release patch":  "patch",
+		"@jekyllbot: release major":  "major",
+		"@jekyllbot: release v1.2.3": "v1.2.3",
+		"@jekyllbot: release 4.0.0":  "4.0.0",
+		"@jekyllbot: release soon":   "",
+		"let's release minor":        "",
+	}
+	for input, expected := range cases {
+		matches := releaseCommentRegexp.FindStringSubmatch(input)
+		if expected == "" {
+			assert.Nil(t, matches, "for %q", input)
+		} else if assert.NotNil(t, matches, "for %q", input) {
+			assert.Equal(t, expected, matches[1], "for %q", input)
+		}
+	}
+}
+
+func TestNextVersion(t *testing.T) {
+	cases := []struct{ current, bump, next, err string }{
+		{"v1.2.3", "major", "2.0.0", ""},
+		{"v1.2.3", "minor", "1.3.0", ""},
+		{"v1.2.3", "patch", "1.2.4", ""},
+		{"0.0.0", "minor", "0.1.0", ""},
+		{"v1.2.0-rc1", "patch", "1.2.0", ""},
+		{"v1.2.3", "v1.4.0", "1.4.0", ""},
+		{"v1.2.3", "1.2.3", "", "it isn't newer than the latest release, v1.2.3"},
+		{"nope", "minor", "", `the latest release "nope" isn't a version`},
+	}
+	for _, c := range cases {
+		next, err := nextVersion(c.current, c.bump)
+		if c.err != "" {
+			assert.EqualError(t, err, c.err)
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, c.next, next, "%s + %s", c.current, c.bump)
+		}
+	}
+}
+
+func TestVersionConstRegexp(t *testing.T) {
+	versionFile := "# frozen_string_literal: true\n\nmodule Jekyll\n  VERSION = \"3.1.0\"\nend\n"
+	assert.Equal(t, "# frozen_string_literal: true\n\nmodule Jekyll\n  VERSION = \"3.2.0\"\nend\n",
+		versionConstRegexp.ReplaceAllString(versionFile, "${1}3.2.0${3}"))
+}
+
+func TestChangelogRelease(t *testing.T) {
+	changes, err := parseChangelogFile(ChangelogFormatHistory, "## HEAD\n\n  * New thing (#2)\n\n## 1.0.0 / 2016-01-01\n\n  * Initial release (#1)\n")
+	assert.NoError(t, err)
+	assert.True(t, changes.Release("1.1.0", "2016-02-01"))
+	assert.Equal(t, "## 1.1.0 / 2016-02-01\n\n  * New thing (#2)\n\n## 1.0.0 / 2016-01-01\n\n  * Initial release (#1)\n", changes.String())
+	assert.False(t, changes.Release("1.2.0", "2016-03-01"))
+
+	changes, err = parseChangelogFile(ChangelogFormatKeepAChangelog, keepAChangelogContents)
+	assert.NoError(t, err)
+	assert.True(t, changes.Release("1.1.0", "2017-07-01"))
+	assert.Contains(t, changes.String(), "## [Unreleased]\n\n## [1.1.0] - 2017-07-01\n\n### Fixed\n\n- Fix a thing (#12)\n\n## [1.0.0]")
+	notes, ok := changes.VersionNotes("1.1.0", nil)
+	assert.True(t, ok)
+	assert.Equal(t, "### Fixed\n\n- Fix a thing (#12)", notes)
+}
@@ -0,0 +1,213 @@
+// affinity-report is a CLI which reports, per affinity team and captain,
+// how many issues and PRs were assigned, how quickly captains first
+// responded, how many were closed and how many PRs were reviewed over a
+// date range. The report can be printed as a table, JSON or Markdown, and
+// the Markdown can be posted as a pinned issue or as a discussion. The API
+// can't pin discussions, so a discussion has to be pinned by hand.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/ctx"
+	"github.com/jekyll/jekyllbot/jekyll"
+	"github.com/jekyll/jekyllbot/sentry"
+)
+
+const dateFormat = "2006-01-02"
+
+func main() {
+	var sinceStr string
+	flag.StringVar(&sinceStr, "since", time.Now().AddDate(0, 0, -30).Format(dateFormat), "The first day of the report, e.g. 2026-09-01.")
+	var untilStr string
+	flag.StringVar(&untilStr, "until", time.Now().Format(dateFormat), "The last day of the report, e.g. 2026-09-30.")
+	var format string
+	flag.StringVar(&format, "format", "table", "How to print the report (options: table, json, markdown).")
+	var postTo string
+	flag.StringVar(&postTo, "post", "", "A repo to post the Markdown report to as a pinned issue, e.g. 'jekyll/jekyll'.")
+	var category string
+	flag.StringVar(&category, "discussion-category", "", "Post the report as a discussion in this category instead of as an issue. The discussion isn't pinned.")
+	flag.Parse()
+
+	log.SetPrefix("affinity-report: ")
+
+	sentryClient, err := sentry.NewClient(map[string]string{
+		"app":    "affinity-report",
+		"since":  sinceStr,
+		"until":  untilStr,
+		"format": format,
+		"post":   postTo,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	sentryClient.Recover(func() error {
+		since, err := time.Parse(dateFormat, sinceStr)
+		if err != nil {
+			return fmt.Errorf("-since %q isn't a date: %v", sinceStr, err)
+		}
+		until, err := time.Parse(dateFormat, untilStr)
+		if err != nil {
+			return fmt.Errorf("-until %q isn't a date: %v", untilStr, err)
+		}
+		// Include the whole of the last day.
+		until = until.AddDate(0, 0, 1)
+
+		context := ctx.NewDefaultContext()
+		if context.GitHub == nil {
+			return errors.New("cannot proceed without github client")
+		}
+
+		report, err := jekyll.NewAffinityHandler(context).BuildReport(context, since, until)
+		if err != nil {
+			return err
+		}
+
+		switch format {
+		case "table":
+			fmt.Print(report.Table())
+		case "json":
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(report); err != nil {
+				return err
+			}
+		case "markdown":
+			fmt.Print(report.Markdown())
+		default:
+			return fmt.Errorf("unknown format %q", format)
+		}
+
+		if postTo == "" {
+			return nil
+		}
+		pieces := strings.Split(postTo, "/")
+		if len(pieces) != 2 {
+			return fmt.Errorf("repo %q is improperly formed", postTo)
+		}
+
+		var url string
+		if category != "" {
+			url, err = postDiscussion(context, pieces[0], pieces[1], category, report.Title(), report.Markdown())
+		} else {
+			url, err = postPinnedIssue(context, pieces[0], pieces[1], report.Title(), report.Markdown())
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("posted the report to %s", url)
+		return nil
+	})
+}
+
+// postPinnedIssue opens an issue with the report and pins it to the repo.
+func postPinnedIssue(context *ctx.Context, owner, repo, title, body string) (string, error) {
+	issue, _, err := context.GitHub.Issues.Create(context.Context(), owner, repo, &github.IssueRequest{
+		Title: github.String(title),
+		Body:  github.String(body),
+	})
+	if err != nil {
+		return "", fmt.Errorf("couldn't open issue: %v", err)
+	}
+
+	err = graphQL(context, `mutation($id: ID!) { pinIssue(input: {issueId: $id}) { issue { id } } }`,
+		map[string]interface{}{"id": issue.GetNodeID()}, nil)
+	if err != nil {
+		return issue.GetHTMLURL(), fmt.Errorf("opened %s but couldn't pin it: %v", issue.GetHTMLURL(), err)
+	}
+	return issue.GetHTMLURL(), nil
+}
+
+// postDiscussion starts a discussion with the report in the named category.
+// Discussions are only available through the GraphQL API, which can't pin
+// them, so the discussion is left unpinned.
+func postDiscussion(context *ctx.Context, owner, repo, category, title, body string) (string, error) {
+	var found struct {
+		Repository struct {
+			ID                   string `json:"id"`
+			DiscussionCategories struct {
+				Nodes []struct {
+					ID   string `json:"id"`
+					Name string `json:"name"`
+				} `json:"nodes"`
+			} `json:"discussionCategories"`
+		} `json:"repository"`
+	}
+	err := graphQL(context, `query($owner: String!, $name: String!) {
+		repository(owner: $owner, name: $name) { id discussionCategories(first: 100) { nodes { id name } } }
+	}`, map[string]interface{}{"owner": owner, "name": repo}, &found)
+	if err != nil {
+		return "", fmt.Errorf("couldn't fetch discussion categories: %v", err)
+	}
+
+	var categoryID string
+	for _, node := range found.Repository.DiscussionCategories.Nodes {
+		if strings.EqualFold(node.Name, category) {
+			categoryID = node.ID
+		}
+	}
+	if categoryID == "" {
+		return "", fmt.Errorf("%s/%s has no discussion category %q", owner, repo, category)
+	}
+
+	var created struct {
+		CreateDiscussion struct {
+			Discussion struct {
+				URL string `json:"url"`
+			} `json:"discussion"`
+		} `json:"createDiscussion"`
+	}
+	err = graphQL(context, `mutation($repo: ID!, $category: ID!, $title: String!, $body: String!) {
+		createDiscussion(input: {repositoryId: $repo, categoryId: $category, title: $title, body: $body}) { discussion { url } }
+	}`, map[string]interface{}{
+		"repo":     found.Repository.ID,
+		"category": categoryID,
+		"title":    title,
+		"body":     body,
+	}, &created)
+	if err != nil {
+		return "", fmt.Errorf("couldn't start discussion: %v", err)
+	}
+	return created.CreateDiscussion.Discussion.URL, nil
+}
+
+// graphQL runs the query and decodes its data into result, if given.
+func graphQL(context *ctx.Context, query string, variables map[string]interface{}, result interface{}) error {
+	req, err := context.GitHub.NewRequest("POST", "graphql", map[string]interface{}{
+		"query":     query,
+		"variables": variables,
+	})
+	if err != nil {
+		return err
+	}
+
+	var response struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if _, err := context.GitHub.Do(context.Context(), req, &response); err != nil {
+		return err
+	}
+	if len(response.Errors) > 0 {
+		messages := []string{}
+		for _, e := range response.Errors {
+			messages = append(messages, e.Message)
+		}
+		return errors.New(strings.Join(messages, "; "))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(response.Data, result)
+}
@@ -6,7 +6,10 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/go-github/v73/github"
@@ -33,6 +36,14 @@ var (
 		"security",
 	}
 
+	// Labels which can be used to disable the staleable functionality for a pull request.
+	nonStaleablePullRequestLabels = []string{
+		"pending-rebase",
+		"needs-work",
+		"pinned",
+		"security",
+	}
+
 	// All the repos to apply apply these to.
 	defaultRepos = []repo{
 		{"jekyll", "jekyll"},
@@ -54,7 +65,17 @@ var (
 		{"jekyll", "plugins"},
 	}
 
+	// Accounts whose comments and labels don't count as activity.
+	bots = []string{"jekyllbot"}
+
+	countedActivities = map[string]stale.ActivityActors{
+		"anyone":      stale.AnyoneActivity,
+		"author":      stale.AuthorActivity,
+		"maintainers": stale.MaintainerActivity,
+	}
+
 	twoMonthsAgo = time.Now().AddDate(0, -2, 0)
+	sixMonthsAgo = time.Now().AddDate(0, -6, 0)
 
 	staleIssuesListOptions = &github.IssueListByRepoOptions{
 		State:       "open",
@@ -77,6 +98,32 @@ This issue will automatically be closed in two months if no further activity occ
 `),
 	}
 
+	stalePullRequestComment = &github.IssueComment{
+		Body: github.String(`
+This pull request has been automatically marked as stale because it has not been updated for at least two months.
+
+If you're still working on it, please push your latest changes or leave a comment to let us know, and a maintainer will take another look.
+
+This pull request will automatically be closed in two months if no further activity occurs. Thank you for your contribution!
+`),
+	}
+
+	closingPullRequestComment = &github.IssueComment{
+		Body: github.String(`
+I'm closing this pull request because it has been stale for two months without any activity.
+
+Closing it doesn't mean the change isn't wanted! If you'd like to pick it back up, click **Reopen pull request** below (or comment here and a maintainer will reopen it for you), push your latest changes, and we'll take another look. If the branch has since been deleted, please open a new pull request and link to this one.
+
+Thank you for your contribution!
+`),
+	}
+
+	approvedPullRequestComment = &github.IssueComment{
+		Body: github.String(`
+This pull request has been approved but hasn't been updated for at least two months. Maintainers, could one of you merge it or let the author know what's left to do?
+`),
+	}
+
 	staleNonJekyllIssueComment = &github.IssueComment{
 		Body: github.String(`
 This issue has been automatically marked as stale because it has not been commented on for at least two months.
@@ -97,8 +144,19 @@ func main() {
 	flag.BoolVar(&actuallyDoIt, "f", false, "Whether to actually mark the issues or close them.")
 	var inputRepos string
 	flag.StringVar(&inputRepos, "repos", "", "Specify a list of comma-separated repo name/owner pairs, e.g. 'jekyll/jekyll-import'.")
+	var activity string
+	flag.StringVar(&activity, "activity", "anyone", "Whose activity keeps an issue from going stale (options: anyone, author, maintainers).")
+	var reportFormat string
+	flag.StringVar(&reportFormat, "report", "", "Print a report of what would be done instead of doing it (options: json, csv, markdown).")
+	var applyReport string
+	flag.StringVar(&applyReport, "apply", "", "Take exactly the actions in an approved .json or .csv report. Combine with -f to actually take them.")
 	flag.Parse()
 
+	countedActivity, ok := countedActivities[activity]
+	if !ok {
+		log.Fatalf("unknown -activity %q", activity)
+	}
+
 	if ctx.NewDefaultContext().GitHub == nil {
 		log.Fatalln("cannot proceed without github client")
 	}
@@ -119,25 +177,29 @@ func main() {
 		"app":          "mark-and-sweep-stale-issues",
 		"inputRepos":   inputRepos,
 		"actuallyDoIt": fmt.Sprintf("%t", actuallyDoIt),
+		"activity":     activity,
+		"report":       reportFormat,
+		"apply":        applyReport,
 	})
 	if err != nil {
 		panic(err)
 	}
 
 	sentryClient.Recover(func() error {
+		if applyReport != "" {
+			return applyApprovedReport(applyReport, actuallyDoIt, countedActivity)
+		}
+		if reportFormat != "" {
+			return writeReport(repos, reportFormat, countedActivity)
+		}
+
 		wg, _ := errgroup.WithContext(context.Background())
 		for _, repo := range repos {
 			repo := repo
 			wg.Go(func() error {
 				return stale.MarkAndCloseForRepo(
 					ctx.WithRepo(repo.Owner, repo.Name),
-					stale.Configuration{
-						Perform:             actuallyDoIt,
-						StaleLabels:         staleLabels,
-						ExemptLabels:        nonStaleableLabels,
-						DormantDuration:     time.Since(twoMonthsAgo),
-						NotificationComment: staleIssueComment(repo.Owner, repo.Name),
-					},
+					configuration(repo, actuallyDoIt, countedActivity),
 				)
 			})
 		}
@@ -145,6 +207,97 @@ func main() {
 	})
 }
 
+func configuration(repo repo, perform bool, countedActivity stale.ActivityActors) stale.Configuration {
+	return stale.Configuration{
+		Perform:             perform,
+		StaleLabels:         staleLabels,
+		ExemptLabels:        nonStaleableLabels,
+		DormantDuration:     time.Since(twoMonthsAgo),
+		NotificationComment: staleIssueComment(repo.Owner, repo.Name),
+		CountedActivity:     countedActivity,
+		Bots:                bots,
+		PullRequests: &stale.PullRequestPolicy{
+			DormantDuration: time.Since(twoMonthsAgo),
+			// Drafts are works in progress, so give them longer.
+			DraftDormantDuration: time.Since(sixMonthsAgo),
+			ExemptLabels:         nonStaleablePullRequestLabels,
+			NotificationComment:  stalePullRequestComment,
+			ClosingComment:       closingPullRequestComment,
+			ApprovedComment:      approvedPullRequestComment,
+		},
+	}
+}
+
+// writeReport prints what would be done to every repo's stale issues.
+func writeReport(repos []repo, format string, countedActivity stale.ActivityActors) error {
+	var mu sync.Mutex
+	proposals := []stale.Proposal{}
+
+	wg, _ := errgroup.WithContext(context.Background())
+	for _, repo := range repos {
+		repo := repo
+		wg.Go(func() error {
+			repoProposals, err := stale.ProposeForRepo(
+				ctx.WithRepo(repo.Owner, repo.Name),
+				configuration(repo, false, countedActivity),
+			)
+			mu.Lock()
+			proposals = append(proposals, repoProposals...)
+			mu.Unlock()
+			return err
+		})
+	}
+	err := wg.Wait()
+
+	stale.SortProposals(proposals)
+	if writeErr := stale.WriteReport(os.Stdout, format, proposals); writeErr != nil {
+		return writeErr
+	}
+	return err
+}
+
+// applyApprovedReport takes exactly the actions in the report, as long as
+// each issue is still stale and would still get the same action.
+func applyApprovedReport(path string, perform bool, countedActivity stale.ActivityActors) error {
+	format := strings.TrimPrefix(filepath.Ext(path), ".")
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	proposals, err := stale.ReadReport(f, format)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, proposal := range proposals {
+		pieces := strings.Split(proposal.Repo, "/")
+		if len(pieces) != 2 {
+			log.Printf("%s#%d: repo is improperly formed, skipping", proposal.Repo, proposal.Number)
+			failed++
+			continue
+		}
+		repo := repo{Owner: pieces[0], Name: pieces[1]}
+		err := stale.ApplyProposal(
+			ctx.WithRepo(repo.Owner, repo.Name),
+			configuration(repo, perform, countedActivity),
+			proposal,
+		)
+		if err != nil {
+			log.Printf("%s#%d: skipped %s: %+v", proposal.Repo, proposal.Number, proposal.Action, err)
+			failed++
+		}
+	}
+
+	log.Printf("applied %d of %d approved actions", len(proposals)-failed, len(proposals))
+	if failed > 0 {
+		return fmt.Errorf("%d approved actions weren't applied", failed)
+	}
+	return nil
+}
+
 func staleIssueComment(repoOwner, repoName string) *github.IssueComment {
 	if repoName == "jekyll" {
 		return staleJekyllIssueComment
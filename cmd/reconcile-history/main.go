@@ -0,0 +1,108 @@
+// reconcile-history is a CLI which adds merged pull requests missing from a
+// repo's History.markdown. It opens a pull request with the missing lines,
+// or commits them straight to the default branch with -f.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jekyll/jekyllbot/chlog"
+	"github.com/jekyll/jekyllbot/ctx"
+	"github.com/jekyll/jekyllbot/jekyll"
+	"github.com/jekyll/jekyllbot/releases"
+	"github.com/jekyll/jekyllbot/sentry"
+)
+
+func main() {
+	var perform bool
+	flag.BoolVar(&perform, "f", false, "Whether to commit straight to the default branch (if true) or open a pull request (if false).")
+	var dryRun bool
+	flag.BoolVar(&dryRun, "dry-run", false, "Only print the missing pull requests.")
+	var inputRepos string
+	flag.StringVar(&inputRepos, "repos", "", "Specify a list of comma-separated repo name/owner pairs, e.g. 'jekyll/jekyll-import'.")
+	flag.Parse()
+
+	log.SetPrefix("reconcile-history: ")
+
+	sentryClient, err := sentry.NewClient(map[string]string{
+		"app":        "reconcile-history",
+		"inputRepos": inputRepos,
+		"perform":    fmt.Sprintf("%t", perform),
+		"dryRun":     fmt.Sprintf("%t", dryRun),
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	sentryClient.Recover(func() error {
+		context := ctx.NewDefaultContext()
+		if context.GitHub == nil {
+			return errors.New("cannot proceed without github client")
+		}
+
+		repos := jekyll.DefaultRepos
+		if inputRepos != "" {
+			repos = []jekyll.Repository{}
+			for _, inputRepo := range strings.Split(inputRepos, ",") {
+				pieces := strings.Split(inputRepo, "/")
+				if len(pieces) != 2 {
+					return fmt.Errorf("input repo %q is improperly formed", inputRepo)
+				}
+				repos = append(repos, jekyll.NewRepository(pieces[0], pieces[1]))
+			}
+		}
+
+		for _, repo := range repos {
+			if err := processRepo(context, repo, perform, dryRun); err != nil {
+				log.Printf("%s: %+v", repo, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+func processRepo(context *ctx.Context, repo jekyll.Repository, perform, dryRun bool) error {
+	latestRelease, err := releases.LatestRelease(context, repo)
+	if err != nil {
+		return fmt.Errorf("error fetching latest release: %+v", err)
+	}
+	if latestRelease == nil {
+		log.Printf("%s has no releases, skipping", repo)
+		return nil
+	}
+
+	reconciliation, err := chlog.ReconcileHistory(context, repo.Owner(), repo.Name(), latestRelease.GetCreatedAt().Time)
+	if err != nil {
+		return err
+	}
+
+	if len(reconciliation.Missing) == 0 {
+		log.Printf("%s: %s has every pull request merged since %s", repo, reconciliation.File, latestRelease.GetTagName())
+		return nil
+	}
+
+	for _, pr := range reconciliation.Missing {
+		log.Printf("%s: #%d %q is missing from %s", repo, pr.GetNumber(), pr.GetTitle(), reconciliation.File)
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	var url string
+	if perform {
+		url, err = reconciliation.Commit(context)
+	} else {
+		url, err = reconciliation.OpenPullRequest(context)
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("%s: added %d pull requests to %s in %s", repo, len(reconciliation.Missing), reconciliation.File, url)
+	return nil
+}
@@ -8,6 +8,8 @@ import (
 	"strings"
 
 	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/affinity"
+	"github.com/jekyll/jekyllbot/backport"
 	"github.com/jekyll/jekyllbot/ctx"
 	"github.com/jekyll/jekyllbot/freeze"
 	"github.com/jekyll/jekyllbot/sentry"
@@ -15,6 +17,7 @@ import (
 
 var desiredLabels = []*github.Label{
 	{Name: github.String("accepted"), Color: github.String("4bc865")},
+	{Name: github.String(backport.LabelName), Color: github.String("c5def5")},
 	{Name: github.String("bug"), Color: github.String("d41313")},
 	{Name: github.String("discussion"), Color: github.String("006b75")},
 	{Name: github.String("documentation"), Color: github.String("006b75")},
@@ -27,6 +30,7 @@ var desiredLabels = []*github.Label{
 	{Name: github.String("help-wanted"), Color: github.String("fbca04")},
 	{Name: github.String("internal"), Color: github.String("ededed")},
 	{Name: github.String("needs-documentation"), Color: github.String("b72243")},
+	{Name: github.String(affinity.NeedsTeamLabel), Color: github.String("d4c5f9")},
 	{Name: github.String("needs-tests"), Color: github.String("5140a5")},
 	{Name: github.String("not-reproduced"), Color: github.String("ba1771")},
 	{Name: github.String("pending-feedback"), Color: github.String("fbca04")},
@@ -26,6 +26,7 @@ var (
 	ReleaseEvent                  EventType = "release"
 	RepositoryEvent               EventType = "repository"
 	StatusEvent                   EventType = "status"
+	TeamEvent                     EventType = "team"
 	TeamAddEvent                  EventType = "team_add"
 	WatchEvent                    EventType = "watch"
 	WorkflowJobEvent              EventType = "workflow_job"
@@ -2,10 +2,13 @@
 package jekyll
 
 import (
+	"expvar"
 	"fmt"
+	"time"
 
 	"github.com/jekyll/jekyllbot/affinity"
 	"github.com/jekyll/jekyllbot/autopull"
+	"github.com/jekyll/jekyllbot/backport"
 	"github.com/jekyll/jekyllbot/chlog"
 	"github.com/jekyll/jekyllbot/ctx"
 	"github.com/jekyll/jekyllbot/hooks"
@@ -19,20 +22,25 @@ import (
 )
 
 var jekyllOrgEventHandlers = hooks.EventHandlerMap{
-	hooks.CreateEvent: {chlog.CreateReleaseOnTagHandler},
-	hooks.IssuesEvent: {deprecate.DeprecateOldRepos},
+	hooks.CheckSuiteEvent: {chlog.ProcessMergeQueue},
+	hooks.CreateEvent:     {chlog.CreateReleaseOnTagHandler},
+	hooks.IssuesEvent:     {deprecate.DeprecateOldRepos},
 	hooks.IssueCommentEvent: {
 		issuecomment.PendingFeedbackUnlabeler,
 		issuecomment.StaleUnlabeler,
 		chlog.MergeAndLabel,
+		chlog.CancelQueuedMerge,
+		chlog.ReleaseCommandHandler,
+		backport.BackportHandler,
 	},
 	hooks.PullRequestEvent: {
 		labeler.IssueHasPullRequestLabeler,
 		labeler.PendingRebaseNeedsWorkPRUnlabeler,
+		chlog.MilestoneMergedPullRequest,
 	},
-	hooks.PullRequestReviewEvent: {chlog.MergeAndLabel},
-	hooks.ReleaseEvent:           {chlog.CloseMilestoneOnRelease},
-	hooks.StatusEvent:            {statStatus, travis.FailingFmtBuildHandler},
+	hooks.PullRequestReviewEvent: {chlog.MergeAndLabel, chlog.ProcessMergeQueue},
+	hooks.ReleaseEvent:           {chlog.CloseMilestoneOnRelease, chlog.CommentOnReleasedIssues},
+	hooks.StatusEvent:            {statStatus, travis.FailingFmtBuildHandler, chlog.ProcessMergeQueue},
 }
 
 func statStatus(context *ctx.Context, payload interface{}) error {
@@ -58,19 +66,31 @@ func statStatus(context *ctx.Context, payload interface{}) error {
 	return nil
 }
 
-func jekyllAffinityHandler(context *ctx.Context) *affinity.Handler {
+// NewAffinityHandler returns the affinity handler configured with the org's
+// repos and teams.
+func NewAffinityHandler(context *ctx.Context) *affinity.Handler {
 	handler := &affinity.Handler{}
 
 	handler.AddRepo("jekyll", "jekyll")
 	handler.AddRepo("jekyll", "minima")
-
-	handler.AddTeam(context, 3083652, 1961060) // @jekyll/build
-	handler.AddTeam(context, 3083652, 1961072) // @jekyll/documentation
-	handler.AddTeam(context, 3083652, 1961061) // @jekyll/ecosystem
-	handler.AddTeam(context, 3083652, 1961065) // @jekyll/performance
-	handler.AddTeam(context, 3083652, 1961059) // @jekyll/stability
-	handler.AddTeam(context, 3083652, 1116640) // @jekyll/windows
-
+	handler.EnableAskForTeam("jekyll", "jekyll", 7)
+	handler.SetSelectionStrategy(affinity.LeastLoadedSelection)
+
+	for _, teamID := range []int64{
+		1961060, // @jekyll/build
+		1961072, // @jekyll/documentation
+		1961061, // @jekyll/ecosystem
+		1961065, // @jekyll/performance
+		1961059, // @jekyll/stability
+		1116640, // @jekyll/windows
+	} {
+		if err := handler.AddTeam(context, 3083652, teamID); err != nil {
+			context.Log("affinity: couldn't fetch team %d, will retry: %v", teamID, err)
+		}
+	}
+	handler.SetFallbackTeam(1961059)               // @jekyll/stability
+	handler.AddTeamLabel("documentation", 1961072) // @jekyll/documentation
+	handler.AddTeamLabel("windows", 1116640)       // @jekyll/windows
 	context.Log("affinity teams: %+v", handler.GetTeams())
 	context.Log("affinity team repos: %+v", handler.GetRepos())
 
@@ -103,18 +123,50 @@ func newLgtmHandler() *lgtm.Handler {
 	handler.AddRepo("jekyll", "minima", 1)
 	handler.AddRepo("jekyll", "plugins", 1)
 
+	// Docs-only changes to jekyll/jekyll need fewer sign-offs than changes to the gem.
+	handler.AddQuorumRule("jekyll", "jekyll", lgtm.QuorumRule{Name: "docs", Paths: []string{"docs/**"}, Quorum: 1})
+	handler.AddQuorumRule("jekyll", "jekyll", lgtm.QuorumRule{Name: "lib", Paths: []string{"lib/**", "exe/**", "*.gemspec"}, Quorum: 2})
+	handler.SetStaleApprovalPolicy("jekyll", "jekyll", lgtm.ResetApprovalsOnNonTrivialPush)
+
+	// A repo opts in to a Check Run, with a summary of who approved and who
+	// may, instead of a commit status with handler.EnableCheckRun(owner, name).
+	// Only GitHub Apps can create Check Runs, so only enable it when the bot's
+	// token belongs to one.
+
 	return handler
 }
 
 func NewJekyllOrgHandler(context *ctx.Context) *hooks.GlobalHandler {
-	affinityHandler := jekyllAffinityHandler(context)
+	affinityHandler := NewAffinityHandler(context)
+	affinityHandler.StartRefreshingTeams(context, 6*time.Hour)
+	affinityHandler.StartRemindingAboutTeams(context, 6*time.Hour)
+	affinityHandler.StartEscalating(context, 6*time.Hour)
+	go func() {
+		if err := affinityHandler.RestoreVacations(context, time.Now().AddDate(0, -3, 0)); err != nil {
+			context.Log("affinity: %v", err)
+		}
+	}()
+	go func() {
+		if err := chlog.RestoreMergeQueue(context, "jekyll"); err != nil {
+			context.Log("chlog: %v", err)
+		}
+	}()
+	expvar.Publish("affinity_teams", expvar.Func(func() interface{} { return affinityHandler.Roster() }))
 	jekyllOrgEventHandlers.AddHandler(hooks.IssuesEvent, affinityHandler.AssignIssueToAffinityTeamCaptain)
 	jekyllOrgEventHandlers.AddHandler(hooks.IssueCommentEvent, affinityHandler.AssignIssueToAffinityTeamCaptainFromComment)
+	jekyllOrgEventHandlers.AddHandler(hooks.IssueCommentEvent, affinityHandler.UnavailableCommandHandler)
+	jekyllOrgEventHandlers.AddHandler(hooks.MembershipEvent, affinityHandler.RefreshTeamHandler)
+	jekyllOrgEventHandlers.AddHandler(hooks.TeamEvent, affinityHandler.RefreshTeamHandler)
 	jekyllOrgEventHandlers.AddHandler(hooks.PullRequestEvent, affinityHandler.AssignPRToAffinityTeamCaptain)
 	jekyllOrgEventHandlers.AddHandler(hooks.PullRequestEvent, affinityHandler.RequestReviewFromAffinityTeamCaptains)
 
 	lgtmHandler := newLgtmHandler()
+	for _, repo := range lgtmHandler.GetRepos() {
+		// Queued merges wait for the LGTM quorum as well as CI.
+		chlog.SetRepoConfig(repo.Owner, repo.Name, chlog.RepoConfig{RequireLGTM: true})
+	}
 	jekyllOrgEventHandlers.AddHandler(hooks.PullRequestReviewEvent, lgtmHandler.PullRequestReviewHandler)
+	jekyllOrgEventHandlers.AddHandler(hooks.CheckRunEvent, lgtmHandler.CheckRunHandler)
 
 	autopullHandler := autopull.Handler{}
 	autopullHandler.AcceptAllRepos(true)
@@ -0,0 +1,310 @@
+package lgtm
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/auth"
+	"github.com/jekyll/jekyllbot/ctx"
+)
+
+// reevaluateActionIdentifier is sent back to us in the check_run
+// requested_action event when someone clicks the "Re-evaluate" button.
+const reevaluateActionIdentifier = "reevaluate"
+
+// eligibleApproversTTL is how long the list of who may approve a repo's
+// PRs is reused for in Check Run summaries.
+const eligibleApproversTTL = time.Hour
+
+var (
+	reevaluateAction = &github.CheckRunAction{
+		Label:       "Re-evaluate",
+		Description: "Recount LGTM's from comments & reviews",
+		Identifier:  reevaluateActionIdentifier,
+	}
+
+	eligibleApprovers = eligibleApproversMap{data: make(map[string]eligibleApproversEntry)}
+)
+
+type eligibleApproversEntry struct {
+	logins    []string
+	fetchedAt time.Time
+}
+
+type eligibleApproversMap struct {
+	sync.Mutex // protects 'data'
+	data       map[string]eligibleApproversEntry
+}
+
+// get returns the logins of everyone with push access to the repo, fetching
+// them again if they're older than eligibleApproversTTL.
+func (m *eligibleApproversMap) get(context *ctx.Context, owner, name string, now time.Time) []string {
+	key := owner + "/" + name
+	m.Lock()
+	entry, ok := m.data[key]
+	m.Unlock()
+	if ok && now.Sub(entry.fetchedAt) < eligibleApproversTTL {
+		return entry.logins
+	}
+
+	logins := auth.UsersWithPushAccess(context, owner, name)
+	m.Lock()
+	m.data[key] = eligibleApproversEntry{logins: logins, fetchedAt: now}
+	m.Unlock()
+	return logins
+}
+
+// CheckRunHandler recalculates the approval of a pull request when the
+// "Re-evaluate" button on the LGTM Check Run is clicked.
+func (h *Handler) CheckRunHandler(context *ctx.Context, payload interface{}) error {
+	event, ok := payload.(*github.CheckRunEvent)
+	if !ok {
+		return context.NewError("lgtm.CheckRunHandler: not a check run event")
+	}
+
+	if event.GetAction() != "requested_action" ||
+		event.RequestedAction == nil ||
+		event.RequestedAction.Identifier != reevaluateActionIdentifier {
+		return context.NewError("lgtm.CheckRunHandler: not a re-evaluate request")
+	}
+
+	owner, name := *event.Repo.Owner.Login, *event.Repo.Name
+	if event.CheckRun.GetName() != lgtmContext(owner) {
+		return context.NewError("lgtm.CheckRunHandler: not the %s check run", lgtmContext(owner))
+	}
+
+	if len(event.CheckRun.PullRequests) == 0 {
+		return context.NewError("lgtm.CheckRunHandler: check run %d has no pull request", event.CheckRun.GetID())
+	}
+
+	ref := h.newPRRef(owner, name, event.CheckRun.PullRequests[0].GetNumber())
+
+	if !h.isEnabledFor(ref.Repo.Owner, ref.Repo.Name) {
+		return context.NewError("lgtm.CheckRunHandler: not enabled for %s", ref)
+	}
+
+	info, err := recalculateStatus(context, ref, event.CheckRun.GetHeadSHA())
+	if err != nil {
+		return context.NewError("lgtm.CheckRunHandler: couldn't recalculate status for %s: %v", ref, err)
+	}
+	info.checkRunID = event.CheckRun.GetID()
+
+	if err := setStatus(context, ref, info.sha, info); err != nil {
+		return context.NewError("lgtm.CheckRunHandler: couldn't update check run on %s: %v", ref, err)
+	}
+	return nil
+}
+
+// recalculateStatus builds a fresh statusInfo for the given head SHA by
+// reading every comment and review on the pull request, rather than
+// trusting the status description or our cache. Approvals given before the
+// repo's stale approval policy would have reset them are ignored.
+func recalculateStatus(context *ctx.Context, ref prRef, sha string) (*statusInfo, error) {
+	rule, err := ruleForPR(context, ref)
+	if err != nil {
+		return nil, err
+	}
+	info := newStatusForRule(sha, rule)
+
+	cutoff, err := approvalCutoff(context, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	retractedAt := map[string]time.Time{}
+	commentOpts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		comments, resp, err := context.GitHub.Issues.ListComments(
+			context.Context(), ref.Repo.Owner, ref.Repo.Name, ref.Number, commentOpts)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, comment := range comments {
+			login := comment.GetUser().GetLogin()
+			if comment.GetCreatedAt().Before(cutoff) {
+				continue
+			}
+			if lgtmRetractionRegexp.MatchString(comment.GetBody()) {
+				if info.removeLGTMer(login) {
+					retractedAt[login] = comment.GetCreatedAt().Time
+				}
+				continue
+			}
+			if !lgtmBodyRegexp.MatchString(comment.GetBody()) || info.IsLGTMer(login) {
+				continue
+			}
+			if !auth.CommenterHasPushAccess(context, ref.Repo.Owner, ref.Repo.Name, login) {
+				continue
+			}
+			info.addLGTMer(login, comment.GetHTMLURL(), approvalSourceComment)
+			satisfyRequiredTeams(context, info, login)
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		commentOpts.ListOptions.Page = resp.NextPage
+	}
+
+	// Only a reviewer's most recent approving or blocking review counts.
+	latestReviews := map[string]*github.PullRequestReview{}
+	reviewers := []string{}
+	reviewOpts := &github.ListOptions{PerPage: 100}
+	for {
+		reviews, resp, err := context.GitHub.PullRequests.ListReviews(
+			context.Context(), ref.Repo.Owner, ref.Repo.Name, ref.Number, reviewOpts)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, review := range reviews {
+			if review.GetState() == "COMMENTED" || review.GetState() == "PENDING" {
+				continue
+			}
+			if review.GetSubmittedAt().Before(cutoff) {
+				continue
+			}
+			login := review.GetUser().GetLogin()
+			if _, ok := latestReviews[login]; !ok {
+				reviewers = append(reviewers, login)
+			}
+			latestReviews[login] = review
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		reviewOpts.Page = resp.NextPage
+	}
+
+	for _, login := range reviewers {
+		review := latestReviews[login]
+		if review.GetState() != "APPROVED" || info.IsLGTMer(login) {
+			continue
+		}
+		if retracted, ok := retractedAt[login]; ok && review.GetSubmittedAt().Before(retracted) {
+			continue
+		}
+		if !auth.CommenterHasPushAccess(context, ref.Repo.Owner, ref.Repo.Name, login) {
+			continue
+		}
+		info.addLGTMer(login, review.GetHTMLURL(), approvalSourceReview)
+		satisfyRequiredTeams(context, info, login)
+	}
+
+	checkRuns, _, err := context.GitHub.Checks.ListCheckRunsForRef(
+		context.Context(), ref.Repo.Owner, ref.Repo.Name, sha,
+		&github.ListCheckRunsOptions{CheckName: github.String(lgtmContext(ref.Repo.Owner))})
+	if err != nil {
+		return nil, err
+	}
+	if len(checkRuns.CheckRuns) > 0 {
+		info.checkRunID = checkRuns.CheckRuns[0].GetID()
+	}
+
+	return info, nil
+}
+
+// setCheckRun creates or updates the LGTM Check Run for the given SHA.
+func setCheckRun(context *ctx.Context, ref prRef, sha string, status *statusInfo) error {
+	eligible := eligibleApprovers.get(context, ref.Repo.Owner, ref.Repo.Name, time.Now())
+	output := &github.CheckRunOutput{
+		Title:   github.String(status.newDescription()),
+		Summary: github.String(status.newCheckRunSummary(eligible)),
+	}
+
+	runStatus := github.String("in_progress")
+	var conclusion *string
+	var completedAt *github.Timestamp
+	if status.newState() == "success" {
+		runStatus = github.String("completed")
+		conclusion = github.String("success")
+		completedAt = &github.Timestamp{Time: time.Now()}
+	}
+
+	var checkRun *github.CheckRun
+	var err error
+	if status.checkRunID == 0 {
+		checkRun, _, err = context.GitHub.Checks.CreateCheckRun(
+			context.Context(), ref.Repo.Owner, ref.Repo.Name,
+			github.CreateCheckRunOptions{
+				Name:        lgtmContext(ref.Repo.Owner),
+				HeadSHA:     sha,
+				Status:      runStatus,
+				Conclusion:  conclusion,
+				CompletedAt: completedAt,
+				Output:      output,
+				Actions:     []*github.CheckRunAction{reevaluateAction},
+			})
+	} else {
+		checkRun, _, err = context.GitHub.Checks.UpdateCheckRun(
+			context.Context(), ref.Repo.Owner, ref.Repo.Name, status.checkRunID,
+			github.UpdateCheckRunOptions{
+				Name:        lgtmContext(ref.Repo.Owner),
+				Status:      runStatus,
+				Conclusion:  conclusion,
+				CompletedAt: completedAt,
+				Output:      output,
+				Actions:     []*github.CheckRunAction{reevaluateAction},
+			})
+	}
+	if err != nil {
+		return err
+	}
+
+	status.checkRunID = checkRun.GetID()
+	return nil
+}
+
+// newCheckRunSummary produces the markdown summary for the Check Run: who
+// approved and where, how many more approvals are needed, and who may
+// approve.
+func (s statusInfo) newCheckRunSummary(eligible []string) string {
+	var summary strings.Builder
+
+	if s.quorum == 0 {
+		summary.WriteString("No approval is required.\n")
+	} else if remaining := s.quorum - len(s.lgtmers); remaining > 0 {
+		fmt.Fprintf(&summary, "**%d of %d** required approvals. %s\n", len(s.lgtmers), s.quorum, s.newLGTMsRequiredDescription())
+	} else {
+		fmt.Fprintf(&summary, "**%d of %d** required approvals. The quorum has been met.\n", len(s.lgtmers), s.quorum)
+	}
+
+	if len(s.missingTeams) > 0 {
+		fmt.Fprintf(&summary, "\nStill needs approval from a member of: %s.\n", strings.Join(s.missingTeams, ", "))
+	}
+	if s.rule != "" {
+		fmt.Fprintf(&summary, "\nThe **%s** quorum rule applies to the files changed in this pull request.\n", s.rule)
+	}
+
+	summary.WriteString("\n### Approved by\n\n")
+	if len(s.lgtmers) == 0 {
+		summary.WriteString("Nobody yet.\n")
+	}
+	for _, lgtmer := range s.lgtmers {
+		if approval, ok := s.approvals[lgtmer]; ok {
+			fmt.Fprintf(&summary, "- %s ([%s](%s))\n", lgtmer, approval.Source, approval.URL)
+		} else {
+			fmt.Fprintf(&summary, "- %s\n", lgtmer)
+		}
+	}
+
+	summary.WriteString("\n### Eligible to approve\n\n")
+	if len(eligible) == 0 {
+		summary.WriteString("Anyone with push access to this repository.\n")
+	} else {
+		mentions := make([]string, len(eligible))
+		for i, login := range eligible {
+			mentions[i] = "`" + login + "`"
+		}
+		summary.WriteString(strings.Join(mentions, ", ") + "\n")
+	}
+
+	summary.WriteString("\nComment `LGTM` to approve. Click **Re-evaluate** to recount approvals from comments and reviews.\n")
+
+	return summary.String()
+}
@@ -0,0 +1,187 @@
+package lgtm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCheckRunSummary(t *testing.T) {
+	info := statusInfo{quorum: 2}
+	info.addLGTMer("parkr", "https://github.com/o/r/pull/273#issuecomment-1", approvalSourceComment)
+
+	summary := info.newCheckRunSummary([]string{"mattr-", "parkr"})
+	assert.Contains(t, summary, "**1 of 2** required approvals. Requires 1 more LGTM.")
+	assert.Contains(t, summary, "- @parkr ([comment](https://github.com/o/r/pull/273#issuecomment-1))")
+	assert.Contains(t, summary, "`mattr-`, `parkr`")
+
+	info.addLGTMer("@mattr-", "https://github.com/o/r/pull/273#pullrequestreview-2", approvalSourceReview)
+	summary = info.newCheckRunSummary(nil)
+	assert.Contains(t, summary, "**2 of 2** required approvals. The quorum has been met.")
+	assert.Contains(t, summary, "- @mattr- ([review](https://github.com/o/r/pull/273#pullrequestreview-2))")
+	assert.Contains(t, summary, "Anyone with push access to this repository.")
+
+	summary = statusInfo{}.newCheckRunSummary(nil)
+	assert.Contains(t, summary, "No approval is required.")
+	assert.Contains(t, summary, "Nobody yet.")
+}
+
+func TestSetStatusCheckRun(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+	statusCache = statusMap{data: make(map[string]*statusInfo)}
+
+	checkRunRef := ref
+	checkRunRef.Repo.CheckRun = true
+
+	created := false
+	mux.HandleFunc(fmt.Sprintf("/repos/%s/%s/check-runs", ref.Repo.Owner, ref.Repo.Name), func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+		created = true
+
+		v := new(github.CreateCheckRunOptions)
+		json.NewDecoder(r.Body).Decode(v)
+		assert.Equal(t, "o/lgtm", v.Name)
+		assert.Equal(t, prSHA, v.HeadSHA)
+		assert.Equal(t, "in_progress", v.GetStatus())
+		assert.Equal(t, "Awaiting approval from at least 1 maintainer.", v.Output.GetTitle())
+		assert.Len(t, v.Actions, 1)
+		assert.Equal(t, reevaluateActionIdentifier, v.Actions[0].Identifier)
+		fmt.Fprint(w, `{"id":42}`)
+	})
+
+	updated := false
+	mux.HandleFunc(fmt.Sprintf("/repos/%s/%s/check-runs/42", ref.Repo.Owner, ref.Repo.Name), func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "PATCH")
+		updated = true
+
+		v := new(github.UpdateCheckRunOptions)
+		json.NewDecoder(r.Body).Decode(v)
+		assert.Equal(t, "completed", v.GetStatus())
+		assert.Equal(t, "success", v.GetConclusion())
+		assert.Equal(t, "Approved by @parkr.", v.Output.GetTitle())
+		fmt.Fprint(w, `{"id":42}`)
+	})
+
+	info := &statusInfo{lgtmers: []string{}, sha: prSHA, quorum: 1}
+	assert.NoError(t, setStatus(context, checkRunRef, prSHA, info))
+	assert.True(t, created, "the check run should be created")
+	assert.Equal(t, int64(42), info.checkRunID)
+
+	info.addLGTMer("parkr", "", approvalSourceComment)
+	assert.NoError(t, setStatus(context, checkRunRef, prSHA, info))
+	assert.True(t, updated, "the existing check run should be updated")
+	assert.Equal(t, info, statusCache.data[ref.String()])
+}
+
+func TestCheckRunHandlerIgnoresOtherActions(t *testing.T) {
+	context := ctx.NewTestContext()
+	err := handler.CheckRunHandler(context, &github.CheckRunEvent{Action: github.String("created")})
+	assert.EqualError(t, err, "lgtm.CheckRunHandler: not a re-evaluate request")
+
+	err = handler.CheckRunHandler(context, &github.CheckRunEvent{
+		Action:          github.String("requested_action"),
+		RequestedAction: &github.RequestedAction{Identifier: reevaluateActionIdentifier},
+		CheckRun:        &github.CheckRun{Name: github.String("ci/build")},
+		Repo: &github.Repository{
+			Owner: &github.User{Login: github.String("o")},
+			Name:  github.String("r"),
+		},
+	})
+	assert.EqualError(t, err, "lgtm.CheckRunHandler: not the o/lgtm check run")
+}
+
+func TestIssueCommentHandlerRecountsOnEmptyCache(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+	statusCache = statusMap{data: make(map[string]*statusInfo)}
+
+	checkRunHandler := &Handler{repos: []Repo{{Owner: "o", Name: "r", Quorum: 1, CheckRun: true}}}
+
+	mux.HandleFunc("/orgs/o/teams", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id":1}]`)
+	})
+	mux.HandleFunc("/orgs/o", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":2}`)
+	})
+	mux.HandleFunc("/organizations/2/team/1/memberships/parkr", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"state":"active"}`)
+	})
+	mux.HandleFunc("/organizations/2/team/1/repos/o/r", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"permissions":{"push":true}}`)
+	})
+	mux.HandleFunc("/organizations/2/team/1/members", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"login":"parkr"}]`)
+	})
+	mux.HandleFunc(pullRequestGET, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"number":273,"head":{"sha":%q}}`, prSHA)
+	})
+	mux.HandleFunc("/repos/o/r/pulls/273/commits", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"sha":%q}]`, prSHA)
+	})
+	mux.HandleFunc("/repos/o/r/issues/273/timeline", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	})
+	mux.HandleFunc("/repos/o/r/issues/273/comments", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id":3,"body":"LGTM","user":{"login":"parkr"},"created_at":"2024-01-02T00:00:00Z"}]`)
+	})
+	mux.HandleFunc("/repos/o/r/pulls/273/reviews", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	})
+	mux.HandleFunc(fmt.Sprintf("/repos/o/r/commits/%s/check-runs", prSHA), func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"total_count":1,"check_runs":[{"id":42,"started_at":"2024-01-01T00:00:00Z"}]}`)
+	})
+	updated := false
+	mux.HandleFunc("/repos/o/r/check-runs/42", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "PATCH")
+		updated = true
+
+		v := new(github.UpdateCheckRunOptions)
+		json.NewDecoder(r.Body).Decode(v)
+		assert.Equal(t, "success", v.GetConclusion())
+		assert.Equal(t, "Approved by @parkr.", v.Output.GetTitle())
+		fmt.Fprint(w, `{"id":42}`)
+	})
+
+	err := checkRunHandler.IssueCommentHandler(context, &github.IssueCommentEvent{
+		Comment: &github.IssueComment{ID: github.Int64(3), Body: github.String("LGTM"), User: &github.User{Login: github.String("parkr")}},
+		Issue:   &github.Issue{Number: github.Int(273), PullRequestLinks: &github.PullRequestLinks{}},
+		Repo: &github.Repository{
+			Owner: &github.User{Login: github.String("o")},
+			Name:  github.String("r"),
+		},
+	})
+	assert.NoError(t, err)
+	assert.True(t, updated, "the recounted LGTM should be published on the check run")
+}
+
+func TestEligibleApproversCached(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+	now := time.Date(2026, time.January, 1, 12, 0, 0, 0, time.UTC)
+	eligibleApprovers = eligibleApproversMap{data: map[string]eligibleApproversEntry{
+		"o/fresh":  {logins: []string{"parkr"}, fetchedAt: now.Add(-time.Minute)},
+		"o2/stale": {logins: []string{"parkr"}, fetchedAt: now.Add(-2 * eligibleApproversTTL)},
+	}}
+	defer func() { eligibleApprovers = eligibleApproversMap{data: make(map[string]eligibleApproversEntry)} }()
+
+	mux.HandleFunc("/orgs/o/teams", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("the fresh list shouldn't be fetched again")
+	})
+	assert.Equal(t, []string{"parkr"}, eligibleApprovers.get(context, "o", "fresh", now))
+
+	mux.HandleFunc("/orgs/o2/teams", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	})
+	assert.Empty(t, eligibleApprovers.get(context, "o2", "stale", now), "the stale list is fetched again")
+	assert.Equal(t, now, eligibleApprovers.data["o2/stale"].fetchedAt)
+}
@@ -4,6 +4,7 @@ package lgtm
 import (
 	"fmt"
 	"regexp"
+	"time"
 
 	"github.com/google/go-github/v73/github"
 	"github.com/jekyll/jekyllbot/auth"
@@ -25,6 +26,14 @@ type Repo struct {
 	Owner, Name string
 	// The number of LGTM's a PR must get before going state: "success"
 	Quorum int
+	// Whether to publish a Check Run instead of a commit status.
+	CheckRun bool
+	// Path-based rules which override Quorum for the files they match.
+	Rules []QuorumRule
+	// What happens to LGTM's when new commits are pushed.
+	StaleApprovals StaleApprovalPolicy
+	// Files which don't invalidate LGTM's under ResetApprovalsOnNonTrivialPush.
+	TrivialPaths []string
 }
 
 type Handler struct {
@@ -43,10 +52,25 @@ func (h *Handler) AddRepo(owner, name string, quorum int) {
 	}
 }
 
+// EnableCheckRun publishes the LGTM approval for the given repo as a Check
+// Run with a markdown summary rather than as a one-line commit status. The
+// bot must be authenticated as a GitHub App with write access to checks,
+// and receive check_run events for CheckRunHandler.
+func (h *Handler) EnableCheckRun(owner, name string) {
+	if repo := h.findRepo(owner, name); repo != nil {
+		repo.CheckRun = true
+	}
+}
+
+// GetRepos returns the repos the handler is enabled for.
+func (h *Handler) GetRepos() []Repo {
+	return append([]Repo{}, h.repos...)
+}
+
 func (h *Handler) findRepo(owner, name string) *Repo {
-	for _, repo := range h.repos {
-		if repo.Owner == owner && repo.Name == name {
-			return &repo
+	for i := range h.repos {
+		if h.repos[i].Owner == owner && h.repos[i].Name == name {
+			return &h.repos[i]
 		}
 	}
 
@@ -77,8 +101,9 @@ func (h *Handler) IssueCommentHandler(context *ctx.Context, payload interface{})
 		return context.NewError("lgtm.IssueCommentHandler: not an issue comment event")
 	}
 
-	// LGTM comment?
-	if !lgtmBodyRegexp.MatchString(*comment.Comment.Body) {
+	// LGTM or retraction comment?
+	isRetraction := lgtmRetractionRegexp.MatchString(*comment.Comment.Body)
+	if !isRetraction && !lgtmBodyRegexp.MatchString(*comment.Comment.Body) {
 		return context.NewError("lgtm.IssueCommentHandler: not a LGTM comment")
 	}
 
@@ -102,18 +127,26 @@ func (h *Handler) IssueCommentHandler(context *ctx.Context, payload interface{})
 	}
 
 	// Get status
-	info, err := getStatus(context, ref)
+	info, recounted, err := loadStatus(context, ref)
 	if err != nil {
 		return context.NewError("lgtm.IssueCommentHandler: couldn't get status for %s: %v", ref, err)
 	}
 
-	// Already LGTM'd by you? Exit.
-	if info.IsLGTMer(lgtmer) {
+	if isRetraction {
+		return retractLGTM(context, ref, info, lgtmer, recounted)
+	}
+
+	// Already LGTM'd by you? Exit, unless the recount just picked up this
+	// very comment, in which case it still needs to be published.
+	if info.IsLGTMer(lgtmer) && !recounted {
 		return context.NewError(
 			"lgtm.IssueCommentHandler: no duplicate LGTM allowed for @%s on %s", lgtmer, ref)
 	}
 
-	info.lgtmers = append(info.lgtmers, "@"+lgtmer)
+	if !info.IsLGTMer(lgtmer) {
+		info.addLGTMer(lgtmer, comment.Comment.GetHTMLURL(), approvalSourceComment)
+		satisfyRequiredTeams(context, info, lgtmer)
+	}
 	if err := setStatus(context, ref, info.sha, info); err != nil {
 		return context.NewError(
 			"lgtm.IssueCommentHandler: had trouble adding lgtmer '%s' on %s: %v",
@@ -122,6 +155,27 @@ func (h *Handler) IssueCommentHandler(context *ctx.Context, payload interface{})
 	return nil
 }
 
+// retractLGTM removes the lgtmer's LGTM and publishes the status. If the
+// status was just recounted, the retraction is already accounted for.
+func retractLGTM(context *ctx.Context, ref prRef, info *statusInfo, lgtmer string, recounted bool) error {
+	if !info.removeLGTMer(lgtmer) && !recounted {
+		return context.NewError(
+			"lgtm.IssueCommentHandler: @%s has no LGTM to retract on %s", lgtmer, ref)
+	}
+
+	if err := recomputeRequiredTeams(context, ref, info); err != nil {
+		return context.NewError(
+			"lgtm.IssueCommentHandler: couldn't determine required teams for %s: %v", ref, err)
+	}
+
+	if err := setStatus(context, ref, info.sha, info); err != nil {
+		return context.NewError(
+			"lgtm.IssueCommentHandler: had trouble removing lgtmer '%s' on %s: %v",
+			lgtmer, ref, err)
+	}
+	return nil
+}
+
 func (h *Handler) PullRequestHandler(context *ctx.Context, payload interface{}) error {
 	event, ok := payload.(*github.PullRequestEvent)
 	if !ok {
@@ -135,11 +189,22 @@ func (h *Handler) PullRequestHandler(context *ctx.Context, payload interface{})
 	}
 
 	if *event.Action == "opened" || *event.Action == "synchronize" {
-		err := setStatus(context, ref, *event.PullRequest.Head.SHA, &statusInfo{
-			lgtmers: []string{},
-			quorum:  ref.Repo.Quorum,
-			sha:     *event.PullRequest.Head.SHA,
-		})
+		pushTimes.record(ref, *event.PullRequest.Head.SHA, time.Now())
+
+		rule, err := ruleForPR(context, ref)
+		if err != nil {
+			return context.NewError(
+				"lgtm.PullRequestHandler: could not determine quorum rule for %s: %v",
+				ref, err,
+			)
+		}
+
+		info := newStatusForRule(*event.PullRequest.Head.SHA, rule)
+		if *event.Action == "synchronize" {
+			h.carryApprovalsOnPush(context, ref, event.GetBefore(), info)
+		}
+
+		err = setStatus(context, ref, *event.PullRequest.Head.SHA, info)
 		if err != nil {
 			return context.NewError(
 				"lgtm.PullRequestHandler: could not create status on %s: %v",
@@ -151,6 +216,26 @@ func (h *Handler) PullRequestHandler(context *ctx.Context, payload interface{})
 	return nil
 }
 
+// carryApprovalsOnPush copies the LGTM's from the previous head onto the
+// new status if the repo's stale approval policy allows it.
+func (h *Handler) carryApprovalsOnPush(context *ctx.Context, ref prRef, before string, info *statusInfo) {
+	keep, err := keepsApprovals(context, ref, before, info.sha)
+	if err != nil {
+		context.Log("lgtm.PullRequestHandler: couldn't compare %s...%s on %s, resetting approvals: %v", before, info.sha, ref, err)
+		return
+	}
+	if !keep {
+		return
+	}
+
+	previous, err := getStatusForSHA(context, ref, before)
+	if err != nil {
+		context.Log("lgtm.PullRequestHandler: couldn't get previous status for %s on %s, resetting approvals: %v", before, ref, err)
+		return
+	}
+	info.carryApprovalsFrom(context, previous)
+}
+
 func (h *Handler) PullRequestReviewHandler(context *ctx.Context, payload interface{}) error {
 	return context.NewError("lgtm.PullRequestReviewHandler: pull request review webhooks aren't implemented yet")
 
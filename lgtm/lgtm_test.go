@@ -24,3 +24,23 @@ func TestLGTMBodyRegexp(t *testing.T) {
 		}
 	}
 }
+
+func TestLGTMRetractionRegexp(t *testing.T) {
+	cases := map[string]bool{
+		"unLGTM":                     true,
+		"un-LGTM!":                   true,
+		"LGTM retracted.":            true,
+		"@jekyllbot: LGTM retracted": true,
+		"@jekyllbot: unlgtm":         true,
+		"LGTM":                       false,
+		"LGTM, thank you.":           false,
+		"Please don't unLGTM this.":  false,
+		"I'd never unLGTM":           false,
+		"unLGTM\n":                   true,
+	}
+	for input, expected := range cases {
+		if actual := lgtmRetractionRegexp.MatchString(input); actual != expected {
+			t.Fatalf("lgtmRetractionRegexp expected '%v' but got '%v' for `%s`", expected, actual, input)
+		}
+	}
+}
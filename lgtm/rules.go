@@ -0,0 +1,202 @@
+package lgtm
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/auth"
+	"github.com/jekyll/jekyllbot/ctx"
+)
+
+const defaultRuleName = "default"
+
+// QuorumRule sets the number of LGTM's required for a PR which changes any
+// file matching one of its paths. When several rules match, the strictest
+// one wins. Files which match no rule fall back to the repo's Quorum.
+type QuorumRule struct {
+	// A short name for the rule, shown in the status, e.g. "docs".
+	Name string
+
+	// Glob patterns matched against each changed file. A "*" matches
+	// within a directory and a "**" matches across directories,
+	// e.g. "docs/**" or "lib/jekyll/*.rb".
+	Paths []string
+
+	// The number of LGTM's a PR must get when this rule applies.
+	Quorum int
+
+	// Teams, as "org/slug", from which at least one member must LGTM when
+	// this rule applies.
+	RequiredTeams []string
+}
+
+// appliedRule is the outcome of matching a PR's files against the rules.
+type appliedRule struct {
+	name          string
+	quorum        int
+	requiredTeams []string
+}
+
+// AddQuorumRule adds a path-based quorum rule to the repo. The repo must
+// already have been added with AddRepo.
+func (h *Handler) AddQuorumRule(owner, name string, rule QuorumRule) {
+	if repo := h.findRepo(owner, name); repo != nil {
+		repo.Rules = append(repo.Rules, rule)
+	}
+}
+
+// ruleFor determines the strictest rule which applies to the changed files.
+// The required teams of every matching rule are combined.
+func (r Repo) ruleFor(files []string) appliedRule {
+	if len(r.Rules) == 0 {
+		return appliedRule{quorum: r.Quorum}
+	}
+
+	defaultRule := QuorumRule{Name: defaultRuleName, Quorum: r.Quorum}
+	matching := []QuorumRule{}
+	matched := map[int]bool{}
+	for _, file := range files {
+		fileMatched := false
+		for i, rule := range r.Rules {
+			if rule.matches(file) {
+				fileMatched = true
+				if !matched[i] {
+					matched[i] = true
+					matching = append(matching, rule)
+				}
+			}
+		}
+		if !fileMatched && !matched[-1] {
+			matched[-1] = true
+			matching = append(matching, defaultRule)
+		}
+	}
+	if len(matching) == 0 {
+		matching = append(matching, defaultRule)
+	}
+
+	strictest := matching[0]
+	requiredTeams := []string{}
+	seenTeams := map[string]bool{}
+	for _, rule := range matching {
+		if rule.Quorum > strictest.Quorum ||
+			(rule.Quorum == strictest.Quorum && len(rule.RequiredTeams) > len(strictest.RequiredTeams)) {
+			strictest = rule
+		}
+		for _, team := range rule.RequiredTeams {
+			if !seenTeams[team] {
+				seenTeams[team] = true
+				requiredTeams = append(requiredTeams, team)
+			}
+		}
+	}
+
+	return appliedRule{
+		name:          strictest.Name,
+		quorum:        strictest.Quorum,
+		requiredTeams: requiredTeams,
+	}
+}
+
+func (rule QuorumRule) matches(file string) bool {
+	for _, pattern := range rule.Paths {
+		if matchesGlob(pattern, file) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesGlob reports whether the file path matches the glob pattern.
+// A pattern ending in "/" matches everything under that directory.
+func matchesGlob(pattern, file string) bool {
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+
+	var expr strings.Builder
+	expr.WriteString(`\A`)
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '*' && strings.HasPrefix(pattern[i:], "**/"):
+			expr.WriteString(`(?:.*/)?`)
+			i += 2
+		case c == '*' && strings.HasPrefix(pattern[i:], "**"):
+			expr.WriteString(`.*`)
+			i++
+		case c == '*':
+			expr.WriteString(`[^/]*`)
+		case c == '?':
+			expr.WriteString(`[^/]`)
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString(`\z`)
+
+	matched, err := regexp.MatchString(expr.String(), file)
+	return err == nil && matched
+}
+
+// changedFiles lists the paths of every file the PR changes.
+func changedFiles(context *ctx.Context, ref prRef) ([]string, error) {
+	files := []string{}
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		commitFiles, resp, err := context.GitHub.PullRequests.ListFiles(
+			context.Context(), ref.Repo.Owner, ref.Repo.Name, ref.Number, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range commitFiles {
+			files = append(files, file.GetFilename())
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return files, nil
+}
+
+// ruleForPR fetches the PR's files and determines the rule which applies.
+// Repos without any rules don't need the files at all.
+func ruleForPR(context *ctx.Context, ref prRef) (appliedRule, error) {
+	if len(ref.Repo.Rules) == 0 {
+		return ref.Repo.ruleFor(nil), nil
+	}
+
+	files, err := changedFiles(context, ref)
+	if err != nil {
+		return appliedRule{}, err
+	}
+	return ref.Repo.ruleFor(files), nil
+}
+
+// newStatusForRule builds an empty status for the given rule.
+func newStatusForRule(sha string, rule appliedRule) *statusInfo {
+	return &statusInfo{
+		lgtmers:      []string{},
+		quorum:       rule.quorum,
+		sha:          sha,
+		rule:         rule.name,
+		missingTeams: append([]string{}, rule.requiredTeams...),
+	}
+}
+
+// satisfyRequiredTeams removes any required team of which the LGTM'er is
+// a member.
+func satisfyRequiredTeams(context *ctx.Context, info *statusInfo, login string) {
+	missingTeams := []string{}
+	for _, team := range info.missingTeams {
+		pieces := strings.SplitN(team, "/", 2)
+		if len(pieces) == 2 && auth.UserIsTeamMember(context, pieces[0], pieces[1], strings.TrimPrefix(login, "@")) {
+			continue
+		}
+		missingTeams = append(missingTeams, team)
+	}
+	info.missingTeams = missingTeams
+}
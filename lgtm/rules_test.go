@@ -0,0 +1,99 @@
+package lgtm
+
+import (
+	"testing"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchesGlob(t *testing.T) {
+	cases := []struct {
+		pattern, file string
+		expected      bool
+	}{
+		{"docs/**", "docs/_docs/installation.md", true},
+		{"docs/**", "docs/index.html", true},
+		{"docs/**", "lib/jekyll.rb", false},
+		{"docs/", "docs/_config.yml", true},
+		{"lib/*.rb", "lib/jekyll.rb", true},
+		{"lib/*.rb", "lib/jekyll/site.rb", false},
+		{"lib/**/*.rb", "lib/jekyll.rb", true},
+		{"lib/**/*.rb", "lib/jekyll/commands/build.rb", true},
+		{"**/*.md", "README.md", true},
+		{"**/*.md", "docs/_posts/2016-01-01-welcome.md", true},
+		{"*.gemspec", "jekyll.gemspec", true},
+		{"History.markdown", "History.markdown", true},
+		{"History.markdown", "docs/History.markdown", false},
+		{"lib/jekyll/?.rb", "lib/jekyll/a.rb", true},
+	}
+	for _, test := range cases {
+		assert.Equal(t, test.expected, matchesGlob(test.pattern, test.file),
+			"expected matchesGlob(%q, %q) to be %v", test.pattern, test.file, test.expected)
+	}
+}
+
+func TestRepoRuleFor(t *testing.T) {
+	repo := Repo{Owner: "jekyll", Name: "jekyll", Quorum: 2, Rules: []QuorumRule{
+		{Name: "docs", Paths: []string{"docs/**"}, Quorum: 1},
+		{Name: "lib", Paths: []string{"lib/**"}, Quorum: 2, RequiredTeams: []string{"jekyll/core"}},
+		{Name: "security", Paths: []string{"lib/jekyll/utils/*.rb"}, Quorum: 3, RequiredTeams: []string{"jekyll/security"}},
+	}}
+
+	cases := []struct {
+		files         []string
+		name          string
+		quorum        int
+		requiredTeams []string
+	}{
+		{[]string{"docs/index.md"}, "docs", 1, []string{}},
+		{[]string{"docs/index.md", "docs/_docs/home.md"}, "docs", 1, []string{}},
+		{[]string{"docs/index.md", "Gemfile"}, "default", 2, []string{}},
+		{[]string{"docs/index.md", "lib/jekyll.rb"}, "lib", 2, []string{"jekyll/core"}},
+		{[]string{"lib/jekyll/utils/ansi.rb"}, "security", 3, []string{"jekyll/core", "jekyll/security"}},
+		{[]string{}, "default", 2, []string{}},
+	}
+	for _, test := range cases {
+		rule := repo.ruleFor(test.files)
+		assert.Equal(t, test.name, rule.name, "files: %q", test.files)
+		assert.Equal(t, test.quorum, rule.quorum, "files: %q", test.files)
+		assert.Equal(t, test.requiredTeams, rule.requiredTeams, "files: %q", test.files)
+	}
+
+	rule := Repo{Quorum: 2}.ruleFor([]string{"docs/index.md"})
+	assert.Equal(t, appliedRule{quorum: 2}, rule)
+}
+
+func TestAddQuorumRule(t *testing.T) {
+	h := &Handler{}
+	h.AddRepo("jekyll", "jekyll", 2)
+	h.AddQuorumRule("jekyll", "jekyll", QuorumRule{Name: "docs", Paths: []string{"docs/**"}, Quorum: 1})
+	h.AddQuorumRule("jekyll", "minima", QuorumRule{Name: "docs", Paths: []string{"docs/**"}, Quorum: 1})
+
+	assert.Len(t, h.findRepo("jekyll", "jekyll").Rules, 1)
+	assert.Nil(t, h.findRepo("jekyll", "minima"))
+}
+
+func TestRuleDescriptionRoundTrip(t *testing.T) {
+	info := statusInfo{
+		lgtmers:      []string{"@parkr"},
+		quorum:       2,
+		rule:         "lib",
+		missingTeams: []string{"jekyll/core", "jekyll/security"},
+	}
+	description := info.newDescription()
+	assert.Equal(t, "Approved by @parkr. Requires 1 more LGTM. Needs approval from jekyll/core, jekyll/security. [lib rule]", description)
+	assert.True(t, len(description) <= 140, "%q must be <= 140 chars.", description)
+	assert.Equal(t, "pending", info.newState())
+
+	parsed := parseStatus("deadbeef", &github.RepoStatus{Description: github.String(description)})
+	assert.Equal(t, []string{"@parkr"}, parsed.lgtmers)
+	assert.Equal(t, 2, parsed.quorum)
+	assert.Equal(t, "lib", parsed.rule)
+	assert.Equal(t, []string{"jekyll/core", "jekyll/security"}, parsed.missingTeams)
+
+	info.lgtmers = append(info.lgtmers, "@mattr-")
+	assert.Equal(t, "pending", info.newState(), "required teams must still approve")
+	info.missingTeams = nil
+	assert.Equal(t, "success", info.newState())
+}
@@ -0,0 +1,337 @@
+package lgtm
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/ctx"
+)
+
+var lgtmRetractionRegexp = regexp.MustCompile(`(?i:\A\s*(?:@[\w-]+:?\s+)?(?:un-?LGTM|LGTM\s+retracted)[.!]*\s*\z)`)
+
+// pushTimes records when each PR's heads were pushed, keyed by the PR and
+// the SHA, as the synchronize events come in.
+var pushTimes = pushTimeMap{data: make(map[string]time.Time)}
+
+type pushTimeMap struct {
+	sync.Mutex // protects 'data'
+	data       map[string]time.Time
+}
+
+func (m *pushTimeMap) record(ref prRef, sha string, at time.Time) {
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.data[ref.String()+"@"+sha]; !ok {
+		m.data[ref.String()+"@"+sha] = at
+	}
+}
+
+func (m *pushTimeMap) get(ref prRef, sha string) (time.Time, bool) {
+	m.Lock()
+	defer m.Unlock()
+	at, ok := m.data[ref.String()+"@"+sha]
+	return at, ok
+}
+
+// StaleApprovalPolicy determines what happens to a PR's LGTM's when new
+// commits are pushed to it.
+type StaleApprovalPolicy int
+
+const (
+	// ResetApprovalsOnPush throws away every LGTM on each push.
+	ResetApprovalsOnPush StaleApprovalPolicy = iota
+
+	// KeepApprovalsOnPush carries every LGTM over to the new commits.
+	KeepApprovalsOnPush
+
+	// ResetApprovalsOnNonTrivialPush carries LGTM's over only if the push
+	// touched nothing but trivial files (see Repo.TrivialPaths).
+	ResetApprovalsOnNonTrivialPush
+)
+
+// defaultTrivialPaths are used by ResetApprovalsOnNonTrivialPush when the
+// repo doesn't specify its own.
+var defaultTrivialPaths = []string{"**/*.md", "**/*.markdown", "docs/**"}
+
+func (p StaleApprovalPolicy) String() string {
+	switch p {
+	case KeepApprovalsOnPush:
+		return "keep"
+	case ResetApprovalsOnNonTrivialPush:
+		return "reset-on-non-trivial"
+	default:
+		return "reset"
+	}
+}
+
+// SetStaleApprovalPolicy sets what happens to existing LGTM's when commits
+// are pushed to a PR in the repo. The trivial paths are glob patterns, as in
+// QuorumRule, and only matter for ResetApprovalsOnNonTrivialPush.
+func (h *Handler) SetStaleApprovalPolicy(owner, name string, policy StaleApprovalPolicy, trivialPaths ...string) {
+	if repo := h.findRepo(owner, name); repo != nil {
+		repo.StaleApprovals = policy
+		repo.TrivialPaths = trivialPaths
+	}
+}
+
+// isTrivial returns true if every one of the files matches a trivial path.
+func (r Repo) isTrivial(files []string) bool {
+	trivialPaths := r.TrivialPaths
+	if len(trivialPaths) == 0 {
+		trivialPaths = defaultTrivialPaths
+	}
+
+	trivial := QuorumRule{Paths: trivialPaths}
+	for _, file := range files {
+		if !trivial.matches(file) {
+			return false
+		}
+	}
+	return true
+}
+
+// keepsApprovals determines whether the LGTM's given on the before SHA
+// should carry over to the after SHA.
+func keepsApprovals(context *ctx.Context, ref prRef, before, after string) (bool, error) {
+	switch ref.Repo.StaleApprovals {
+	case KeepApprovalsOnPush:
+		return true, nil
+	case ResetApprovalsOnNonTrivialPush:
+		if before == "" {
+			return false, nil
+		}
+		comparison, _, err := context.GitHub.Repositories.CompareCommits(
+			context.Context(), ref.Repo.Owner, ref.Repo.Name, before, after, &github.ListOptions{PerPage: 100})
+		if err != nil {
+			return false, err
+		}
+		files := []string{}
+		for _, file := range comparison.Files {
+			files = append(files, file.GetFilename())
+		}
+		return ref.Repo.isTrivial(files), nil
+	default:
+		return false, nil
+	}
+}
+
+// approvalCutoff returns the time before which comments and reviews don't
+// count when recounting LGTM's. It is the zero time if every approval
+// should count.
+func approvalCutoff(context *ctx.Context, ref prRef) (time.Time, error) {
+	if ref.Repo.StaleApprovals == KeepApprovalsOnPush {
+		return time.Time{}, nil
+	}
+
+	commits, err := listCommitSHAs(context, ref)
+	if err != nil {
+		return time.Time{}, err
+	}
+	// A force push may have rewritten anything, so it always resets.
+	lastForcePush, err := lastForcePushTime(context, ref)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// Walk back from the head to the last push which resets approvals. A
+	// commit can't have been pushed after its descendants, so one the bot
+	// never saw as the head was pushed no later than the next one it did.
+	var at time.Time
+	for i := len(commits) - 1; i >= 0; i-- {
+		pushed, ok, err := pushedAt(context, ref, commits[i])
+		if err != nil {
+			return time.Time{}, err
+		}
+		switch {
+		case ok:
+			at = pushed
+		case at.IsZero():
+			// Nobody knows when the head was pushed, so it may have come
+			// after any of the LGTM's.
+			at = time.Now()
+		}
+		if at.Before(lastForcePush) {
+			return lastForcePush, nil
+		}
+		if ref.Repo.StaleApprovals != ResetApprovalsOnNonTrivialPush {
+			return at, nil
+		}
+		commit, _, err := context.GitHub.Repositories.GetCommit(
+			context.Context(), ref.Repo.Owner, ref.Repo.Name, commits[i], nil)
+		if err != nil {
+			return time.Time{}, err
+		}
+		files := []string{}
+		for _, file := range commit.Files {
+			files = append(files, file.GetFilename())
+		}
+		if !ref.Repo.isTrivial(files) {
+			return at, nil
+		}
+	}
+	return lastForcePush, nil
+}
+
+// listCommitSHAs returns the SHAs of the PR's commits, oldest first.
+func listCommitSHAs(context *ctx.Context, ref prRef) ([]string, error) {
+	shas := []string{}
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		commits, resp, err := context.GitHub.PullRequests.ListCommits(
+			context.Context(), ref.Repo.Owner, ref.Repo.Name, ref.Number, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, commit := range commits {
+			shas = append(shas, commit.GetSHA())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return shas, nil
+}
+
+// lastForcePushTime returns when the PR's branch was last force pushed, from
+// its timeline, or the zero time if it never was.
+func lastForcePushTime(context *ctx.Context, ref prRef) (time.Time, error) {
+	var last time.Time
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		events, resp, err := context.GitHub.Issues.ListIssueTimeline(
+			context.Context(), ref.Repo.Owner, ref.Repo.Name, ref.Number, opts)
+		if err != nil {
+			return time.Time{}, err
+		}
+		for _, event := range events {
+			if event.GetEvent() == "head_ref_force_pushed" && event.GetCreatedAt().After(last) {
+				last = event.GetCreatedAt().Time
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return last, nil
+}
+
+// pushedAt returns when the commit was pushed as the PR's head. That's when
+// the synchronize event for it arrived or, if that was before the bot last
+// started, when the bot first set the LGTM status on it. ok is false if the
+// bot never saw the commit as the head. Committer dates can't be used, as
+// a commit can be made long before it's pushed.
+func pushedAt(context *ctx.Context, ref prRef, sha string) (time.Time, bool, error) {
+	if at, ok := pushTimes.get(ref, sha); ok {
+		return at, true, nil
+	}
+
+	var first time.Time
+	earliest := func(at time.Time) {
+		if !at.IsZero() && (first.IsZero() || at.Before(first)) {
+			first = at
+		}
+	}
+	if ref.Repo.CheckRun {
+		checkRuns, _, err := context.GitHub.Checks.ListCheckRunsForRef(context.Context(), ref.Repo.Owner, ref.Repo.Name, sha,
+			&github.ListCheckRunsOptions{CheckName: github.String(lgtmContext(ref.Repo.Owner))})
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		for _, run := range checkRuns.CheckRuns {
+			earliest(run.GetStartedAt().Time)
+		}
+	} else {
+		opts := &github.ListOptions{PerPage: 100}
+		for {
+			statuses, resp, err := context.GitHub.Repositories.ListStatuses(context.Context(), ref.Repo.Owner, ref.Repo.Name, sha, opts)
+			if err != nil {
+				return time.Time{}, false, err
+			}
+			for _, status := range statuses {
+				if status.GetContext() == lgtmContext(ref.Repo.Owner) {
+					earliest(status.GetCreatedAt().Time)
+				}
+			}
+			if resp.NextPage == 0 {
+				break
+			}
+			opts.Page = resp.NextPage
+		}
+	}
+	return first, !first.IsZero(), nil
+}
+
+// getStatusForSHA returns the LGTM status which was set on the given SHA.
+func getStatusForSHA(context *ctx.Context, ref prRef, sha string) (*statusInfo, error) {
+	statusCache.Lock()
+	cachedStatus, ok := statusCache.data[ref.String()]
+	statusCache.Unlock()
+	if ok && cachedStatus != nil && cachedStatus.sha == sha {
+		return cachedStatus, nil
+	}
+
+	if ref.Repo.CheckRun {
+		return recalculateStatus(context, ref, sha)
+	}
+
+	statuses, _, err := context.GitHub.Repositories.ListStatuses(context.Context(), ref.Repo.Owner, ref.Repo.Name, sha, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	neededContext := lgtmContext(ref.Repo.Owner)
+	for _, status := range statuses {
+		if status.GetContext() == neededContext {
+			return parseStatus(sha, status), nil
+		}
+	}
+
+	return &statusInfo{lgtmers: []string{}, sha: sha}, nil
+}
+
+// carryApprovalsFrom copies the LGTM'ers from a previous status, and marks
+// off any required teams they satisfy.
+func (s *statusInfo) carryApprovalsFrom(context *ctx.Context, previous *statusInfo) {
+	for _, lgtmer := range previous.lgtmers {
+		if s.IsLGTMer(lgtmer) {
+			continue
+		}
+		approval := previous.approvals[lgtmer]
+		s.addLGTMer(lgtmer, approval.URL, approval.Source)
+		satisfyRequiredTeams(context, s, lgtmer)
+	}
+}
+
+// removeLGTMer removes the login from the LGTM'ers. It returns false if
+// they hadn't given an LGTM.
+func (s *statusInfo) removeLGTMer(login string) bool {
+	lowerLogin := "@" + strings.TrimPrefix(strings.ToLower(login), "@")
+	for i, lgtmer := range s.lgtmers {
+		if strings.ToLower(lgtmer) == lowerLogin {
+			s.lgtmers = append(s.lgtmers[:i:i], s.lgtmers[i+1:]...)
+			delete(s.approvals, lgtmer)
+			return true
+		}
+	}
+	return false
+}
+
+// recomputeRequiredTeams works out which required teams are still missing
+// an approval from the current LGTM'ers. Used after an LGTM is retracted.
+func recomputeRequiredTeams(context *ctx.Context, ref prRef, info *statusInfo) error {
+	rule, err := ruleForPR(context, ref)
+	if err != nil {
+		return err
+	}
+
+	info.missingTeams = append([]string{}, rule.requiredTeams...)
+	for _, lgtmer := range info.lgtmers {
+		satisfyRequiredTeams(context, info, lgtmer)
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package lgtm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusInfoRemoveLGTMer(t *testing.T) {
+	info := &statusInfo{}
+	info.addLGTMer("parkr", "https://github.com/o/r/pull/1#issuecomment-1", approvalSourceComment)
+	info.addLGTMer("mattr-", "", approvalSourceComment)
+
+	assert.True(t, info.removeLGTMer("PARKR"))
+	assert.Equal(t, []string{"@mattr-"}, info.lgtmers)
+	assert.NotContains(t, info.approvals, "@parkr")
+	assert.False(t, info.removeLGTMer("parkr"))
+	assert.True(t, info.removeLGTMer("@mattr-"))
+	assert.Empty(t, info.lgtmers)
+}
+
+func TestRepoIsTrivial(t *testing.T) {
+	repo := Repo{}
+	assert.True(t, repo.isTrivial([]string{"README.md", "docs/_docs/usage.md"}))
+	assert.False(t, repo.isTrivial([]string{"README.md", "lib/jekyll.rb"}))
+	assert.True(t, repo.isTrivial(nil))
+
+	repo.TrivialPaths = []string{"*.txt"}
+	assert.True(t, repo.isTrivial([]string{"LICENSE.txt"}))
+	assert.False(t, repo.isTrivial([]string{"README.md"}))
+}
+
+func TestKeepsApprovals(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+
+	changedFiles := []string{}
+	mux.HandleFunc("/repos/o/r/compare/before...after", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		files := []*github.CommitFile{}
+		for _, file := range changedFiles {
+			files = append(files, &github.CommitFile{Filename: github.String(file)})
+		}
+		json.NewEncoder(w).Encode(&github.CommitsComparison{Files: files})
+	})
+
+	policyRef := ref
+	cases := []struct {
+		policy   StaleApprovalPolicy
+		files    []string
+		expected bool
+	}{
+		{ResetApprovalsOnPush, []string{"README.md"}, false},
+		{KeepApprovalsOnPush, []string{"lib/jekyll.rb"}, true},
+		{ResetApprovalsOnNonTrivialPush, []string{"README.md"}, true},
+		{ResetApprovalsOnNonTrivialPush, []string{"README.md", "lib/jekyll.rb"}, false},
+	}
+	for _, test := range cases {
+		changedFiles = test.files
+		policyRef.Repo.StaleApprovals = test.policy
+		keep, err := keepsApprovals(context, policyRef, "before", "after")
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, keep, fmt.Sprintf("policy=%s files=%q", test.policy, test.files))
+	}
+}
+
+func TestApprovalCutoff(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+	date := func(day int) time.Time { return time.Date(2026, time.January, day, 0, 0, 0, 0, time.UTC) }
+	pushTimes = pushTimeMap{data: make(map[string]time.Time)}
+
+	// #273: "code" was committed on the 3rd but pushed along with "readme"
+	// on the 10th, which is when the bot first set the status on the head.
+	mux.HandleFunc("/repos/o/r/pulls/273/commits", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		if r.URL.Query().Get("page") != "2" {
+			w.Header().Set("Link", `<https://api.github.com/repos/o/r/pulls/273/commits?page=2>; rel="next"`)
+			fmt.Fprint(w, `[{"sha":"old"},{"sha":"code","commit":{"committer":{"date":"2026-01-03T00:00:00Z"}}}]`)
+			return
+		}
+		fmt.Fprint(w, `[{"sha":"readme"}]`)
+	})
+	mux.HandleFunc("/repos/o/r/issues/273/timeline", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"event":"commented","created_at":"2026-01-02T00:00:00Z"}]`)
+	})
+	mux.HandleFunc("/repos/o/r/commits/old/statuses", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"context":"o/lgtm","created_at":"2026-01-01T00:00:00Z"}]`)
+	})
+	mux.HandleFunc("/repos/o/r/commits/code/statuses", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"context":"ci/travis","created_at":"2026-01-03T00:00:00Z"}]`)
+	})
+	mux.HandleFunc("/repos/o/r/commits/readme/statuses", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+			{"context":"o/lgtm","created_at":"2026-01-12T00:00:00Z"},
+			{"context":"o/lgtm","created_at":"2026-01-10T00:00:00Z"}
+		]`)
+	})
+	mux.HandleFunc("/repos/o/r/commits/code", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"files":[{"filename":"lib/jekyll.rb"}]}`)
+	})
+	mux.HandleFunc("/repos/o/r/commits/readme", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"files":[{"filename":"README.md"}]}`)
+	})
+
+	// #274: "first" was pushed on the 2nd and the branch force pushed on
+	// the 5th. The bot never saw "second" pushed.
+	mux.HandleFunc("/repos/o/r/pulls/274/commits", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"sha":"first"},{"sha":"second"}]`)
+	})
+	mux.HandleFunc("/repos/o/r/issues/274/timeline", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"event":"head_ref_force_pushed","created_at":"2026-01-05T00:00:00Z"}]`)
+	})
+	mux.HandleFunc("/repos/o/r/commits/second/statuses", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	})
+	mux.HandleFunc("/repos/o/r/commits/second", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"files":[{"filename":"README.md"}]}`)
+	})
+	mux.HandleFunc("/repos/o/r/commits/first", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"files":[{"filename":"lib/jekyll.rb"}]}`)
+	})
+	forcePushedRef := handler.newPRRef("o", "r", 274)
+	pushTimes.record(forcePushedRef, "first", date(2))
+
+	cases := []struct {
+		number   int
+		policy   StaleApprovalPolicy
+		expected time.Time
+	}{
+		{273, KeepApprovalsOnPush, time.Time{}},
+		{273, ResetApprovalsOnPush, date(10)},
+		// The README change is trivial, but the code change before it was
+		// pushed with it.
+		{273, ResetApprovalsOnNonTrivialPush, date(10)},
+		// The non-trivial change came before the force push, which may
+		// have changed anything.
+		{274, ResetApprovalsOnNonTrivialPush, date(5)},
+	}
+	for _, test := range cases {
+		policyRef := handler.newPRRef("o", "r", test.number)
+		policyRef.Repo.StaleApprovals = test.policy
+		cutoff, err := approvalCutoff(context, policyRef)
+		assert.NoError(t, err)
+		assert.True(t, test.expected.Equal(cutoff), fmt.Sprintf("#%d policy=%s: expected %s, got %s", test.number, test.policy, test.expected, cutoff))
+	}
+
+	// Nobody knows when the head was pushed, so every LGTM so far is stale.
+	forcePushedRef.Repo.StaleApprovals = ResetApprovalsOnPush
+	before := time.Now()
+	cutoff, err := approvalCutoff(context, forcePushedRef)
+	assert.NoError(t, err)
+	assert.False(t, cutoff.Before(before), "expected now, got %s", cutoff)
+}
+
+func TestCarryApprovalsFrom(t *testing.T) {
+	previous := &statusInfo{sha: "before"}
+	previous.addLGTMer("parkr", "https://github.com/o/r/pull/1#issuecomment-1", approvalSourceComment)
+	previous.addLGTMer("mattr-", "", approvalSourceComment)
+
+	info := &statusInfo{lgtmers: []string{}, quorum: 2, sha: "after"}
+	info.carryApprovalsFrom(ctx.NewTestContext(), previous)
+
+	assert.Equal(t, []string{"@parkr", "@mattr-"}, info.lgtmers)
+	assert.Equal(t, approval{URL: "https://github.com/o/r/pull/1#issuecomment-1", Source: approvalSourceComment}, info.approvals["@parkr"])
+	assert.Equal(t, "success", info.newState())
+}
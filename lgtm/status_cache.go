@@ -20,10 +20,16 @@ func lgtmContext(owner string) string {
 }
 
 func setStatus(context *ctx.Context, ref prRef, sha string, status *statusInfo) error {
-	_, _, err := context.GitHub.Repositories.CreateStatus(
-		context.Context(), ref.Repo.Owner, ref.Repo.Name, sha, status.NewRepoStatus(ref.Repo.Owner))
-	if err != nil {
-		return err
+	if ref.Repo.CheckRun {
+		if err := setCheckRun(context, ref, sha, status); err != nil {
+			return err
+		}
+	} else {
+		_, _, err := context.GitHub.Repositories.CreateStatus(
+			context.Context(), ref.Repo.Owner, ref.Repo.Name, sha, status.NewRepoStatus(ref.Repo.Owner))
+		if err != nil {
+			return err
+		}
 	}
 
 	statusCache.Lock()
@@ -34,21 +40,43 @@ func setStatus(context *ctx.Context, ref prRef, sha string, status *statusInfo)
 }
 
 func getStatus(context *ctx.Context, ref prRef) (*statusInfo, error) {
+	info, _, err := loadStatus(context, ref)
+	return info, err
+}
+
+// loadStatus returns the PR's status like getStatus, and whether it was just
+// recounted from the PR's comments and reviews. A recount already includes
+// the comment or review being handled.
+func loadStatus(context *ctx.Context, ref prRef) (*statusInfo, bool, error) {
 	statusCache.Lock()
 	cachedStatus, ok := statusCache.data[ref.String()]
 	statusCache.Unlock()
 	if ok && cachedStatus != nil {
-		return cachedStatus, nil
+		return cachedStatus, false, nil
 	}
 
 	pr, _, err := context.GitHub.PullRequests.Get(context.Context(), ref.Repo.Owner, ref.Repo.Name, ref.Number)
 	if err != nil {
-		return nil, err
+		return nil, false, err
+	}
+
+	// Check Runs don't carry the LGTM'ers in a parseable form, so recount.
+	if ref.Repo.CheckRun {
+		info, err := recalculateStatus(context, ref, *pr.Head.SHA)
+		if err != nil {
+			return nil, false, err
+		}
+
+		statusCache.Lock()
+		statusCache.data[ref.String()] = info
+		statusCache.Unlock()
+
+		return info, true, nil
 	}
 
 	statuses, _, err := context.GitHub.Repositories.ListStatuses(context.Context(), ref.Repo.Owner, ref.Repo.Name, *pr.Head.SHA, nil)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	var preExistingStatus *github.RepoStatus
@@ -73,7 +101,16 @@ func getStatus(context *ctx.Context, ref prRef) (*statusInfo, error) {
 		}
 	}
 
-	if ref.Repo.Quorum != 0 {
+	// The description counts the quorum up from its LGTM's, which
+	// overshoots once more maintainers than needed have signed off, so
+	// work out which rule applies again.
+	if len(ref.Repo.Rules) > 0 {
+		rule, err := ruleForPR(context, ref)
+		if err != nil {
+			return nil, false, err
+		}
+		info.quorum = rule.quorum
+	} else if ref.Repo.Quorum != 0 {
 		info.quorum = ref.Repo.Quorum
 	}
 
@@ -81,7 +118,7 @@ func getStatus(context *ctx.Context, ref prRef) (*statusInfo, error) {
 	statusCache.data[ref.String()] = info
 	statusCache.Unlock()
 
-	return info, nil
+	return info, false, nil
 }
 
 func newEmptyStatus(owner string, quorum int) *github.RepoStatus {
@@ -291,3 +291,37 @@ func TestNewEmptyStatus(t *testing.T) {
 		assert.Equal(t, "Awaiting approval from at least 1 maintainer.", *status.Description)
 	}
 }
+
+func TestGetStatusFromAPIWithRuleAndExtraLGTMs(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	statusCache = statusMap{data: make(map[string]*statusInfo)}
+	context := &ctx.Context{GitHub: client}
+	ruled := &Handler{repos: []Repo{{Owner: "o", Name: "r", Quorum: 1}}}
+	ruled.AddQuorumRule("o", "r", QuorumRule{Name: "lib", Paths: []string{"lib/**"}, Quorum: 2})
+	ref := ruled.newPRRef("o", "r", 273)
+
+	mux.HandleFunc(pullRequestGET, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&github.PullRequest{
+			Number: github.Int(ref.Number),
+			Head:   &github.PullRequestBranch{SHA: github.String(prSHA)},
+		})
+	})
+	mux.HandleFunc(pullRequestGET+"/files", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		fmt.Fprint(w, `[{"filename":"lib/jekyll.rb"}]`)
+	})
+	mux.HandleFunc(statusesGET, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]github.RepoStatus{{
+			Context:     github.String("o/lgtm"),
+			Description: github.String("Approved by @parkr, @envygeeks, and @mattr-. [lib rule]"),
+		}})
+	})
+
+	info, err := getStatus(context, ref)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, info.quorum, "the quorum comes from the rule, not the number of LGTM's")
+
+	info.removeLGTMer("@parkr")
+	assert.Equal(t, "success", info.newState(), "two LGTM's still meet the quorum")
+}
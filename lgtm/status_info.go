@@ -11,18 +11,60 @@ import (
 
 var lgtmerExtractor = regexp.MustCompile("@[a-zA-Z0-9_-]+")
 var remainingLGTMsExtractor = regexp.MustCompile(`Waiting for approval from at least (\d+)|Requires (\d+) more LGTM('s)?`)
+var missingTeamsExtractor = regexp.MustCompile(`Needs approval from ([a-zA-Z0-9_/, -]+)\.`)
+var ruleExtractor = regexp.MustCompile(`\[([^\]]+) rule\]\z`)
+
+const (
+	approvalSourceComment = "comment"
+	approvalSourceReview  = "review"
+)
+
+// approval records where an LGTM'er gave their approval.
+type approval struct {
+	// URL of the comment or review.
+	URL string
+	// Either "comment" or "review".
+	Source string
+}
 
 type statusInfo struct {
 	lgtmers    []string
 	quorum     int
 	sha        string
 	repoStatus *github.RepoStatus
+
+	// approvals maps each LGTM'er (with the "@") to where they approved.
+	// It is only populated when the approval was seen by this process.
+	approvals map[string]approval
+
+	// checkRunID is the ID of the Check Run, if the repo uses them.
+	checkRunID int64
+
+	// rule is the name of the quorum rule which applied, if the repo has any.
+	rule string
+
+	// missingTeams are the teams, as "org/slug", still required to approve.
+	missingTeams []string
 }
 
 func parseStatus(sha string, repoStatus *github.RepoStatus) *statusInfo {
 	status := &statusInfo{sha: sha, repoStatus: repoStatus, lgtmers: []string{}}
 
 	if repoStatus.Description != nil {
+		// Extract the rule & required teams first, so their text isn't
+		// mistaken for anything else.
+		description := *repoStatus.Description
+		if match := ruleExtractor.FindStringSubmatch(description); match != nil {
+			status.rule = match[1]
+		}
+		if match := missingTeamsExtractor.FindStringSubmatch(description); match != nil {
+			for _, team := range strings.Split(strings.Replace(match[1], " and ", ", ", -1), ",") {
+				if team = strings.TrimSpace(team); team != "" {
+					status.missingTeams = append(status.missingTeams, team)
+				}
+			}
+		}
+
 		// Extract LGTMers.
 		lgtmersExtracted := lgtmerExtractor.FindAllStringSubmatch(*repoStatus.Description, -1)
 		if len(lgtmersExtracted) > 0 {
@@ -65,16 +107,42 @@ func (s statusInfo) IsLGTMer(username string) bool {
 	return false
 }
 
+// addLGTMer appends the login to the list of LGTM'ers and records where the
+// approval came from.
+func (s *statusInfo) addLGTMer(login, url, source string) {
+	lgtmer := "@" + strings.TrimPrefix(login, "@")
+	s.lgtmers = append(s.lgtmers, lgtmer)
+	if url == "" {
+		return
+	}
+	if s.approvals == nil {
+		s.approvals = map[string]approval{}
+	}
+	s.approvals[lgtmer] = approval{URL: url, Source: source}
+}
+
 func (s statusInfo) newState() string {
-	if len(s.lgtmers) >= s.quorum {
+	if len(s.lgtmers) >= s.quorum && len(s.missingTeams) == 0 {
 		return "success"
 	}
 	return "pending"
 }
 
 // newDescription produces the LGTM status description based on the LGTMers
-// and quorum values specified for this statusInfo.
+// and quorum values specified for this statusInfo, followed by any teams
+// which must still approve and the quorum rule which applied.
 func (s statusInfo) newDescription() string {
+	description := s.newApprovalDescription()
+	if len(s.missingTeams) > 0 {
+		description += fmt.Sprintf(" Needs approval from %s.", strings.Join(s.missingTeams, ", "))
+	}
+	if s.rule != "" {
+		description += fmt.Sprintf(" [%s rule]", s.rule)
+	}
+	return description
+}
+
+func (s statusInfo) newApprovalDescription() string {
 	if s.quorum == 0 {
 		return "No approval is required."
 	}
@@ -7,10 +7,16 @@ import (
 	"github.com/google/go-github/v73/github"
 	"github.com/hashicorp/go-version"
 	"github.com/jekyll/jekyllbot/ctx"
-	"github.com/jekyll/jekyllbot/jekyll"
 )
 
-func LatestRelease(context *ctx.Context, repo jekyll.Repository) (*github.RepositoryRelease, error) {
+// Repository is a GitHub repository, like jekyll.Repository.
+type Repository interface {
+	Owner() string
+	Name() string
+	String() string
+}
+
+func LatestRelease(context *ctx.Context, repo Repository) (*github.RepositoryRelease, error) {
 	releases, _, err := context.GitHub.Repositories.ListReleases(context.Context(), repo.Owner(), repo.Name(), &github.ListOptions{PerPage: 300})
 	if err != nil {
 		return nil, err
@@ -31,6 +37,10 @@ func LatestRelease(context *ctx.Context, repo jekyll.Repository) (*github.Reposi
 		versions = append(versions, v)
 	}
 
+	if len(versions) == 0 {
+		return nil, nil
+	}
+
 	// After this, the versions are properly sorted
 	sort.Sort(sort.Reverse(version.Collection(versions)))
 
@@ -41,7 +51,37 @@ func LatestRelease(context *ctx.Context, repo jekyll.Repository) (*github.Reposi
 	return nil, fmt.Errorf("%s: couldn't find %s in versions %+v", repo, versions[0], versions)
 }
 
-func CommitsSinceRelease(context *ctx.Context, repo jekyll.Repository, latestRelease *github.RepositoryRelease) (int, error) {
+// PreviousRelease returns the published, non-prerelease release with the
+// highest version lower than the given tag, or nil if there isn't one.
+func PreviousRelease(context *ctx.Context, repo Repository, tag string) (*github.RepositoryRelease, error) {
+	current, err := version.NewVersion(tag)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %q isn't a version: %v", repo, tag, err)
+	}
+
+	releases, _, err := context.GitHub.Repositories.ListReleases(context.Context(), repo.Owner(), repo.Name(), &github.ListOptions{PerPage: 300})
+	if err != nil {
+		return nil, err
+	}
+
+	var previous *github.RepositoryRelease
+	var previousVersion *version.Version
+	for _, release := range releases {
+		if release.GetDraft() || release.GetPrerelease() {
+			continue
+		}
+		v, err := version.NewVersion(release.GetTagName())
+		if err != nil || !v.LessThan(current) {
+			continue
+		}
+		if previousVersion == nil || v.GreaterThan(previousVersion) {
+			previous, previousVersion = release, v
+		}
+	}
+	return previous, nil
+}
+
+func CommitsSinceRelease(context *ctx.Context, repo Repository, latestRelease *github.RepositoryRelease) (int, error) {
 	defaultBranch := "master" // fallback
 	repoInfo, _, err := context.GitHub.Repositories.Get(context.Context(), repo.Owner(), repo.Name())
 	if err != nil {
@@ -0,0 +1,281 @@
+package stale
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/ctx"
+)
+
+// ActivityActors is whose activity keeps an issue from going stale.
+type ActivityActors int
+
+const (
+	// Any human's comments and events count.
+	AnyoneActivity ActivityActors = iota
+	// Only the issue author's comments and events count.
+	AuthorActivity
+	// Only comments and events by people with write access count.
+	MaintainerActivity
+)
+
+func (a ActivityActors) String() string {
+	switch a {
+	case AuthorActivity:
+		return "the author"
+	case MaintainerActivity:
+		return "a maintainer"
+	default:
+		return "anyone"
+	}
+}
+
+var (
+	// Timeline events which happen to an issue rather than being done to it,
+	// so don't count as activity.
+	passiveEvents = map[string]bool{
+		"cross-referenced": true,
+		"mentioned":        true,
+		"referenced":       true,
+		"subscribed":       true,
+		"unsubscribed":     true,
+	}
+
+	permissions = permissionCache{data: make(map[string]bool)}
+)
+
+type permissionCache struct {
+	sync.Mutex // protects 'data'
+	data       map[string]bool
+}
+
+// Decision is whether an issue is stale and why.
+type Decision struct {
+	Stale  bool
+	Reason string
+
+	// When the last counted activity was, and what it was, e.g. "a comment by
+	// @parkr". Empty if the issue is exempt.
+	LastActivity     time.Time
+	LastActivityWhat string
+}
+
+// Evaluate decides whether the issue is stale from the last activity on its
+// timeline by a human the configuration counts, ignoring bots.
+func Evaluate(context *ctx.Context, issue *github.Issue, config Configuration) (Decision, error) {
+	if reason := exemption(issue, config); reason != "" {
+		return Decision{Stale: false, Reason: reason}, nil
+	}
+
+	if !isUpdatedWithinDuration(issue, config) {
+		return Decision{
+			Stale:            true,
+			Reason:           fmt.Sprintf("nothing has happened since %s", issue.GetUpdatedAt().Format("2006-01-02")),
+			LastActivity:     issue.GetUpdatedAt().Time,
+			LastActivityWhat: "the last update",
+		}, nil
+	}
+
+	timeline, err := issueTimeline(context, issue)
+	if err != nil {
+		return Decision{}, context.NewError("stale: couldn't fetch the timeline of %s#%d: %+v", context.Repo, issue.GetNumber(), err)
+	}
+
+	counts := func(login string) bool {
+		switch config.CountedActivity {
+		case AuthorActivity:
+			return strings.EqualFold(login, issue.GetUser().GetLogin())
+		case MaintainerActivity:
+			return isMaintainer(context, login)
+		default:
+			return true
+		}
+	}
+	var pushedAt time.Time
+	if isPullRequest(issue) {
+		if pushedAt, err = headPushedAt(context, issue); err != nil {
+			return Decision{}, context.NewError("stale: couldn't tell when %s#%d was last pushed to: %+v", context.Repo, issue.GetNumber(), err)
+		}
+	}
+	at, what := lastActivity(issue, timeline, pushedAt, config, counts)
+	return decide(config.CountedActivity, at, what, dormantDuration(issue, config), time.Now()), nil
+}
+
+// exemption returns why the issue can never be stale, or "" if it can be.
+func exemption(issue *github.Issue, config Configuration) string {
+	if isPullRequest(issue) && config.PullRequests == nil {
+		return "pull requests have no stale policy"
+	}
+	if dormantDuration(issue, config) <= 0 {
+		return "drafts never go stale"
+	}
+	if label := exemptLabel(issue, config); label != "" {
+		return fmt.Sprintf("it has the exempt label %q", label)
+	}
+	return ""
+}
+
+func decide(actors ActivityActors, at time.Time, what string, dormant time.Duration, now time.Time) Decision {
+	decision := Decision{LastActivity: at, LastActivityWhat: what}
+	if now.Sub(at) < dormant {
+		decision.Reason = fmt.Sprintf("the last activity by %s was %s on %s", actors, what, at.Format("2006-01-02"))
+		return decision
+	}
+	decision.Stale = true
+	decision.Reason = fmt.Sprintf("the last activity by %s was %s on %s, over %d days ago", actors, what, at.Format("2006-01-02"), int(dormant.Hours()/24))
+	return decision
+}
+
+// lastActivity returns when and what the last activity on the timeline was
+// by a human whom counts returns true for. Opening the issue counts as the
+// author's activity, and it's the starting point when nothing else counts.
+// Marking the issue stale or nudging the maintainers about an approved pull
+// request counts too, whoever did it, so neither is followed straight away
+// by the next action. The timeline dates commits by when they were made, so
+// the last push to a pull request, if known, counts as its author's
+// activity as well.
+func lastActivity(issue *github.Issue, timeline []*github.Timeline, pushedAt time.Time, config Configuration, counts func(login string) bool) (time.Time, string) {
+	at, what := issue.GetCreatedAt().Time, "opening it"
+
+	for _, event := range timeline {
+		name := event.GetEvent()
+		if passiveEvents[name] {
+			continue
+		}
+
+		actor, eventAt := event.GetActor(), event.GetCreatedAt().Time
+		if name == "labeled" && isStaleLabel(event.GetLabel().GetName(), config) {
+			if eventAt.After(at) {
+				at, what = eventAt, fmt.Sprintf("marking it %q", event.GetLabel().GetName())
+			}
+			continue
+		}
+		if name == "commented" && strings.Contains(event.GetBody(), nudgeMarker) {
+			if eventAt.After(at) {
+				at, what = eventAt, "nudging the maintainers"
+			}
+			continue
+		}
+		switch name {
+		case "reviewed":
+			actor, eventAt = event.GetUser(), event.GetSubmittedAt().Time
+		case "committed":
+			// Commits aren't tied to a GitHub user, so attribute them to
+			// the pull request's author.
+			actor, eventAt = issue.GetUser(), event.GetCommitter().GetDate().Time
+		}
+
+		if actor == nil || isBot(actor, config) || !counts(actor.GetLogin()) || !eventAt.After(at) {
+			continue
+		}
+		at, what = eventAt, describeEvent(name, actor.GetLogin())
+	}
+
+	if author := issue.GetUser(); author != nil && !isBot(author, config) && counts(author.GetLogin()) && pushedAt.After(at) {
+		at, what = pushedAt, "a push by @"+author.GetLogin()
+	}
+	return at, what
+}
+
+// headPushedAt returns roughly when the pull request's head commit was
+// pushed: when the first check suite was created for it. It's the zero time
+// if nothing runs checks on the repo.
+func headPushedAt(context *ctx.Context, issue *github.Issue) (time.Time, error) {
+	pr, _, err := context.GitHub.PullRequests.Get(context.Context(), context.Repo.Owner, context.Repo.Name, issue.GetNumber())
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var pushedAt time.Time
+	opts := &github.ListCheckSuiteOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		suites, resp, err := context.GitHub.Checks.ListCheckSuitesForRef(context.Context(), context.Repo.Owner, context.Repo.Name, pr.GetHead().GetSHA(), opts)
+		if err != nil {
+			return time.Time{}, err
+		}
+		for _, suite := range suites.CheckSuites {
+			if createdAt := suite.GetCreatedAt().Time; !createdAt.IsZero() && (pushedAt.IsZero() || createdAt.Before(pushedAt)) {
+				pushedAt = createdAt
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.ListOptions.Page = resp.NextPage
+	}
+	return pushedAt, nil
+}
+
+func describeEvent(name, login string) string {
+	switch name {
+	case "commented":
+		return "a comment by @" + login
+	case "reviewed":
+		return "a review by @" + login
+	case "committed":
+		return "a commit by @" + login
+	case "head_ref_force_pushed":
+		return "a force push by @" + login
+	default:
+		return fmt.Sprintf("a %q event by @%s", name, login)
+	}
+}
+
+// isBot returns true for GitHub Apps and the configured bot accounts.
+func isBot(user *github.User, config Configuration) bool {
+	if user.GetType() == "Bot" || strings.HasSuffix(user.GetLogin(), "[bot]") {
+		return true
+	}
+	for _, bot := range config.Bots {
+		if strings.EqualFold(bot, user.GetLogin()) {
+			return true
+		}
+	}
+	return false
+}
+
+// isMaintainer returns true if the user has write access to the repo.
+func isMaintainer(context *ctx.Context, login string) bool {
+	key := strings.ToLower(fmt.Sprintf("%s@%s", context.Repo, login))
+	permissions.Lock()
+	maintainer, ok := permissions.data[key]
+	permissions.Unlock()
+	if ok {
+		return maintainer
+	}
+
+	level, _, err := context.GitHub.Repositories.GetPermissionLevel(context.Context(), context.Repo.Owner, context.Repo.Name, login)
+	if err != nil {
+		context.Log("stale: couldn't fetch @%s's permission on %s: %+v", login, context.Repo, err)
+		return false
+	}
+	switch level.GetPermission() {
+	case "admin", "maintain", "write":
+		maintainer = true
+	}
+
+	permissions.Lock()
+	permissions.data[key] = maintainer
+	permissions.Unlock()
+	return maintainer
+}
+
+func issueTimeline(context *ctx.Context, issue *github.Issue) ([]*github.Timeline, error) {
+	var timeline []*github.Timeline
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		events, resp, err := context.GitHub.Issues.ListIssueTimeline(context.Context(), context.Repo.Owner, context.Repo.Name, issue.GetNumber(), opts)
+		if err != nil {
+			return nil, err
+		}
+		timeline = append(timeline, events...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return timeline, nil
+}
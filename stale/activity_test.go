@@ -0,0 +1,186 @@
+package stale
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLastActivity(t *testing.T) {
+	at := func(day int) *github.Timestamp {
+		return &github.Timestamp{Time: time.Date(2026, time.June, day, 0, 0, 0, 0, time.UTC)}
+	}
+	user := func(login string) *github.User { return &github.User{Login: github.String(login)} }
+	issue := &github.Issue{User: user("author"), CreatedAt: at(1)}
+	timeline := []*github.Timeline{
+		{Event: github.String("commented"), Actor: user("author"), CreatedAt: at(2)},
+		{Event: github.String("commented"), Actor: user("maintainer"), CreatedAt: at(3)},
+		{Event: github.String("cross-referenced"), Actor: user("someone"), CreatedAt: at(4)},
+		{Event: github.String("commented"), Actor: &github.User{Login: github.String("dependabot[bot]"), Type: github.String("Bot")}, CreatedAt: at(5)},
+		{Event: github.String("labeled"), Actor: user("jekyllbot"), Label: &github.Label{Name: github.String("needs-team")}, CreatedAt: at(6)},
+		{Event: github.String("commented"), Actor: user("jekyllbot"), CreatedAt: at(7)},
+	}
+	config := Configuration{Bots: []string{"jekyllbot"}}
+	anyone := func(string) bool { return true }
+
+	when, what := lastActivity(issue, timeline, time.Time{}, config, anyone)
+	assert.Equal(t, at(3).Time, when)
+	assert.Equal(t, "a comment by @maintainer", what)
+
+	when, what = lastActivity(issue, timeline, time.Time{}, config, func(login string) bool { return login == "author" })
+	assert.Equal(t, at(2).Time, when)
+	assert.Equal(t, "a comment by @author", what)
+
+	when, what = lastActivity(issue, timeline, time.Time{}, config, func(string) bool { return false })
+	assert.Equal(t, at(1).Time, when)
+	assert.Equal(t, "opening it", what)
+
+	// Marking it stale starts the countdown to closing, even by a bot.
+	marked := append(timeline, &github.Timeline{
+		Event: github.String("labeled"), Actor: user("jekyllbot"), Label: &github.Label{Name: github.String("stale")}, CreatedAt: at(8),
+	})
+	when, what = lastActivity(issue, marked, time.Time{}, config, anyone)
+	assert.Equal(t, at(8).Time, when)
+	assert.Equal(t, `marking it "stale"`, what)
+
+	// So does nudging the maintainers about an approved pull request.
+	nudged := append(timeline, &github.Timeline{
+		Event: github.String("commented"), Actor: user("jekyllbot"), Body: github.String("Please merge!\n\n" + nudgeMarker), CreatedAt: at(7),
+	})
+	when, what = lastActivity(issue, nudged, time.Time{}, config, anyone)
+	assert.Equal(t, at(7).Time, when)
+	assert.Equal(t, "nudging the maintainers", what)
+
+	// Reviews and commits on pull requests count too.
+	reviewed := append(timeline,
+		&github.Timeline{Event: github.String("reviewed"), User: user("reviewer"), SubmittedAt: at(9)},
+		&github.Timeline{Event: github.String("committed"), Committer: &github.CommitAuthor{Date: at(10)}},
+	)
+	when, what = lastActivity(issue, reviewed, time.Time{}, config, func(login string) bool { return login == "reviewer" })
+	assert.Equal(t, at(9).Time, when)
+	assert.Equal(t, "a review by @reviewer", what)
+	when, what = lastActivity(issue, reviewed, time.Time{}, config, anyone)
+	assert.Equal(t, at(10).Time, when)
+	assert.Equal(t, "a commit by @author", what)
+
+	// Pushing old commits or rebasing counts from when it's pushed.
+	pushed := append(timeline,
+		&github.Timeline{Event: github.String("committed"), Committer: &github.CommitAuthor{Date: at(1)}},
+		&github.Timeline{Event: github.String("head_ref_force_pushed"), Actor: user("rebaser"), CreatedAt: at(11)},
+	)
+	when, what = lastActivity(issue, pushed, time.Time{}, config, anyone)
+	assert.Equal(t, at(11).Time, when)
+	assert.Equal(t, "a force push by @rebaser", what)
+	when, what = lastActivity(issue, pushed, at(12).Time, config, anyone)
+	assert.Equal(t, at(12).Time, when)
+	assert.Equal(t, "a push by @author", what)
+	when, what = lastActivity(issue, pushed, at(12).Time, config, func(login string) bool { return login == "maintainer" })
+	assert.Equal(t, at(3).Time, when, "the author's push doesn't count for maintainer activity")
+}
+
+func TestEvaluate(t *testing.T) {
+	setup()
+	defer teardown()
+
+	context := ctx.NewTestContext()
+	context.SetRepo("o", "r")
+	context.GitHub = client
+
+	daysAgo := func(days int) string { return time.Now().AddDate(0, 0, -days).Format(time.RFC3339) }
+	mux.HandleFunc("/repos/o/r/issues/1/timeline", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		fmt.Fprintf(w, `[
+			{"event":"commented","actor":{"login":"author"},"created_at":%q},
+			{"event":"commented","actor":{"login":"member"},"created_at":%q},
+			{"event":"labeled","actor":{"login":"jekyllbot"},"label":{"name":"pending-feedback"},"created_at":%q},
+			{"event":"commented","actor":{"login":"jekyllbot"},"created_at":%q}
+		]`, daysAgo(90), daysAgo(70), daysAgo(65), daysAgo(1))
+	})
+	mux.HandleFunc("/repos/o/r/collaborators/member/permission", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"permission":"write"}`)
+	})
+	mux.HandleFunc("/repos/o/r/collaborators/author/permission", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"permission":"read"}`)
+	})
+
+	issue := &github.Issue{
+		Number:    github.Int(1),
+		User:      &github.User{Login: github.String("author")},
+		CreatedAt: &github.Timestamp{Time: time.Now().AddDate(0, 0, -100)},
+		// The bot's comment yesterday bumped this.
+		UpdatedAt: &github.Timestamp{Time: time.Now().AddDate(0, 0, -1)},
+	}
+	config := Configuration{DormantDuration: 60 * 24 * time.Hour, Bots: []string{"jekyllbot"}}
+
+	decision, err := Evaluate(context, issue, config)
+	assert.NoError(t, err)
+	assert.True(t, decision.Stale)
+	assert.Contains(t, decision.Reason, "the last activity by anyone was a comment by @member on ")
+
+	config.StaleLabels = []string{"pending-feedback"}
+	decision, err = Evaluate(context, issue, config)
+	assert.NoError(t, err)
+	assert.True(t, decision.Stale)
+	assert.Contains(t, decision.Reason, `marking it "pending-feedback"`)
+
+	config.StaleLabels = nil
+	config.CountedActivity = AuthorActivity
+	decision, err = Evaluate(context, issue, config)
+	assert.NoError(t, err)
+	assert.Contains(t, decision.Reason, "the last activity by the author was a comment by @author on ")
+
+	config.CountedActivity = MaintainerActivity
+	config.DormantDuration = 80 * 24 * time.Hour
+	decision, err = Evaluate(context, issue, config)
+	assert.NoError(t, err)
+	assert.False(t, decision.Stale)
+	assert.Contains(t, decision.Reason, "the last activity by a maintainer was a comment by @member on ")
+
+	config.ExemptLabels = []string{"pinned"}
+	issue.Labels = []*github.Label{{Name: github.String("pinned")}}
+	decision, err = Evaluate(context, issue, config)
+	assert.NoError(t, err)
+	assert.Equal(t, Decision{Stale: false, Reason: `it has the exempt label "pinned"`}, decision)
+}
+
+func TestEvaluatePullRequestPushedAfterCommitting(t *testing.T) {
+	setup()
+	defer teardown()
+
+	context := ctx.NewTestContext()
+	context.SetRepo("o", "r")
+	context.GitHub = client
+
+	daysAgo := func(days int) string { return time.Now().AddDate(0, 0, -days).Format(time.RFC3339) }
+	mux.HandleFunc("/repos/o/r/issues/1/timeline", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"event":"committed","committer":{"date":%q}}]`, daysAgo(90))
+	})
+	mux.HandleFunc("/repos/o/r/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		fmt.Fprint(w, `{"number":1,"head":{"sha":"abc123"}}`)
+	})
+	// The commit was made long ago, but only pushed yesterday.
+	mux.HandleFunc("/repos/o/r/commits/abc123/check-suites", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"total_count":2,"check_suites":[{"created_at":%q},{"created_at":%q}]}`, daysAgo(0), daysAgo(1))
+	})
+
+	issue := &github.Issue{
+		Number:           github.Int(1),
+		User:             &github.User{Login: github.String("author")},
+		CreatedAt:        &github.Timestamp{Time: time.Now().AddDate(0, 0, -100)},
+		UpdatedAt:        &github.Timestamp{Time: time.Now().AddDate(0, 0, -1)},
+		PullRequestLinks: &github.PullRequestLinks{},
+	}
+	config := Configuration{PullRequests: &PullRequestPolicy{DormantDuration: 60 * 24 * time.Hour}}
+
+	decision, err := Evaluate(context, issue, config)
+	assert.NoError(t, err)
+	assert.False(t, decision.Stale)
+	assert.Equal(t, "a push by @author", decision.LastActivityWhat)
+	assert.Equal(t, daysAgo(1), decision.LastActivity.Format(time.RFC3339))
+}
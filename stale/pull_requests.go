@@ -0,0 +1,179 @@
+package stale
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/ctx"
+)
+
+// nudgeMarker is hidden in the approved comment so the nudge restarts the
+// dormancy clock, and maintainers are only nudged once per dormant period.
+const nudgeMarker = "<!-- stale:approved-nudge -->"
+
+// PullRequestPolicy is how stale pull requests are handled. Pull requests
+// are never marked or closed without one.
+type PullRequestPolicy struct {
+	// After this duration, the next action is performed (either mark or close).
+	DormantDuration time.Duration
+
+	// After this duration, the next action is performed on a draft pull request.
+	// If zero, drafts are never stale.
+	DraftDormantDuration time.Duration
+
+	// If a pull request has this label, it is not stale.
+	ExemptLabels []string
+
+	// Comment to leave on a stale pull request if being marked.
+	// No comment is left if this is nil.
+	NotificationComment *github.IssueComment
+
+	// Comment to leave on a stale pull request before it's closed, e.g. with
+	// instructions for reopening it. No comment is left if this is nil.
+	ClosingComment *github.IssueComment
+
+	// Comment to leave on a dormant pull request which has an LGTM or an
+	// approving review, which is never marked or closed. It's left again only
+	// once the pull request has been dormant for as long since. No comment is
+	// left if this is nil.
+	ApprovedComment *github.IssueComment
+}
+
+func isPullRequest(issue *github.Issue) bool {
+	return issue.PullRequestLinks != nil
+}
+
+// dormantDuration returns how long the issue or pull request may go without
+// an update, or zero if it can't go stale.
+func dormantDuration(issue *github.Issue, config Configuration) time.Duration {
+	if !isPullRequest(issue) {
+		return config.DormantDuration
+	}
+	if config.PullRequests == nil {
+		return 0
+	}
+	if issue.GetDraft() {
+		return config.PullRequests.DraftDormantDuration
+	}
+	return config.PullRequests.DormantDuration
+}
+
+func exemptLabels(issue *github.Issue, config Configuration) []string {
+	if isPullRequest(issue) {
+		return config.PullRequests.ExemptLabels
+	}
+	return config.ExemptLabels
+}
+
+// isApproved returns true if someone's latest review of the pull request
+// approves it, or its head commit has a successful LGTM status or check
+// run.
+func isApproved(context *ctx.Context, issue *github.Issue) (bool, error) {
+	owner, name, number := context.Repo.Owner, context.Repo.Name, issue.GetNumber()
+
+	// A later review requesting changes or a dismissal overrides an
+	// approval; comments don't.
+	latestReviews := map[string]string{}
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		reviews, resp, err := context.GitHub.PullRequests.ListReviews(context.Context(), owner, name, number, opts)
+		if err != nil {
+			return false, err
+		}
+		for _, review := range reviews {
+			switch review.GetState() {
+			case "APPROVED", "CHANGES_REQUESTED", "DISMISSED":
+				latestReviews[review.GetUser().GetLogin()] = review.GetState()
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	for _, state := range latestReviews {
+		if state == "APPROVED" {
+			return true, nil
+		}
+	}
+
+	pr, _, err := context.GitHub.PullRequests.Get(context.Context(), owner, name, number)
+	if err != nil {
+		return false, err
+	}
+	status, _, err := context.GitHub.Repositories.GetCombinedStatus(context.Context(), owner, name, pr.GetHead().GetSHA(), nil)
+	if err != nil {
+		return false, err
+	}
+	for _, repoStatus := range status.Statuses {
+		if strings.HasSuffix(repoStatus.GetContext(), "/lgtm") && repoStatus.GetState() == "success" {
+			return true, nil
+		}
+	}
+
+	// Repos using the lgtm handler's Check Run mode don't set a status.
+	checkRuns, _, err := context.GitHub.Checks.ListCheckRunsForRef(context.Context(), owner, name, pr.GetHead().GetSHA(),
+		&github.ListCheckRunsOptions{CheckName: github.String(owner + "/lgtm")})
+	if err != nil {
+		return false, err
+	}
+	for _, run := range checkRuns.CheckRuns {
+		if run.GetConclusion() == "success" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// planPullRequestAction returns what to do with a stale pull request: mark
+// or close it, or nudge the maintainers about it if it's been approved.
+func planPullRequestAction(context *ctx.Context, issue *github.Issue, config Configuration) (string, error) {
+	approved, err := isApproved(context, issue)
+	if err != nil {
+		return "", context.NewError("stale: couldn't tell whether %s#%d is approved: %+v", context.Repo, *issue.Number, err)
+	}
+	if approved {
+		if config.PullRequests.ApprovedComment == nil {
+			return "", nil
+		}
+		return ActionNudge, nil
+	}
+	if hasStaleLabel(issue, config) {
+		return ActionClose, nil
+	}
+	return ActionMark, nil
+}
+
+// nudge leaves the approved comment on the pull request, with the marker.
+func nudge(context *ctx.Context, issue *github.Issue, comment *github.IssueComment) error {
+	return leaveComment(context, issue, &github.IssueComment{
+		Body: github.String(comment.GetBody() + "\n\n" + nudgeMarker),
+	})
+}
+
+func closePullRequest(context *ctx.Context, issue *github.Issue, comment *github.IssueComment) error {
+	if comment != nil {
+		if err := leaveComment(context, issue, comment); err != nil {
+			return err
+		}
+	}
+	_, _, err := context.GitHub.PullRequests.Edit(
+		context.Context(),
+		context.Repo.Owner,
+		context.Repo.Name,
+		*issue.Number,
+		&github.PullRequest{State: github.String("closed")},
+	)
+	return err
+}
+
+func leaveComment(context *ctx.Context, issue *github.Issue, comment *github.IssueComment) error {
+	_, _, err := context.GitHub.Issues.CreateComment(
+		context.Context(),
+		context.Repo.Owner, context.Repo.Name, *issue.Number, comment)
+	if err != nil {
+		return context.NewError("stale: couldn't leave comment on %s#%d: %+v", context.Repo, *issue.Number, err)
+	}
+	return nil
+}
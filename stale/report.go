@@ -0,0 +1,261 @@
+package stale
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/ctx"
+)
+
+// Formats a report can be written in. Only JSON and CSV reports can be read
+// back; Markdown is for reviewing.
+const (
+	FormatJSON     = "json"
+	FormatCSV      = "csv"
+	FormatMarkdown = "markdown"
+)
+
+var csvHeader = []string{"repo", "number", "title", "url", "action", "last_activity", "last_activity_what", "labels", "reason"}
+
+// Proposal is an action the bot would take on a stale issue or pull request.
+type Proposal struct {
+	Repo             string    `json:"repo"`
+	Number           int       `json:"number"`
+	Title            string    `json:"title"`
+	URL              string    `json:"url"`
+	Action           string    `json:"action"`
+	LastActivity     time.Time `json:"last_activity"`
+	LastActivityWhat string    `json:"last_activity_what"`
+	Labels           []string  `json:"labels"`
+	Reason           string    `json:"reason"`
+}
+
+// ProposeForRepo returns the action which would be taken on each stale issue
+// and pull request in the repo, without taking any of them.
+func ProposeForRepo(context *ctx.Context, config Configuration) ([]Proposal, error) {
+	if context.Repo.IsEmpty() {
+		return nil, context.NewError("stale: no repository present in context")
+	}
+
+	allIssues, err := listOpenIssues(context)
+	if err != nil {
+		return nil, err
+	}
+
+	proposals, failedIssues := []Proposal{}, 0
+	for _, issue := range allIssues {
+		decision, err := Evaluate(context, issue, config)
+		if err != nil {
+			context.Log("ERR %s !! failed evaluating issue %d: %+v", context.Repo, *issue.Number, err)
+			failedIssues += 1
+			continue
+		}
+		if !decision.Stale {
+			continue
+		}
+
+		action, err := planAction(context, issue, config)
+		if err != nil {
+			context.Log("ERR %s !! failed planning issue %d: %+v", context.Repo, *issue.Number, err)
+			failedIssues += 1
+			continue
+		}
+		if action == "" {
+			continue
+		}
+		proposals = append(proposals, newProposal(context, issue, action, decision))
+	}
+
+	if failedIssues > 0 {
+		return proposals, context.NewError("ERR %s !! failed issues: %d", context.Repo, failedIssues)
+	}
+	return proposals, nil
+}
+
+func newProposal(context *ctx.Context, issue *github.Issue, action string, decision Decision) Proposal {
+	labels := []string{}
+	for _, label := range issue.Labels {
+		labels = append(labels, label.GetName())
+	}
+	return Proposal{
+		Repo:             context.Repo.String(),
+		Number:           issue.GetNumber(),
+		Title:            issue.GetTitle(),
+		URL:              issue.GetHTMLURL(),
+		Action:           action,
+		LastActivity:     decision.LastActivity,
+		LastActivityWhat: decision.LastActivityWhat,
+		Labels:           labels,
+		Reason:           decision.Reason,
+	}
+}
+
+// ApplyProposal takes the proposed action on the issue in the context's repo.
+// Nothing is done if the issue has been closed, is no longer stale, or would
+// now get a different action, e.g. because it was approved since.
+func ApplyProposal(context *ctx.Context, config Configuration, proposal Proposal) error {
+	if context.Repo.IsEmpty() {
+		return context.NewError("stale: no repository present in context")
+	}
+	if proposal.Repo != context.Repo.String() {
+		return context.NewError("stale: proposal for %s#%d isn't for %s", proposal.Repo, proposal.Number, context.Repo)
+	}
+
+	issue, _, err := context.GitHub.Issues.Get(context.Context(), context.Repo.Owner, context.Repo.Name, proposal.Number)
+	if err != nil {
+		return context.NewError("stale: couldn't fetch %s#%d: %+v", context.Repo, proposal.Number, err)
+	}
+	if issue.GetState() != "open" {
+		return context.NewError("stale: %s#%d has been closed since the report", context.Repo, proposal.Number)
+	}
+
+	decision, err := Evaluate(context, issue, config)
+	if err != nil {
+		return err
+	}
+	if !decision.Stale {
+		return context.NewError("stale: %s#%d is no longer stale: %s", context.Repo, proposal.Number, decision.Reason)
+	}
+
+	action, err := planAction(context, issue, config)
+	if err != nil {
+		return err
+	}
+	if action != proposal.Action {
+		return context.NewError("stale: %s#%d would now get %q rather than the approved %q", context.Repo, proposal.Number, action, proposal.Action)
+	}
+
+	return applyAction(context, issue, config, action, decision.Reason)
+}
+
+// SortProposals orders the proposals by repo, then number.
+func SortProposals(proposals []Proposal) {
+	sort.Slice(proposals, func(i, j int) bool {
+		if proposals[i].Repo != proposals[j].Repo {
+			return proposals[i].Repo < proposals[j].Repo
+		}
+		return proposals[i].Number < proposals[j].Number
+	})
+}
+
+// WriteReport writes the proposals in the given format.
+func WriteReport(w io.Writer, format string, proposals []Proposal) error {
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(proposals)
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+		writer.Write(csvHeader)
+		for _, p := range proposals {
+			writer.Write([]string{
+				p.Repo,
+				strconv.Itoa(p.Number),
+				p.Title,
+				p.URL,
+				p.Action,
+				p.LastActivity.Format(time.RFC3339),
+				p.LastActivityWhat,
+				strings.Join(p.Labels, ","),
+				p.Reason,
+			})
+		}
+		writer.Flush()
+		return writer.Error()
+	case FormatMarkdown:
+		_, err := io.WriteString(w, markdownReport(proposals))
+		return err
+	default:
+		return fmt.Errorf("stale: unknown report format %q", format)
+	}
+}
+
+func markdownReport(proposals []Proposal) string {
+	var buf bytes.Buffer
+	buf.WriteString("| Issue | Title | Action | Last activity | Labels | Reason |\n")
+	buf.WriteString("| --- | --- | --- | --- | --- | --- |\n")
+	for _, p := range proposals {
+		labels := []string{}
+		for _, label := range p.Labels {
+			labels = append(labels, "`"+label+"`")
+		}
+		fmt.Fprintf(&buf, "| [%s#%d](%s) | %s | %s | %s (%s) | %s | %s |\n",
+			p.Repo, p.Number, p.URL,
+			escapeMarkdownCell(p.Title),
+			p.Action,
+			escapeMarkdownCell(p.LastActivityWhat), p.LastActivity.Format("2006-01-02"),
+			strings.Join(labels, " "),
+			escapeMarkdownCell(p.Reason),
+		)
+	}
+	return buf.String()
+}
+
+func escapeMarkdownCell(text string) string {
+	return strings.Replace(text, "|", `\|`, -1)
+}
+
+// ReadReport reads back proposals written by WriteReport as JSON or CSV.
+func ReadReport(r io.Reader, format string) ([]Proposal, error) {
+	switch format {
+	case FormatJSON:
+		proposals := []Proposal{}
+		if err := json.NewDecoder(r).Decode(&proposals); err != nil {
+			return nil, fmt.Errorf("stale: couldn't read JSON report: %v", err)
+		}
+		return proposals, nil
+	case FormatCSV:
+		return readCSVReport(r)
+	default:
+		return nil, fmt.Errorf("stale: can't read %q reports", format)
+	}
+}
+
+func readCSVReport(r io.Reader) ([]Proposal, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("stale: couldn't read CSV report: %v", err)
+	}
+	if len(records) == 0 || strings.Join(records[0], ",") != strings.Join(csvHeader, ",") {
+		return nil, fmt.Errorf("stale: CSV report doesn't start with the header %q", strings.Join(csvHeader, ","))
+	}
+
+	proposals := []Proposal{}
+	for i, record := range records[1:] {
+		number, err := strconv.Atoi(record[1])
+		if err != nil {
+			return nil, fmt.Errorf("stale: line %d of CSV report: %q isn't a number", i+2, record[1])
+		}
+		lastActivity, err := time.Parse(time.RFC3339, record[5])
+		if err != nil {
+			return nil, fmt.Errorf("stale: line %d of CSV report: %q isn't a time", i+2, record[5])
+		}
+		labels := []string{}
+		for _, label := range strings.Split(record[7], ",") {
+			if label = strings.TrimSpace(label); label != "" {
+				labels = append(labels, label)
+			}
+		}
+		proposals = append(proposals, Proposal{
+			Repo:             record[0],
+			Number:           number,
+			Title:            record[2],
+			URL:              record[3],
+			Action:           record[4],
+			LastActivity:     lastActivity,
+			LastActivityWhat: record[6],
+			Labels:           labels,
+			Reason:           record[8],
+		})
+	}
+	return proposals, nil
+}
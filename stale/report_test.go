@@ -0,0 +1,136 @@
+package stale
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v73/github"
+	"github.com/jekyll/jekyllbot/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+var testProposals = []Proposal{
+	{
+		Repo:             "jekyll/jekyll",
+		Number:           12,
+		Title:            "Sass | SCSS errors",
+		URL:              "https://github.com/jekyll/jekyll/issues/12",
+		Action:           ActionClose,
+		LastActivity:     time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC),
+		LastActivityWhat: `marking it "stale"`,
+		Labels:           []string{"stale", "bug"},
+		Reason:           "the last activity by anyone was marking it \"stale\" on 2026-03-01, over 60 days ago",
+	},
+	{
+		Repo:             "jekyll/minima",
+		Number:           3,
+		Title:            "Dark mode",
+		URL:              "https://github.com/jekyll/minima/pull/3",
+		Action:           ActionMark,
+		LastActivity:     time.Date(2026, time.February, 2, 0, 0, 0, 0, time.UTC),
+		LastActivityWhat: "a comment by @author",
+		Labels:           []string{},
+		Reason:           "the last activity by anyone was a comment by @author on 2026-02-02, over 60 days ago",
+	},
+}
+
+func TestReportRoundTrip(t *testing.T) {
+	for _, format := range []string{FormatJSON, FormatCSV} {
+		var buf bytes.Buffer
+		assert.NoError(t, WriteReport(&buf, format, testProposals), format)
+		proposals, err := ReadReport(&buf, format)
+		assert.NoError(t, err, format)
+		assert.Equal(t, testProposals, proposals, format)
+	}
+
+	_, err := ReadReport(bytes.NewBufferString("number,repo\n"), FormatCSV)
+	assert.Error(t, err)
+	_, err = ReadReport(bytes.NewBufferString(""), FormatMarkdown)
+	assert.Error(t, err)
+}
+
+func TestMarkdownReport(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, WriteReport(&buf, FormatMarkdown, testProposals))
+	assert.Equal(t, "| Issue | Title | Action | Last activity | Labels | Reason |\n"+
+		"| --- | --- | --- | --- | --- | --- |\n"+
+		"| [jekyll/jekyll#12](https://github.com/jekyll/jekyll/issues/12) | Sass \\| SCSS errors | close | marking it \"stale\" (2026-03-01) | `stale` `bug` | the last activity by anyone was marking it \"stale\" on 2026-03-01, over 60 days ago |\n"+
+		"| [jekyll/minima#3](https://github.com/jekyll/minima/pull/3) | Dark mode | mark | a comment by @author (2026-02-02) |  | the last activity by anyone was a comment by @author on 2026-02-02, over 60 days ago |\n",
+		buf.String())
+}
+
+func TestProposeForRepo(t *testing.T) {
+	setup()
+	defer teardown()
+
+	context := ctx.NewTestContext()
+	context.SetRepo("o", "r")
+	context.GitHub = client
+
+	longAgo := time.Now().AddDate(0, -3, 0).Format(time.RFC3339)
+	recently := time.Now().AddDate(0, 0, -1).Format(time.RFC3339)
+	mux.HandleFunc("/repos/o/r/issues", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		fmt.Fprintf(w, `[
+			{"number":1,"title":"Old","html_url":"https://github.com/o/r/issues/1","updated_at":%q,"labels":[{"name":"stale"}]},
+			{"number":2,"title":"Old too","updated_at":%q},
+			{"number":3,"title":"Pinned","updated_at":%q,"labels":[{"name":"pinned"}]},
+			{"number":4,"title":"Active","updated_at":%q,"created_at":%q}
+		]`, longAgo, longAgo, longAgo, recently, recently)
+	})
+
+	mux.HandleFunc("/repos/o/r/issues/4/timeline", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"event":"commented","actor":{"login":"author"},"created_at":%q}]`, recently)
+	})
+
+	proposals, err := ProposeForRepo(context, Configuration{
+		DormantDuration: 60 * 24 * time.Hour,
+		ExemptLabels:    []string{"pinned"},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, proposals, 2) {
+		assert.Equal(t, "o/r", proposals[0].Repo)
+		assert.Equal(t, 1, proposals[0].Number)
+		assert.Equal(t, ActionClose, proposals[0].Action)
+		assert.Equal(t, []string{"stale"}, proposals[0].Labels)
+		assert.Contains(t, proposals[0].Reason, "nothing has happened since")
+		assert.Equal(t, 2, proposals[1].Number)
+		assert.Equal(t, ActionMark, proposals[1].Action)
+	}
+}
+
+func TestApplyProposal(t *testing.T) {
+	setup()
+	defer teardown()
+
+	context := ctx.NewTestContext()
+	context.SetRepo("o", "r")
+	context.GitHub = client
+
+	longAgo := time.Now().AddDate(0, -3, 0).Format(time.RFC3339)
+	closed := false
+	mux.HandleFunc("/repos/o/r/issues/1", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PATCH" {
+			request := &github.IssueRequest{}
+			json.NewDecoder(r.Body).Decode(request)
+			closed = request.GetState() == "closed"
+		}
+		fmt.Fprintf(w, `{"number":1,"state":"open","updated_at":%q,"labels":[{"name":"stale"}]}`, longAgo)
+	})
+	config := Configuration{Perform: true, DormantDuration: 60 * 24 * time.Hour}
+
+	err := ApplyProposal(context, config, Proposal{Repo: "o/r", Number: 1, Action: ActionMark})
+	assert.EqualError(t, err, `stale: o/r#1 would now get "close" rather than the approved "mark"`)
+	assert.False(t, closed)
+
+	err = ApplyProposal(context, config, Proposal{Repo: "o/other", Number: 1, Action: ActionClose})
+	assert.Error(t, err)
+	assert.False(t, closed)
+
+	assert.NoError(t, ApplyProposal(context, config, Proposal{Repo: "o/r", Number: 1, Action: ActionClose}))
+	assert.True(t, closed)
+}
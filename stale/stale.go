@@ -32,50 +32,61 @@ type Configuration struct {
 	// Comment to leave on a stale issue if being marked.
 	// No comment is left if this is stale.
 	NotificationComment *github.IssueComment
+
+	// How to handle pull requests. If nil, pull requests are never stale.
+	PullRequests *PullRequestPolicy
+
+	// Whose comments and events keep an issue from going stale. Defaults to anyone.
+	CountedActivity ActivityActors
+
+	// Logins whose activity never counts, in addition to GitHub Apps.
+	Bots []string
 }
 
+// Actions which can be taken on a stale issue or pull request.
+const (
+	// Label it stale and leave the notification comment.
+	ActionMark = "mark"
+	// Close it, as it was already marked stale.
+	ActionClose = "close"
+	// Ask the maintainers to merge an approved pull request.
+	ActionNudge = "nudge"
+)
+
 func MarkAndCloseForRepo(context *ctx.Context, config Configuration) error {
 	if context.Repo.IsEmpty() {
 		return context.NewError("stale: no repository present in context")
 	}
 
-	owner, name, nonStaleIssues, failedIssues := context.Repo.Owner, context.Repo.Name, 0, 0
-
-	staleIssuesListOptions := &github.IssueListByRepoOptions{
-		State:       "open",
-		Sort:        "updated",
-		Direction:   "asc",
-		ListOptions: github.ListOptions{Page: 0, PerPage: 200},
-	}
-
-	allIssues := []*github.Issue{}
+	nonStaleIssues, failedIssues := 0, 0
 
-	for {
-		issues, resp, err := context.GitHub.Issues.ListByRepo(context.Context(), owner, name, staleIssuesListOptions)
-		if err != nil {
-			return context.NewError("could not list issues for %s/%s: %v", owner, name, err)
-		}
-
-		allIssues = append(allIssues, issues...)
-
-		if resp.NextPage == 0 {
-			break
-		}
-		staleIssuesListOptions.ListOptions.Page = resp.NextPage
+	allIssues, err := listOpenIssues(context)
+	if err != nil {
+		return err
 	}
 
 	if len(allIssues) == 0 {
-		context.Log("no issues for %s/%s", owner, name)
+		context.Log("no issues for %s", context.Repo)
 		return nil
 	}
 
 	for _, issue := range allIssues {
-		if !IsStale(issue, config) {
+		decision, err := Evaluate(context, issue, config)
+		if err != nil {
+			context.Log("ERR %s !! failed evaluating issue %d: %+v", context.Repo, *issue.Number, err)
+			failedIssues += 1
+			continue
+		}
+
+		if !decision.Stale {
+			if !config.Perform {
+				context.Log("https://github.com/%s/issues/%d is not stale (dry-run): %s.", context.Repo, *issue.Number, decision.Reason)
+			}
 			nonStaleIssues += 1
 			continue
 		}
 
-		err := MarkOrCloseIssue(context, issue, config)
+		err = markOrClose(context, issue, config, decision)
 		if err != nil {
 			context.Log("ERR %s !! failed marking or closing issue %d: %+v", context.Repo, *issue.Number, err)
 			failedIssues += 1
@@ -95,31 +106,109 @@ func MarkOrCloseIssue(context *ctx.Context, issue *github.Issue, config Configur
 		return context.NewError("stale: no repository present in context")
 	}
 
-	if !IsStale(issue, config) {
-		return context.NewError("stale: issue %s#%d is not stale", context.Repo, *issue.Number)
+	decision, err := Evaluate(context, issue, config)
+	if err != nil {
+		return err
+	}
+	if !decision.Stale {
+		return context.NewError("stale: issue %s#%d is not stale: %s", context.Repo, *issue.Number, decision.Reason)
 	}
 
+	return markOrClose(context, issue, config, decision)
+}
+
+func markOrClose(context *ctx.Context, issue *github.Issue, config Configuration, decision Decision) error {
+	action, err := planAction(context, issue, config)
+	if err != nil {
+		return err
+	}
+	return applyAction(context, issue, config, action, decision.Reason)
+}
+
+// planAction returns what to do with a stale issue or pull request, or "" if
+// it should be left be.
+func planAction(context *ctx.Context, issue *github.Issue, config Configuration) (string, error) {
+	if isPullRequest(issue) {
+		return planPullRequestAction(context, issue, config)
+	}
 	if hasStaleLabel(issue, config) {
+		return ActionClose, nil
+	}
+	return ActionMark, nil
+}
+
+// applyAction performs the action, or just logs it if this is a dry-run.
+func applyAction(context *ctx.Context, issue *github.Issue, config Configuration, action, reason string) error {
+	kind, notification := "issues", config.NotificationComment
+	if isPullRequest(issue) {
+		kind, notification = "pull", config.PullRequests.NotificationComment
+	}
+
+	switch action {
+	case ActionClose:
 		// Close!
 		if config.Perform {
-			context.Log("https://github.com/%s/issues/%d is being closed.", context.Repo, *issue.Number)
+			context.Log("https://github.com/%s/%s/%d is being closed: %s.", context.Repo, kind, *issue.Number, reason)
+			if isPullRequest(issue) {
+				return closePullRequest(context, issue, config.PullRequests.ClosingComment)
+			}
 			return closeIssue(context, issue)
 		} else {
-			context.Log("https://github.com/%s/issues/%d would have been closed (dry-run).", context.Repo, *issue.Number)
+			context.Log("https://github.com/%s/%s/%d would have been closed (dry-run): %s.", context.Repo, kind, *issue.Number, reason)
 		}
-	} else {
+	case ActionMark:
 		// Mark!
 		if config.Perform {
-			context.Log("https://github.com/%s/issues/%d is being marked.", context.Repo, *issue.Number)
-			return markIssue(context, issue, config.NotificationComment)
+			context.Log("https://github.com/%s/%s/%d is being marked: %s.", context.Repo, kind, *issue.Number, reason)
+			return markIssue(context, issue, notification)
+		} else {
+			context.Log("https://github.com/%s/%s/%d would have been marked (dry-run): %s.", context.Repo, kind, *issue.Number, reason)
+		}
+	case ActionNudge:
+		if config.Perform {
+			context.Log("https://github.com/%s/%s/%d is approved, nudging maintainers: %s.", context.Repo, kind, *issue.Number, reason)
+			return nudge(context, issue, config.PullRequests.ApprovedComment)
 		} else {
-			context.Log("https://github.com/%s/issues/%d would have been marked (dry-run).", context.Repo, *issue.Number)
+			context.Log("https://github.com/%s/%s/%d is approved, maintainers would have been nudged (dry-run): %s.", context.Repo, kind, *issue.Number, reason)
 		}
+	case "":
+		context.Log("https://github.com/%s/%s/%d is approved, leaving it be.", context.Repo, kind, *issue.Number)
+	default:
+		return context.NewError("stale: unknown action %q for %s#%d", action, context.Repo, *issue.Number)
 	}
 
 	return nil
 }
 
+// listOpenIssues returns the open issues and pull requests in the repo, least
+// recently updated first.
+func listOpenIssues(context *ctx.Context) ([]*github.Issue, error) {
+	staleIssuesListOptions := &github.IssueListByRepoOptions{
+		State:       "open",
+		Sort:        "updated",
+		Direction:   "asc",
+		ListOptions: github.ListOptions{Page: 0, PerPage: 200},
+	}
+
+	allIssues := []*github.Issue{}
+
+	for {
+		issues, resp, err := context.GitHub.Issues.ListByRepo(context.Context(), context.Repo.Owner, context.Repo.Name, staleIssuesListOptions)
+		if err != nil {
+			return nil, context.NewError("could not list issues for %s: %v", context.Repo, err)
+		}
+
+		allIssues = append(allIssues, issues...)
+
+		if resp.NextPage == 0 {
+			break
+		}
+		staleIssuesListOptions.ListOptions.Page = resp.NextPage
+	}
+
+	return allIssues, nil
+}
+
 func closeIssue(context *ctx.Context, issue *github.Issue) error {
 	_, _, err := context.GitHub.Issues.Edit(
 		context.Context(),
@@ -154,31 +243,28 @@ func markIssue(context *ctx.Context, issue *github.Issue, comment *github.IssueC
 	return nil
 }
 
+// IsStale returns true if the issue isn't exempt and nothing at all has
+// happened on it within its dormant duration. Evaluate also looks at whose
+// activity it was.
 func IsStale(issue *github.Issue, config Configuration) bool {
-	return issue.PullRequestLinks == nil &&
-		!isUpdatedWithinDuration(issue, config) &&
-		excludesNonStaleableLabels(issue, config)
+	return exemption(issue, config) == "" && !isUpdatedWithinDuration(issue, config)
 }
 
 func isUpdatedWithinDuration(issue *github.Issue, config Configuration) bool {
-	return (*issue.UpdatedAt).Unix() >= time.Now().Add(-config.DormantDuration).Unix()
+	return (*issue.UpdatedAt).Unix() >= time.Now().Add(-dormantDuration(issue, config)).Unix()
 }
 
-// Returns true if none of the exempt labels are present, false if at least one exempt label is present.
-func excludesNonStaleableLabels(issue *github.Issue, config Configuration) bool {
-	if len(issue.Labels) == 0 {
-		return true
-	}
-
-	for _, exemptLabel := range config.ExemptLabels {
+// Returns the first exempt label present on the issue, or "" if none are.
+func exemptLabel(issue *github.Issue, config Configuration) string {
+	for _, exemptLabel := range exemptLabels(issue, config) {
 		for _, issueLabel := range issue.Labels {
 			if *issueLabel.Name == exemptLabel {
-				return false
+				return exemptLabel
 			}
 		}
 	}
 
-	return true
+	return ""
 }
 
 func hasStaleLabel(issue *github.Issue, config Configuration) bool {
@@ -187,15 +273,22 @@ func hasStaleLabel(issue *github.Issue, config Configuration) bool {
 	}
 
 	for _, issueLabel := range issue.Labels {
-		if *issueLabel.Name == "stale" {
+		if isStaleLabel(*issueLabel.Name, config) {
 			return true
 		}
-		for _, staleLabel := range config.StaleLabels {
-			if *issueLabel.Name == staleLabel {
-				return true
-			}
-		}
 	}
 
 	return false
 }
+
+func isStaleLabel(name string, config Configuration) bool {
+	if name == "stale" {
+		return true
+	}
+	for _, staleLabel := range config.StaleLabels {
+		if name == staleLabel {
+			return true
+		}
+	}
+	return false
+}
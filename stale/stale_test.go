@@ -79,3 +79,140 @@ func TestCloseIssue(t *testing.T) {
 		t.Fatalf("expected no error closing issue, got: %+v", err)
 	}
 }
+
+func TestIsStalePullRequests(t *testing.T) {
+	threeMonthsAgo := &github.Timestamp{Time: time.Now().AddDate(0, -3, 0)}
+	pullRequest := func(draft bool, labels ...string) *github.Issue {
+		issue := &github.Issue{
+			UpdatedAt:        threeMonthsAgo,
+			PullRequestLinks: &github.PullRequestLinks{},
+			Draft:            github.Bool(draft),
+		}
+		for _, label := range labels {
+			issue.Labels = append(issue.Labels, &github.Label{Name: github.String(label)})
+		}
+		return issue
+	}
+	policy := &PullRequestPolicy{
+		DormantDuration:      60 * 24 * time.Hour,
+		DraftDormantDuration: 180 * 24 * time.Hour,
+		ExemptLabels:         []string{"pending-rebase"},
+	}
+	config := Configuration{DormantDuration: 60 * 24 * time.Hour, ExemptLabels: []string{"pinned"}}
+
+	assert.False(t, IsStale(pullRequest(false), config), "pull requests aren't stale without a policy")
+
+	config.PullRequests = policy
+	assert.True(t, IsStale(pullRequest(false), config))
+	assert.True(t, IsStale(pullRequest(false, "pinned"), config), "issue exempt labels don't apply to pull requests")
+	assert.False(t, IsStale(pullRequest(false, "pending-rebase"), config))
+	assert.False(t, IsStale(pullRequest(true), config), "drafts get longer")
+
+	policy.DraftDormantDuration = 0
+	assert.False(t, IsStale(pullRequest(true), config), "drafts are never stale without a draft duration")
+}
+
+func TestMarkOrCloseStalePullRequest(t *testing.T) {
+	setup()
+	defer teardown()
+
+	context := ctx.NewTestContext()
+	context.SetRepo("o", "r")
+	context.GitHub = client
+
+	mux.HandleFunc("/repos/o/r/pulls/1/reviews", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+			{"state":"APPROVED","user":{"login":"parkr"}},
+			{"state":"CHANGES_REQUESTED","user":{"login":"parkr"}},
+			{"state":"COMMENTED","user":{"login":"parkr"}}
+		]`)
+	})
+	mux.HandleFunc("/repos/o/r/commits/abc123/status", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"statuses":[{"context":"o/lgtm","state":"pending"}]}`)
+	})
+	mux.HandleFunc("/repos/o/r/commits/abc123/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"total_count":0,"check_runs":[]}`)
+	})
+	requests := []string{}
+	mux.HandleFunc("/repos/o/r/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PATCH" {
+			pr := &github.PullRequest{}
+			json.NewDecoder(r.Body).Decode(pr)
+			assert.Equal(t, "closed", pr.GetState())
+			requests = append(requests, "close")
+		}
+		fmt.Fprint(w, `{"number":1,"head":{"sha":"abc123"}}`)
+	})
+	mux.HandleFunc("/repos/o/r/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+		comment := &github.IssueComment{}
+		json.NewDecoder(r.Body).Decode(comment)
+		requests = append(requests, "comment: "+comment.GetBody())
+		fmt.Fprint(w, `{}`)
+	})
+
+	config := Configuration{
+		Perform: true,
+		PullRequests: &PullRequestPolicy{
+			DormantDuration: 24 * time.Hour,
+			ClosingComment:  &github.IssueComment{Body: github.String("Reopen it when you're ready!")},
+		},
+	}
+	issue := &github.Issue{
+		Number:           github.Int(1),
+		UpdatedAt:        &github.Timestamp{Time: time.Now().AddDate(0, 0, -2)},
+		PullRequestLinks: &github.PullRequestLinks{},
+		Labels:           []*github.Label{{Name: github.String("stale")}},
+	}
+
+	assert.NoError(t, MarkOrCloseIssue(context, issue, config))
+	assert.Equal(t, []string{"comment: Reopen it when you're ready!", "close"}, requests)
+}
+
+func TestMarkOrCloseApprovedPullRequest(t *testing.T) {
+	setup()
+	defer teardown()
+
+	context := ctx.NewTestContext()
+	context.SetRepo("o", "r")
+	context.GitHub = client
+
+	mux.HandleFunc("/repos/o/r/pulls/1/reviews", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	})
+	mux.HandleFunc("/repos/o/r/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		fmt.Fprint(w, `{"number":1,"head":{"sha":"abc123"}}`)
+	})
+	mux.HandleFunc("/repos/o/r/commits/abc123/status", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"statuses":[]}`)
+	})
+	mux.HandleFunc("/repos/o/r/commits/abc123/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "o/lgtm", r.URL.Query().Get("check_name"))
+		fmt.Fprint(w, `{"total_count":1,"check_runs":[{"name":"o/lgtm","status":"completed","conclusion":"success"}]}`)
+	})
+	comments := []string{}
+	mux.HandleFunc("/repos/o/r/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		comment := &github.IssueComment{}
+		json.NewDecoder(r.Body).Decode(comment)
+		comments = append(comments, comment.GetBody())
+		fmt.Fprint(w, `{}`)
+	})
+
+	config := Configuration{
+		Perform: true,
+		PullRequests: &PullRequestPolicy{
+			DormantDuration: 24 * time.Hour,
+			ApprovedComment: &github.IssueComment{Body: github.String("Maintainers, please merge!")},
+		},
+	}
+	issue := &github.Issue{
+		Number:           github.Int(1),
+		UpdatedAt:        &github.Timestamp{Time: time.Now().AddDate(0, 0, -2)},
+		PullRequestLinks: &github.PullRequestLinks{},
+		Labels:           []*github.Label{{Name: github.String("stale")}},
+	}
+
+	assert.NoError(t, MarkOrCloseIssue(context, issue, config))
+	assert.Equal(t, []string{"Maintainers, please merge!\n\n" + nudgeMarker}, comments)
+}